@@ -0,0 +1,195 @@
+// Package audit keeps a local, rotating log of the files the client has sent to and received from other peers.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Upload is the direction of transfers from the mini server of the client to other peers
+	Upload = "upload"
+	// Download is the direction of transfers from other peers to the client
+	Download = "download"
+
+	// ResultOK is the result of transfers that completed successfully
+	ResultOK = "ok"
+)
+
+// Record is a struct that contains:
+//    - Time        - the moment the transfer started
+//    - Direction   - "upload" or "download"
+//    - Peer        - the address of the other side of the transfer
+//    - User        - the identity of the other side of the transfer, "-" if it is unknown
+//    - File        - the path of the file on the machine of the user who shares it
+//    - Bytes       - how many bytes of the file were transferred
+//    - Encoding    - how the file was compressed while it was transferred, empty if the peers did not negotiate it
+//    - Transferred - how many bytes went over the connection, fewer than "Bytes" if the file was compressed or sent as a delta
+//    - Delta       - whether only the delta between an old copy of the downloader and the file was sent
+//    - Duration    - how long the transfer took
+//    - Result      - "ok", or the reason the transfer failed or was refused
+type Record struct {
+	Time        time.Time     `json:"time"`
+	Direction   string        `json:"direction"`
+	Peer        string        `json:"peer"`
+	User        string        `json:"user"`
+	File        string        `json:"file"`
+	Bytes       int64         `json:"bytes"`
+	Encoding    string        `json:"encoding,omitempty"`
+	Transferred int64         `json:"transferred_bytes,omitempty"`
+	Delta       bool          `json:"delta,omitempty"`
+	Duration    time.Duration `json:"duration_ns"`
+	Result      string        `json:"result"`
+}
+
+// Ratio is a function that returns how many times fewer bytes went over the connection than the file has, 0 if it is not known
+func (r Record) Ratio() float64 {
+	if r.Transferred == 0 {
+		return 0
+	}
+	return float64(r.Bytes) / float64(r.Transferred)
+}
+
+// String is a function that returns the Record as a single human readable line
+func (r Record) String() string {
+	compressed := ""
+	if r.Encoding != "" && (r.Transferred != r.Bytes || r.Delta) {
+		encoding := r.Encoding
+		if r.Delta {
+			encoding += ", delta"
+		}
+		compressed = fmt.Sprintf(" (%s, %d bytes transferred, %.1fx)", encoding, r.Transferred, r.Ratio())
+	}
+	return fmt.Sprintf("%s %s %s(%s) %q %d bytes%s in %s: %s",
+		r.Time.Format(time.RFC3339), r.Direction, r.User, r.Peer, r.File, r.Bytes, compressed, r.Duration.Round(time.Millisecond), r.Result)
+}
+
+// Log is a struct that contains:
+//    - path     - path to the file the records are appended to
+//    - maxBytes - the size after which the file is rotated
+//    - backups  - how many rotated files are kept, as "path.1"(the newest) to "path.N"(the oldest)
+//    - mutex    - a Mutex that is used for working safely with the files
+type Log struct {
+	path     string
+	maxBytes int64
+	backups  int
+	mutex    sync.Mutex
+}
+
+// CreateLog is a factory method that:
+//    - accepts:
+//         - path     - path to the file the records are appended to
+//         - maxBytes - the size after which the file is rotated
+//         - backups  - how many rotated files are kept
+//    - creates and returns a pointer to Log struct
+func CreateLog(path string, maxBytes int64, backups int) *Log {
+	return &Log{
+		path:     path,
+		maxBytes: maxBytes,
+		backups:  backups,
+	}
+}
+
+func (l *Log) backupPath(index int) string {
+	return l.path + "." + strconv.Itoa(index)
+}
+
+// rotate is a function that shifts the rotated files by one and moves the current file in their place.
+// It has to be called while "mutex" is held.
+func (l *Log) rotate() error {
+	if l.backups <= 0 {
+		return os.Remove(l.path)
+	}
+
+	os.Remove(l.backupPath(l.backups))
+	for index := l.backups - 1; index >= 1; index-- {
+		if err := os.Rename(l.backupPath(index), l.backupPath(index+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(l.path, l.backupPath(1))
+}
+
+// Append is a function that:
+//    - accepts:
+//         - record - the record to append
+//    - appends "record" as a JSON line, rotating the file first if it has grown past its maximum size
+//    (***) Returns error if the file cannot be rotated or written
+func (l *Log) Append(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("Could not encode audit record. %w", err)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if info, err := os.Stat(l.path); err == nil && info.Size()+int64(len(line))+1 > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("Could not rotate audit log %s. %w", l.path, err)
+		}
+	}
+
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Could not open audit log %s. %w", l.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("Could not write audit log %s. %w", l.path, err)
+	}
+	return nil
+}
+
+func readRecords(path, direction string, records []Record) ([]Record, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return records, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if record.Direction == direction {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Records is a function that:
+//    - accepts:
+//         - direction - "upload" or "download"
+//    - returns the records of the transfers in "direction" from the oldest to the newest, including the rotated files
+//    (***) Returns error if a file cannot be read, lines that are not valid records are skipped
+func (l *Log) Records(direction string) ([]Record, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	records := make([]Record, 0)
+	for index := l.backups; index >= 1; index-- {
+		var err error
+		if records, err = readRecords(l.backupPath(index), direction, records); err != nil {
+			return nil, fmt.Errorf("Could not read audit log %s. %w", l.backupPath(index), err)
+		}
+	}
+
+	records, err := readRecords(l.path, direction, records)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read audit log %s. %w", l.path, err)
+	}
+	return records, nil
+}
@@ -0,0 +1,69 @@
+package audit_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/client/audit"
+)
+
+func TestRecordsSurviveRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "transfers.log")
+	log := audit.CreateLog(path, 300, 2)
+
+	started := time.Unix(1700000000, 0).UTC()
+	for i := 0; i < 6; i++ {
+		direction := audit.Upload
+		if i%2 == 1 {
+			direction = audit.Download
+		}
+		record := audit.Record{
+			Time:      started.Add(time.Duration(i) * time.Second),
+			Direction: direction,
+			Peer:      "127.0.0.1:4000",
+			User:      "bob",
+			File:      "/path/to/file",
+			Bytes:     int64(i),
+			Duration:  time.Millisecond,
+			Result:    audit.ResultOK,
+		}
+		if err := log.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected the log to be rotated: %v", err)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected at most 2 rotated files, got error %v", err)
+	}
+
+	uploads, err := log.Records(audit.Upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads) == 0 {
+		t.Fatal("expected some uploads")
+	}
+	for i, record := range uploads {
+		if record.Direction != audit.Upload {
+			t.Errorf("got direction %s, want %s", record.Direction, audit.Upload)
+		}
+		if i > 0 && !uploads[i-1].Time.Before(record.Time) {
+			t.Errorf("records are not ordered from the oldest to the newest: %v", uploads)
+		}
+	}
+	if last := uploads[len(uploads)-1]; last.Bytes != 4 {
+		t.Errorf("got %d bytes in the newest upload, want 4", last.Bytes)
+	}
+}
@@ -2,200 +2,503 @@ package client
 
 import (
 	"bufio"
+	"crypto/ed25519"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/imaikeru/peer-to-peer/client/audit"
+	"github.com/imaikeru/peer-to-peer/client/compression"
+	"github.com/imaikeru/peer-to-peer/client/content"
+	"github.com/imaikeru/peer-to-peer/client/delta"
+	"github.com/imaikeru/peer-to-peer/client/dht"
+	"github.com/imaikeru/peer-to-peer/client/directory"
 	"github.com/imaikeru/peer-to-peer/client/validator"
+	"github.com/imaikeru/peer-to-peer/shared/logging"
 )
 
 const (
-	userIndex             = 1
-	pathToFileOnUserIndex = 2
-	pathToSaveIndex       = 3
+	userIndex = 1
+
+	healthRequest  = "health"
+	healthResponse = "healthy"
 
 	commandsList = "Wrong command, choose between:\n" + "list-files\n" +
 		"download user \"path to file on user\" \"path to save\"\n" +
-		"register user \"file1\" \"file2\" \"file3\" …. \"fileN\"\n" +
-		"unregister user \"file1\" \"file2\" \"file3\" …. \"fileN\"\n"
+		"download \"p2p:link\" \"path to save\"\n" +
+		"download \"path to .torrent\" \"path to save\"\n" +
+		"torrent \"path to registered file\" \"path to save .torrent\"\n" +
+		"link \"path to registered file\"\n" +
+		"register user [public|group:name|users:first,second] \"file1\" \"file2\" \"file3\" …. \"fileN\"\n" +
+		"unregister user \"file1\" \"file2\" \"file3\" …. \"fileN\"\n" +
+		"rename newuser\n" +
+		"alias otheruser\n" +
+		"unalias otheruser\n" +
+		"search \"part of file path\"\n" +
+		"group-add group user\n" +
+		"group-remove group user\n" +
+		"list-groups\n" +
+		"history uploads\n" +
+		"history downloads\n"
 )
 
-func (c *Client) getAddressToDownloadFrom(username string) (string, error) {
-	c.fileMutex.Lock()
-	defer c.fileMutex.Unlock()
-	file, err := os.OpenFile(c.usersAndAddressesFileName, os.O_RDWR, 0777)
-	if err != nil {
-		log.Println("Error while opening file for reading.")
-		return "", err
+func (c *Client) warnIfUnreachable(username string) {
+	if peer, err := c.peers.Lookup(username); err == nil && peer.Reachability == directory.Unreachable {
+		fmt.Printf("Warning: the server could not reach the mini server of %s, the download will probably fail.\n", username)
 	}
+}
 
-	scanner := bufio.NewScanner(file)
+func (c *Client) miniServerHandleDownloadRequest(conn net.Conn) {
+	logger := c.logger.With("component", "miniserver", "peer", conn.RemoteAddr().String(), "transfer", c.nextTransferID())
+	logger.Debug("Accepted connection")
+	c.metrics.miniServerConnections.Inc()
 
-	for scanner.Scan() {
-		text := scanner.Text()
-		if strings.Contains(text, username) {
-			address := strings.Split(text, "-")[1]
-			return address, nil
-		}
+	messageReader := bufio.NewReader(conn)
+	fileToDownloadMessage, err := messageReader.ReadString('\n')
+	if err == nil && strings.HasPrefix(fileToDownloadMessage, pushJoinPrefix) {
+		c.acceptPush(conn, messageReader, fileToDownloadMessage)
+		return
 	}
+	defer conn.Close()
 
-	file.Close()
+	var options transferOptions
+	for err == nil {
+		if exchange, isExchange := parsePexMessage(strings.TrimSpace(fileToDownloadMessage)); isExchange {
+			c.answerPeerExchange(conn, logger, exchange)
+		} else if encodings, isOffer := parseAcceptEncoding(strings.TrimSpace(fileToDownloadMessage)); isOffer {
+			options.encodings = encodings
+		} else if strings.TrimSpace(fileToDownloadMessage) == signatureLine {
+			if options.signature, err = delta.ReadSignature(messageReader); err != nil {
+				break
+			}
+		} else {
+			break
+		}
+		fileToDownloadMessage, err = messageReader.ReadString('\n')
+	}
 
-	return "", fmt.Errorf("There is no record containing this username and its address")
+	if err != nil {
+		logger.Warn("Error when reading request from connection", "error", err)
+	} else if strings.TrimSpace(fileToDownloadMessage) == healthRequest {
+		if _, writeErr := conn.Write([]byte(healthResponse + "\n")); writeErr != nil {
+			logger.Warn("Error when answering health request", "error", writeErr)
+		}
+	} else if contentID, isContentRequest := parseContentRequest(strings.TrimSpace(fileToDownloadMessage)); isContentRequest {
+		c.servePublicContent(conn, logger, contentID, options)
+	} else {
+		encodedTicket, fileToDownload, hasTicket := parseDownloadRequest(strings.TrimSpace(fileToDownloadMessage))
+		record := audit.Record{
+			Time:      time.Now(),
+			Direction: audit.Upload,
+			Peer:      conn.RemoteAddr().String(),
+			User:      unknownUser,
+			File:      fileToDownload,
+		}
+		if !hasTicket {
+			logger.Warn("Refused download without a ticket", "file", logging.Path(fileToDownload))
+			record.Result = "refused: no ticket"
+		} else if verified, ticketErr := c.authorize(encodedTicket, fileToDownload); ticketErr != nil {
+			logger.Warn("Refused download with an invalid ticket", "file", logging.Path(fileToDownload), "error", ticketErr)
+			record.Result = "refused: " + ticketErr.Error()
+		} else {
+			record.User = verified.Requester
+			c.sendFile(conn, logger.With("requester", verified.Requester, "owner", verified.Owner), fileToDownload, options, &record)
+		}
+		record.Duration = time.Since(record.Time)
+		c.recordTransfer(record)
+	}
 }
 
-func (c *Client) miniServerHandleDownloadRequest(conn net.Conn) {
-	log.Println("Accepted download request from: ", conn.RemoteAddr().String())
-
-	defer conn.Close()
-	messageReader := bufio.NewReader(conn)
+// sendFile is a function that sends the file at "fileToDownload" over "conn", compressed with one of the offered encodings
+// if compressing it can make it smaller, and fills in the size, the encoding and the result of the transfer in "record".
+// If the downloader has an old copy of the file, only the delta between the old copy and the file is sent.
+func (c *Client) sendFile(conn net.Conn, logger *logging.Logger, fileToDownload string, options transferOptions, record *audit.Record) {
+	fileToSend, fileErr := os.Open(fileToDownload)
+	if fileErr != nil {
+		logger.Warn("Could not open requested file for reading", "file", logging.Path(fileToDownload), "error", fileErr)
+		record.Result = "failed: could not open the file"
+		return
+	}
+	defer fileToSend.Close()
+
+	logger.Info("Sending file", "file", logging.Path(fileToDownload))
+	c.metrics.activeUploads.Inc()
+	defer c.metrics.activeUploads.Dec()
+
+	fileReader := bufio.NewReaderSize(fileToSend, 4096)
+	uploaded := &countingWriter{writer: conn, counter: c.metrics.bytesUploaded}
+	encoding := chooseEncoding(fileToDownload, fileReader, options.encodings)
+	encoded, encodeErr := encodeTo(conn, uploaded, encoding)
+	if encodeErr != nil {
+		logger.Error("Error sending file", "file", logging.Path(fileToDownload), "error", encodeErr)
+		record.Result = "failed: " + encodeErr.Error()
+		return
+	}
 
-	if fileToDownloadMessage, err := messageReader.ReadString('\n'); err != nil {
-		log.Println("Error when reading message from connection.")
+	read := &countingReader{reader: fileReader, counter: c.metrics.contentUploaded}
+	var copyErr error
+	if options.signature != nil {
+		copyErr = delta.Diff(options.signature, read, encoded)
 	} else {
-		if fileToSend, fileErr := os.Open(fileToDownloadMessage); fileErr != nil {
-			log.Printf("Could not open file %s for reading", fileToDownloadMessage)
-		} else {
-			buf := make([]byte, 4096)
-			rw := bufio.NewReadWriter(bufio.NewReaderSize(fileToSend, 4096), bufio.NewWriterSize(conn, 4096))
-			for {
+		_, copyErr = io.Copy(encoded, read)
+	}
+	if closeErr := encoded.Close(); copyErr == nil {
+		copyErr = closeErr
+	}
+	record.Bytes, record.Encoding, record.Transferred, record.Delta = read.read, encoding, uploaded.written, options.signature != nil
+	if copyErr != nil {
+		logger.Error("Error sending file", "file", logging.Path(fileToDownload), "bytes", read.read, "error", copyErr)
+		record.Result = "failed: " + copyErr.Error()
+		return
+	}
 
-				if bytesRead, readingErr := rw.Read(buf); readingErr != nil {
-					if readingErr != io.EOF {
-						log.Printf("Error reading file %s.", fileToDownloadMessage)
-					}
-					break
-				} else {
-					rw.Write(buf[0:bytesRead])
-					rw.Flush()
-				}
-			}
-			fileToSend.Close()
-		}
+	logger.Info("Sent file", "file", logging.Path(fileToDownload), "bytes", read.read, "encoding", encoding, "delta", record.Delta, "transferred", uploaded.written)
+	record.Result = audit.ResultOK
+}
+
+// downloadFile is a function that sends "request" to the mini server at "address" and saves what it sends to "pathToSave".
+// If "contentID" is not empty, the peers first exchange which other peers hold the content.
+func (c *Client) downloadFile(address *string, owner, request, contentID, pathToFileOnUser, pathToSave string) bool {
+	c.metrics.activeDownloads.Inc()
+	defer c.metrics.activeDownloads.Dec()
+
+	record := audit.Record{
+		Time:      time.Now(),
+		Direction: audit.Download,
+		Peer:      strings.TrimSpace(*address),
+		User:      owner,
+		File:      pathToFileOnUser,
+	}
+	c.receiveFile(&record, request, contentID, pathToSave)
+	if record.Result != audit.ResultOK {
+		c.metrics.failedDownloads.Inc()
 	}
+	record.Duration = time.Since(record.Time)
+	c.recordTransfer(record)
+
+	return record.Result == audit.ResultOK
 }
 
-func (c *Client) downloadFile(address *string, pathToFileOnUser, pathToSave string) {
-	fmt.Println("Address is " + *address)
-	split := strings.SplitN(*address, ":", 2)
-	downloadConnection, connectToMiniserverErr := net.Dial("tcp", split[0]+":"+split[1])
+// receiveFile is a function that downloads the file described by "record" from the mini server at "record.Peer" to "pathToSave",
+// offering every supported encoding to the mini server, and fills in the size, the encoding and the result of the transfer in "record".
+// If there is an old copy at "pathToSave", only the delta between it and the file is downloaded.
+func (c *Client) receiveFile(record *audit.Record, request, contentID, pathToSave string) {
+	logger := c.logger.With("component", "download", "peer", record.Peer, "transfer", c.nextTransferID())
+	logger.Info("Downloading file", "file", logging.Path(record.File), "destination", logging.Path(pathToSave))
+
+	signature, signErr := signOldCopy(pathToSave)
+	if signErr != nil {
+		logger.Warn("Downloading the whole file, since the old copy cannot be read", "destination", logging.Path(pathToSave), "error", signErr)
+	}
+
+	downloadConnection, responseReader, connectToMiniserverErr := c.connectToMiniServer(logger, record.Peer)
 	if connectToMiniserverErr != nil {
-		log.Printf("Failed to connect to miniserver with address: %s", *address)
-		log.Printf(connectToMiniserverErr.Error())
+		logger.Error("Failed to connect to miniserver", "error", connectToMiniserverErr)
+		record.Result = "failed: " + connectToMiniserverErr.Error()
+		return
+	}
+	defer downloadConnection.Close()
+
+	if contentID != "" {
+		if err := c.exchangePeers(downloadConnection, responseReader, contentID, record.Peer); err != nil {
+			logger.Debug("Peer exchange failed", "error", err)
+		}
+	}
+
+	requestWriter := bufio.NewWriter(downloadConnection)
+	requestWriter.WriteString(acceptEncodingPrefix + strings.Join(compression.Supported, " ") + "\n")
+	if signature != nil {
+		requestWriter.WriteString(signatureLine + "\n")
+		signature.WriteTo(requestWriter)
+	}
+	requestWriter.WriteString(request)
+	requestWriter.Flush()
+
+	encoding, encodingErr := readContentEncoding(responseReader)
+	if encodingErr != nil {
+		logger.Error("Error reading file", "file", logging.Path(record.File), "error", encodingErr)
+		record.Result = "failed: " + encodingErr.Error()
+		return
+	}
+	transferred := &countingReader{reader: responseReader, counter: c.metrics.bytesDownloaded}
+	decoded, decodeErr := compression.NewReader(encoding, transferred)
+	if decodeErr != nil {
+		logger.Error("Error reading file", "file", logging.Path(record.File), "encoding", encoding, "error", decodeErr)
+		record.Result = "failed: " + decodeErr.Error()
+		return
+	}
+	defer decoded.Close()
+
+	var received int64
+	var saveErr error
+	if signature != nil {
+		var stats delta.Stats
+		received, stats, saveErr = c.patchOldCopy(decoded, pathToSave)
+		logger.Debug("Patched old copy", "destination", logging.Path(pathToSave), "reused", stats.Copied, "downloaded", stats.Literal)
 	} else {
+		received, saveErr = c.saveFile(decoded, pathToSave)
+	}
+	record.Bytes, record.Encoding, record.Transferred, record.Delta = received, encoding, transferred.read, signature != nil
+	if saveErr != nil {
+		logger.Error("Error reading file", "file", logging.Path(record.File), "bytes", received, "error", saveErr)
+		record.Result = "failed: " + saveErr.Error()
+		return
+	}
 
-		requestWriter := bufio.NewWriter(downloadConnection)
-		requestWriter.WriteString(pathToFileOnUser + "\n")
-		requestWriter.Flush()
+	logger.Info("Downloaded file", "file", logging.Path(record.File), "bytes", received, "encoding", encoding, "delta", record.Delta, "transferred", transferred.read)
+	record.Result = audit.ResultOK
+}
 
-		newFile, createFileError := os.Create(pathToSave)
-		if createFileError != nil {
-			log.Printf("Could not create file with name %s", pathToSave)
-		} else {
-			fileReadWriter := bufio.NewReadWriter(bufio.NewReader(downloadConnection), bufio.NewWriter(newFile))
-			for {
-				buf := make([]byte, 4096)
-				for {
-					if bytesRead, readingErr := fileReadWriter.Read(buf); readingErr != nil {
-						if readingErr != io.EOF {
-							log.Printf("Error reading file %s.", pathToFileOnUser)
-						}
-						break
-					} else {
-						fileReadWriter.Write(buf[0:bytesRead])
-						fileReadWriter.Flush()
-					}
-				}
+// saveFile is a function that saves what is read from "r" to a new file at "path" and returns how many bytes were saved
+//    (***) Returns error if the file cannot be created or "r" cannot be read
+func (c *Client) saveFile(r io.Reader, path string) (int64, error) {
+	newFile, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("Could not create the file. %w", err)
+	}
+	defer newFile.Close()
 
-			}
-		}
-		newFile.Close()
+	fileWriter := bufio.NewWriter(newFile)
+	downloaded := &countingWriter{writer: fileWriter, counter: c.metrics.contentDownloaded}
+	if _, err := io.Copy(downloaded, r); err != nil {
+		return downloaded.written, err
 	}
+	return downloaded.written, fileWriter.Flush()
 }
 
-func (c *Client) getUsersInformationFromServerPeriodically(conn net.Conn) {
-	serverWriter := bufio.NewWriter(conn)
+// connectToMiniServer is a function that connects to the mini server at "address".
+// If it cannot be connected to, the holder is asked to connect to the mini server of the client and push the file
+// and if that fails as well, the central server is asked to relay the transfer.
+//    (***) Returns error if neither of these works
+func (c *Client) connectToMiniServer(logger *logging.Logger, address string) (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err == nil {
+		return conn, bufio.NewReader(conn), nil
+	}
+
+	logger.Info("Could not connect to miniserver, asking the holder to push", "error", err)
+	conn, reader, err := c.dialThroughPush(address)
+	if err == nil {
+		c.metrics.pushedDownloads.Inc()
+		return conn, reader, nil
+	}
 
-	for {
-		serverWriter.Flush()
-		_, err := serverWriter.WriteString("list-users" + "\n")
-		serverWriter.Flush()
+	logger.Info("Holder could not push, asking the server to relay", "error", err)
+	if conn, err = c.dialThroughRelay(address); err != nil {
+		return nil, nil, err
+	}
+	c.metrics.relayedDownloads.Inc()
+	return conn, bufio.NewReader(conn), nil
+}
 
-		if err != nil {
-			log.Printf("Error occurred while trying to write to server, %s", err.Error())
+func (c *Client) sendToServer(message string) error {
+	c.serverWriterMutex.Lock()
+	defer c.serverWriterMutex.Unlock()
+
+	if c.serverWriter == nil {
+		return errNotConnected
+	}
+	if _, err := c.serverWriter.WriteString(message); err != nil {
+		return err
+	}
+	return c.serverWriter.Flush()
+}
+
+func (c *Client) getUsersInformationFromServerPeriodically() {
+	for {
+		if err := c.sendToServer("list-users" + "\n"); err != nil {
+			c.logger.Error("Error occurred while trying to write to server", "component", "tracker", "error", err)
 		}
 		time.Sleep(30 * time.Second)
 	}
 }
 
 func (c *Client) updateUsersAndAddresses(newData string) {
-	data := strings.SplitN(newData, ":", 2)
-	newInfo := ""
-	if len(data) == 2 {
-		newInfo = data[1]
-		newInfo = strings.ReplaceAll(newInfo, ";", "\n")
+	peers, err := directory.ParseListUsers(newData)
+	if err != nil {
+		c.logger.Warn("Could not parse users data", "component", "tracker", "error", err)
+		return
 	}
 
-	c.fileMutex.Lock()
-	defer c.fileMutex.Unlock()
+	c.peers.Replace(peers)
 
-	if file, err := os.Create(c.usersAndAddressesFileName); err != nil {
-		log.Printf("Error when attempting to open %s to update users data.", c.usersAndAddressesFileName)
-	} else {
-		writer := bufio.NewWriter(file)
-		if _, writingError := writer.WriteString(newInfo); writingError != nil {
-			log.Printf("%s", writingError.Error())
+	if c.peersCachePath != "" {
+		if err := c.peers.SaveTo(c.peersCachePath); err != nil {
+			c.logger.Error("Error when saving users data", "file", logging.Path(c.peersCachePath), "error", err)
 		}
-		writer.Flush()
-		file.Close()
 	}
 }
 
 func (c *Client) operateMiniServer(miniServer net.Listener) {
 	for {
 		if conn, err := miniServer.Accept(); err != nil {
-			log.Println("Error accepting connection.")
+			c.logger.Error("Error accepting connection", "component", "miniserver", "error", err)
 		} else {
 			go c.miniServerHandleDownloadRequest(conn)
 		}
 	}
 }
 
+// miniServerHosts is a function that returns the host the mini server listens on and the host it is announced at,
+// empty if it is announced at the address it listens on.
+// Peers on other machines can reach it only if the central server is on another machine as well,
+// in which case its address is the one the central server is connected to.
+// Without the central server the mini server listens where the DHT node does, or on every interface if the DHT node does,
+// and is announced at the first address of the machine that peers on other machines can reach.
+func (c *Client) miniServerHosts(server net.Conn) (string, string) {
+	if server == nil && c.dht != nil {
+		host, _, _ := net.SplitHostPort(c.dht.Address())
+		if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+			return host, ""
+		}
+		return "", routableHost()
+	}
+	if server == nil || server.RemoteAddr().(*net.TCPAddr).IP.IsLoopback() {
+		return "localhost", ""
+	}
+	return "", server.LocalAddr().(*net.TCPAddr).IP.String()
+}
+
+// routableHost is a function that returns the first address of the machine that is neither a loopback nor a link-local one,
+// an IPv4 one if there is such, or "localhost" if there is none
+func routableHost() string {
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return "localhost"
+	}
+
+	var routable []net.IP
+	for _, address := range addresses {
+		if ipNet, ok := address.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+			if ipNet.IP.To4() != nil {
+				return ipNet.IP.String()
+			}
+			routable = append(routable, ipNet.IP)
+		}
+	}
+	if len(routable) == 0 {
+		return "localhost"
+	}
+	return routable[0].String()
+}
+
 // Client is a struct that contains:
-//    - usersAndAddressesFileName - path to file which will contain the information about other users and their addresses that are connected to the main server
-//    - fileMutex                 - a Mutex that is used for working with "usersAndAddressesFileName"
-//    - centralServerport         - the port of the central server, to which the client connects
+//    - peersCachePath            - path to a JSON file where the information about other users and their addresses is cached, empty if it is not cached
+//    - peers                     - the other users that are connected to the main server and the addresses of their mini servers
+//    - trackers                  - the addresses of the central servers of a cluster, which the client connects to in order until one accepts it
+//    - preferredTracker          - the address of the primary a standby pointed to, tried first on the next connection
 //    - validator                 - used for validating the user commands
+//    - serverWriter              - a buffered writer over the connection to the central server, nil while not connected
+//    - serverWriterMutex         - a Mutex that is used for writing safely to "serverWriter" and "tracker"
+//    - tracker                   - the host of the central server the client is connected to, which relays transfers
+//    - metrics                   - the metrics the client exposes
+//    - logger                    - the structured logger of the client
+//    - lastTransferID            - the identifier of the last transfer, used for telling transfers apart in the logs
+//    - device                    - the name of this device, which tells it apart from other devices of the same user
+//    - pendingDownloads          - a map whose keys are quoted paths of files located by the central server and values are paths to save them to
+//    - pendingDownloadsMutex     - a Mutex that is used for working safely with "pendingDownloads"
+//    - miniServerAddress         - the address of the mini server, which download tickets have to name
+//    - ticketKey                 - the public key of the central server, which download tickets have to be signed with
+//    - ticketKeyMutex            - a Mutex that is used for working safely with "ticketKey"
+//    - auditLog                  - the log of the files sent to and received from other peers, nil if transfers are not audited
+//    - links                     - a map whose keys are paths of files registered by the user and values are their "p2p:" links
+//    - linksMutex                - a Mutex that is used for working safely with "links"
+//    - announceURL               - the tracker URL written to exported ".torrent" metainfo files
+//    - dht                       - the node of the distributed hash table, nil if the client uses only the central server
+//    - publicContent             - a map whose keys are content IDs of files shared with everyone and values are their paths
+//    - pendingContent            - a map whose keys are paths of files reported to the central server and values are the links waiting for it to confirm them
+//    - replay                    - what the central server confirmed about the client, which is sent again to the central server the client fails over to
+//    - replayMutex               - a Mutex that is used for working safely with "replay"
+//    - answers                   - a map whose keys are relay and push requests sent to the central server and values are the downloads waiting for their answers
+//    - answersMutex              - a Mutex that is used for working safely with "answers"
+//    - pushes                    - a map whose keys are tokens of pushes the client asked for and values are the downloads waiting for the holders to connect
+//    - pushesMutex               - a Mutex that is used for working safely with "pushes"
 type Client struct {
-	fileMutex                 sync.Mutex
-	usersAndAddressesFileName string
-	centralServerPort         string
-	validator                 *validator.Validator
+	peersCachePath        string
+	peers                 *directory.Directory
+	trackers              []string
+	preferredTracker      string
+	validator             *validator.Validator
+	serverWriter          *bufio.Writer
+	serverWriterMutex     sync.Mutex
+	tracker               string
+	metrics               *clientMetrics
+	logger                *logging.Logger
+	lastTransferID        uint64
+	device                string
+	pendingDownloads      map[string][]string
+	pendingDownloadsMutex sync.Mutex
+	miniServerAddress     string
+	ticketKey             ed25519.PublicKey
+	ticketKeyMutex        sync.RWMutex
+	auditLog              *audit.Log
+	links                 map[string]content.Link
+	linksMutex            sync.Mutex
+	announceURL           string
+	dht                   *dht.Node
+	publicContent         map[string]string
+	pendingContent        map[string]registeredContent
+	replay                replayState
+	replayMutex           sync.Mutex
+	answers               map[string][]chan trackerAnswer
+	answersMutex          sync.Mutex
+	pushes                map[string]chan pushedConnection
+	pushesMutex           sync.Mutex
+}
+
+func (c *Client) nextTransferID() uint64 {
+	return atomic.AddUint64(&c.lastTransferID, 1)
 }
 
 // CreateNewClient is a factory function that:
 //   - accepts:
-//        - usersAndAddressesFileName - path to file which will contain the information about other users and their addresses that are connected to the main server
-//        - centralServerPort         - the port of the central server, to which the client will connect
+//        - peersCachePath            - path to a JSON file where the information about other users and their addresses is cached, empty disables the cache
+//        - trackers                  - the addresses of the central servers, tried in order, several if the servers are a primary and standbys
+//        - logger                    - the structured logger of the client
+//        - device                    - the name of this device, empty if the user uses a single device
+//        - auditLog                  - the log of the files sent to and received from other peers, nil disables it
+//        - announceURL               - the tracker URL written to exported ".torrent" metainfo files
+//        - dhtNode                   - the node of the distributed hash table, nil disables it
 //   - creates and returns:
 //        - a pointer to Client struct
-func CreateNewClient(usersAndAddressesFileName, centralServerPort string) *Client {
+func CreateNewClient(peersCachePath string, trackers []string, logger *logging.Logger, device string, auditLog *audit.Log, announceURL string, dhtNode *dht.Node) *Client {
+	peers := directory.CreateDirectory()
+	if peersCachePath != "" {
+		if err := peers.LoadFrom(peersCachePath); err != nil {
+			logger.Debug("Starting without cached peers", "file", logging.Path(peersCachePath), "error", err)
+		}
+	}
+
 	return &Client{
-		usersAndAddressesFileName: usersAndAddressesFileName,
-		centralServerPort:         centralServerPort,
-		validator:                 validator.CreateValidator(),
+		peersCachePath:   peersCachePath,
+		peers:            peers,
+		trackers:         trackers,
+		validator:        validator.CreateValidator(),
+		metrics:          createClientMetrics(),
+		logger:           logger,
+		device:           device,
+		pendingDownloads: make(map[string][]string),
+		auditLog:         auditLog,
+		links:            make(map[string]content.Link),
+		announceURL:      announceURL,
+		dht:              dhtNode,
+		publicContent:    make(map[string]string),
+		pendingContent:   make(map[string]registeredContent),
+		replay:           createReplayState(),
+		answers:          make(map[string][]chan trackerAnswer),
+		pushes:           make(map[string]chan pushedConnection),
 	}
 }
 
 func (c *Client) parseListFiles(response string) *string {
 	splitResponse := strings.SplitN(response, ":", 2)
 	data := splitResponse[1]
-	data = strings.Trim(data, ";")
+	data = strings.Trim(strings.TrimSpace(data), ";")
 	data = strings.ReplaceAll(data, ";", "\n")
 	return &data
 }
@@ -204,84 +507,144 @@ func (c *Client) parseListFiles(response string) *string {
 //   1. Connects the client to the central server and communicates back and forth with it.
 //   2. Creates a mini server, starts it and registers its address in the central server.
 //   3. Periodically pings the central server for user credentials.
+//   4. Answers the heartbeat pings of the central server, so that its lease does not expire.
+//   When the client knows several central servers and loses the connection, it fails over to the next one that accepts it.
+//   When the client has a DHT node, it keeps running without the central server, finding peers on the DHT.
 //   (***) Returns error if:
-//       - cannot connect to central server
+//       - cannot connect to central server and there is no DHT node
 //       - cannot create miniserver
 //       - cannot read from server
 func (c *Client) Start() error {
-	server, err := net.Dial("tcp", ":13337")
-	if err != nil {
+	server, err := c.connectToTracker()
+	if err != nil && c.dht == nil {
 		return fmt.Errorf("Failed to connect to server. %w", err)
+	} else if err != nil {
+		c.logger.Warn("Central server is unavailable, finding peers only on the DHT", "component", "tracker", "error", err)
+	} else {
+		c.useServer(server)
+		c.logger.Info("Connected to server", "component", "tracker", "server", server.RemoteAddr().String())
 	}
-	consoleToServerRw := bufio.NewReadWriter(bufio.NewReaderSize(os.Stdin, 4096), bufio.NewWriterSize(server, 4096))
-
-	fmt.Println("Server address " + server.RemoteAddr().String())
+	consoleReader := bufio.NewReaderSize(os.Stdin, 4096)
 
-	miniServer, errServerCreated := net.Listen("tcp", "localhost:0")
+	listenHost, announcedHost := c.miniServerHosts(server)
+	miniServer, errServerCreated := net.Listen("tcp", net.JoinHostPort(listenHost, "0"))
 	if errServerCreated != nil {
 		return fmt.Errorf("Could not initialize MiniServer. %w", errServerCreated)
 	}
 
-	fmt.Println(miniServer.Addr().String())
+	c.miniServerAddress = miniServer.Addr().String()
+	if announcedHost != "" {
+		_, port, _ := net.SplitHostPort(c.miniServerAddress)
+		c.miniServerAddress = net.JoinHostPort(announcedHost, port)
+	}
 	go c.operateMiniServer(miniServer)
 
-	miniServerAddress := miniServer.Addr().String()
-	log.Printf("MiniServer started. Listening on: %s", miniServerAddress)
-	consoleToServerRw.Flush()
-	consoleToServerRw.WriteString("register-miniserver " + miniServerAddress + "\n")
-	consoleToServerRw.Flush()
+	c.logger.Info("MiniServer started", "component", "miniserver", "address", c.miniServerAddress)
+	c.registerWithServer()
 
-	go c.getUsersInformationFromServerPeriodically(server)
+	if server != nil {
+		go c.getUsersInformationFromServerPeriodically()
+	}
+	if c.dht != nil {
+		go c.republishPeriodically()
+	}
 
 	go func() {
 		for {
-			consoleToServerRw.Flush()
-			if request, err := consoleToServerRw.ReadString('\n'); err != nil {
-				log.Println("Failed to read from stdin.")
+			if request, err := consoleReader.ReadString('\n'); err != nil {
+				c.logger.Warn("Failed to read from stdin", "error", err)
 				break
 			} else {
 				if !c.validator.Validate(strings.ReplaceAll(request, "\n", "")) {
-					log.Printf(commandsList)
+					fmt.Print(commandsList)
 				} else {
-					if strings.Contains(request, "download") {
-						splitRequest := strings.Fields(request)
-						username := splitRequest[userIndex]
-						pathToFileOnUser := splitRequest[pathToFileOnUserIndex]
-						pathToSave := splitRequest[pathToSaveIndex]
-						addressToDownloadFrom, userErr := c.getAddressToDownloadFrom(username)
-						if userErr != nil {
-							log.Printf("The user %s is not an active one. %s", username, userErr.Error())
-						} else {
-							go c.downloadFile(&addressToDownloadFrom, pathToFileOnUser, pathToSave)
-						}
+					if strings.HasPrefix(strings.TrimSpace(request), historyCommand) {
+						c.printHistory(request)
+					} else if strings.HasPrefix(strings.TrimSpace(request), torrentCommand) {
+						c.exportTorrent(request)
+					} else if strings.HasPrefix(strings.TrimSpace(request), linkCommand) {
+						c.printLink(request)
+					} else if strings.HasPrefix(strings.TrimSpace(request), "download") {
+						c.handleDownloadRequest(request)
 					} else {
-						consoleToServerRw.Flush()
-						if _, err2 := consoleToServerRw.WriteString(request); err2 != nil {
-							log.Println(err2)
+						err2 := c.sendToServer(request)
+						if err2 != nil {
+							c.logger.Error("Error occurred while trying to write to server", "component", "tracker", "error", err2)
+						}
+						if (err2 == nil || c.dht != nil) && strings.HasPrefix(strings.TrimSpace(request), "register") {
+							go c.registerContent(request)
+						} else if strings.HasPrefix(strings.TrimSpace(request), "unregister") {
+							c.forgetContent(request)
+							c.forgetForFailover(request)
 						}
-						consoleToServerRw.Flush()
 					}
 				}
 			}
 		}
 	}()
 
+	if server == nil {
+		select {}
+	}
+
 	serverReader := bufio.NewReader(server)
 	for {
 		response, err := serverReader.ReadString('\n')
+		if err != nil && c.canFailOver() {
+			c.logger.Warn("Disconnected from server, failing over", "component", "tracker", "error", err)
+			if server = c.failOver(); server != nil {
+				serverReader = bufio.NewReader(server)
+				continue
+			}
+			err = fmt.Errorf("No central server accepted the connection. %w", err)
+		}
+		if err != nil && c.dht != nil {
+			c.logger.Warn("Disconnected from server, finding peers only on the DHT", "component", "tracker", "error", err)
+			c.useServer(nil)
+			select {}
+		}
 		if err != nil {
 			if err != io.EOF {
 				return fmt.Errorf("Failed to read from server. %w", err)
 			}
-			log.Println("Disconnected from server.")
+			c.logger.Info("Disconnected from server", "component", "tracker")
 			return nil
 		}
-		if strings.Contains(response, "list-users:") {
+		if strings.TrimSpace(response) == "ping" {
+			if pongErr := c.sendToServer("pong" + "\n"); pongErr != nil {
+				c.logger.Error("Error occurred while answering heartbeat", "component", "tracker", "error", pongErr)
+			}
+		} else if strings.TrimSpace(response) == "pong" {
+			continue
+		} else if strings.HasPrefix(response, contentRegisteredPrefix) {
+			c.handleContentRegistered(response)
+		} else if strings.HasPrefix(response, locatedContentPrefix) {
+			c.handleLocatedContent(response)
+		} else if strings.HasPrefix(response, notLocatedContentPrefix) {
+			c.handleNotLocatedContent(response)
+		} else if strings.HasPrefix(response, locatedPrefix) {
+			c.handleLocated(response)
+		} else if strings.HasPrefix(response, notLocatedPrefix) {
+			c.handleNotLocated(response)
+		} else if strings.HasPrefix(response, relayRequestPrefix) {
+			go c.joinRelay(response)
+		} else if strings.HasPrefix(response, relayReadyPrefix) || strings.HasPrefix(response, relayRefusedPrefix) {
+			c.handleRelayAnswer(response)
+		} else if strings.HasPrefix(response, pushRequestPrefix) {
+			go c.pushTo(response)
+		} else if strings.HasPrefix(response, pushReadyPrefix) || strings.HasPrefix(response, pushRefusedPrefix) {
+			c.handlePushAnswer(response)
+		} else if strings.HasPrefix(response, standbyPrefix) {
+			c.handleStandby(response)
+		} else if strings.HasPrefix(response, ticketKeyPrefix) {
+			c.handleTicketKey(response)
+		} else if strings.Contains(response, "list-users:") {
 			go c.updateUsersAndAddresses(response)
-		} else if strings.Contains(response, "list-files:") {
-			log.Printf("\n" + *c.parseListFiles(response))
+		} else if strings.HasPrefix(response, "list-files:") || strings.HasPrefix(response, "search:") || strings.HasPrefix(response, "list-groups:") {
+			fmt.Println(*c.parseListFiles(response))
 		} else {
-			log.Printf("From server: %s", response)
+			c.followIdentityChange(response)
+			fmt.Print("From server: " + response)
 		}
 
 	}
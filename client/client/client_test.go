@@ -0,0 +1,44 @@
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/client/dht"
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+func TestMiniServerHostsWithoutTheCentralServer(t *testing.T) {
+	var tests = []struct {
+		name              string
+		dhtAddress        string
+		expectedListen    string
+		expectedAnnounced string
+	}{
+		{"DHT node on a single address", "127.0.0.1:0", "127.0.0.1", ""},
+		{"DHT node on every interface", ":0", "", routableHost()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := dht.CreateNode(tt.dhtAddress, time.Second, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer node.Close()
+			c := CreateNewClient("", nil, logging.CreateDiscardLogger(), "", nil, "", node)
+
+			if listen, announced := c.miniServerHosts(nil); listen != tt.expectedListen || announced != tt.expectedAnnounced {
+				t.Errorf("got %q and %q, want the mini server to listen on %q and be announced at %q", listen, announced, tt.expectedListen, tt.expectedAnnounced)
+			}
+		})
+	}
+}
+
+func TestRoutableHost(t *testing.T) {
+	host := routableHost()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()) {
+		t.Errorf("expected an address other machines can reach, got %q", host)
+	}
+}
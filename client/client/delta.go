@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/imaikeru/peer-to-peer/client/delta"
+)
+
+// signatureLine is sent by a downloader that has an old copy of the file, followed by the Signature of the old copy
+const signatureLine = "signature"
+
+// transferOptions is a struct that contains:
+//    - encodings - the encodings the downloader offered, nil if it did not negotiate compression
+//    - signature - the Signature of the old copy of the downloader, nil if it does not have one
+type transferOptions struct {
+	encodings []string
+	signature *delta.Signature
+}
+
+// signOldCopy is a function that returns the Signature of the file at "path", which is updated by a download.
+// It returns nil if there is no such file, in which case the whole file is downloaded.
+//    (***) Returns error if the file cannot be read
+func signOldCopy(path string) (*delta.Signature, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open old copy. %w", err)
+	}
+	defer file.Close()
+
+	return delta.Sign(bufio.NewReaderSize(file, delta.MaxBlockSize), info.Size())
+}
+
+// patchOldCopy is a function that builds the new version of the file at "path" from the delta, which is read from "r",
+// and replaces the file with it once it is complete, so that a failed download leaves the old copy as it was.
+// It returns how many bytes the new version has and how many of them were copied from the old copy.
+//    (***) Returns error if the delta cannot be read or applied, or the new version cannot be saved
+func (c *Client) patchOldCopy(r io.Reader, path string) (int64, delta.Stats, error) {
+	oldCopy, err := os.Open(path)
+	if err != nil {
+		return 0, delta.Stats{}, fmt.Errorf("Could not open old copy. %w", err)
+	}
+	defer oldCopy.Close()
+
+	info, err := oldCopy.Stat()
+	if err != nil {
+		return 0, delta.Stats{}, fmt.Errorf("Could not open old copy. %w", err)
+	}
+	newVersion, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return 0, delta.Stats{}, fmt.Errorf("Could not create the file. %w", err)
+	}
+	defer os.Remove(newVersion.Name())
+
+	fileWriter := bufio.NewWriter(newVersion)
+	patched := &countingWriter{writer: fileWriter, counter: c.metrics.contentDownloaded}
+	stats, err := delta.Patch(oldCopy, r, patched)
+	if err == nil {
+		err = fileWriter.Flush()
+	}
+	if err == nil {
+		err = newVersion.Chmod(info.Mode())
+	}
+	if closeErr := newVersion.Close(); err == nil {
+		err = closeErr
+	}
+	oldCopy.Close()
+	if err == nil {
+		err = os.Rename(newVersion.Name(), path)
+	}
+
+	c.metrics.reusedBytes.Add(uint64(stats.Copied))
+	return patched.written, stats, err
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/client/audit"
+	"github.com/imaikeru/peer-to-peer/client/content"
+	"github.com/imaikeru/peer-to-peer/client/dht"
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+const (
+	contentRequestPrefix = "content "
+	publicScope          = "public"
+	registerScopeIndex   = 2
+
+	// records live for an hour on the DHT, so they are announced again well before they expire
+	dhtRepublishInterval = 20 * time.Minute
+)
+
+var errNotConnected = errors.New("not connected to the central server")
+
+func (c *Client) isConnectedToServer() bool {
+	c.serverWriterMutex.Lock()
+	defer c.serverWriterMutex.Unlock()
+
+	return c.serverWriter != nil
+}
+
+// registrationScope is a function that returns the scope of a request like
+// register alice [public|group:name|users:first,second] "/path/to/file"
+// or an empty string if the request names none
+func registrationScope(request string) string {
+	fields := strings.Fields(request)
+	if len(fields) <= registerScopeIndex || strings.HasPrefix(fields[registerScopeIndex], `"`) {
+		return ""
+	}
+	return fields[registerScopeIndex]
+}
+
+// isPublicScope is a function that returns whether the files registered with "scope" are shared with everyone
+func isPublicScope(scope string) bool {
+	return scope == "" || scope == publicScope
+}
+
+// publishContent is a function that lets peers which learned through peer exchange or found on the DHT that the mini server holds "link"
+// download it without a ticket, so that it can be downloaded even when the central server is unavailable.
+// The content is announced on the DHT if the client has joined one.
+func (c *Client) publishContent(link content.Link, path string) {
+	c.linksMutex.Lock()
+	c.publicContent[link.ID] = path
+	c.linksMutex.Unlock()
+
+	if c.dht != nil {
+		c.announce(link.ID)
+	}
+}
+
+func (c *Client) announce(contentID string) {
+	if err := c.dht.Announce(dht.KeyFor(contentID), c.miniServerAddress); err == dht.ErrNoPeers {
+		c.logger.Debug("No other DHT node stored the content, it can be found only through this node", "component", "dht")
+	} else if err != nil {
+		c.logger.Warn("Could not announce content on the DHT", "component", "dht", "error", err)
+	}
+}
+
+// republishPeriodically is a function that announces the publicly shared content on the DHT again before its records expire
+func (c *Client) republishPeriodically() {
+	for {
+		time.Sleep(dhtRepublishInterval)
+
+		c.linksMutex.Lock()
+		contentIDs := make([]string, 0, len(c.publicContent))
+		for contentID := range c.publicContent {
+			contentIDs = append(contentIDs, contentID)
+		}
+		c.linksMutex.Unlock()
+
+		for _, contentID := range contentIDs {
+			c.announce(contentID)
+		}
+	}
+}
+
+// parseContentRequest is a function that returns the content ID from a request like
+// content <content id>
+func parseContentRequest(request string) (string, bool) {
+	if !strings.HasPrefix(request, contentRequestPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(request, contentRequestPrefix), true
+}
+
+func contentRequest(contentID string) string {
+	return contentRequestPrefix + contentID + "\n"
+}
+
+// servePublicContent is a function that sends the file with content ID "contentID" to a peer that found it on the DHT.
+// Only files that were shared with everyone can be downloaded this way, since no ticket proves who the peer is.
+func (c *Client) servePublicContent(conn net.Conn, logger *logging.Logger, contentID string, options transferOptions) {
+	record := audit.Record{
+		Time:      time.Now(),
+		Direction: audit.Upload,
+		Peer:      conn.RemoteAddr().String(),
+		User:      unknownUser,
+		File:      contentID,
+	}
+
+	c.linksMutex.Lock()
+	path, ok := c.publicContent[contentID]
+	c.linksMutex.Unlock()
+
+	if !ok {
+		logger.Warn("Refused download of content that is not shared publicly", "content", contentID)
+		record.Result = "refused: not shared publicly"
+	} else {
+		record.File = path
+		c.sendFile(conn, logger, path, options, &record)
+	}
+	record.Duration = time.Since(record.Time)
+	c.recordTransfer(record)
+}
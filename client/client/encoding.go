@@ -0,0 +1,63 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/imaikeru/peer-to-peer/client/compression"
+)
+
+const (
+	acceptEncodingPrefix  = "accept-encoding "
+	contentEncodingPrefix = "content-encoding "
+)
+
+// parseAcceptEncoding is a function that returns the encodings offered in a line like
+// accept-encoding gzip deflate
+func parseAcceptEncoding(line string) ([]string, bool) {
+	if !strings.HasPrefix(line, acceptEncodingPrefix) {
+		return nil, false
+	}
+	return strings.Fields(strings.TrimPrefix(line, acceptEncodingPrefix)), true
+}
+
+// chooseEncoding is a function that returns how the file at "path", which is read from "file", is compressed for a peer that offered "offered".
+// Peers that did not offer any encodings receive the file as it is and are not told so, in which case it returns "".
+func chooseEncoding(path string, file *bufio.Reader, offered []string) string {
+	if offered == nil {
+		return ""
+	}
+	if head, _ := file.Peek(compression.SniffLength); !compression.Compressible(path, head) {
+		return compression.Identity
+	}
+	return compression.Choose(offered)
+}
+
+// encodeTo is a function that tells the peer on "conn" how the file is compressed with a line like
+// content-encoding gzip
+// and returns a writer that compresses to "w", which writes to "conn"
+//    (***) Returns error if the line cannot be sent
+func encodeTo(conn, w io.Writer, encoding string) (io.WriteCloser, error) {
+	if encoding == "" {
+		return compression.NewWriter(compression.Identity, w)
+	}
+	if _, err := io.WriteString(conn, contentEncodingPrefix+encoding+"\n"); err != nil {
+		return nil, err
+	}
+	return compression.NewWriter(encoding, w)
+}
+
+// readContentEncoding is a function that reads the line with which the mini server tells how it compressed the file
+//    (***) Returns error if the mini server closed the connection instead, which it does when it refuses the request
+func readContentEncoding(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("The peer refused to send the file. %w", err)
+	}
+	if !strings.HasPrefix(line, contentEncodingPrefix) {
+		return "", fmt.Errorf("Malformed content encoding %q", strings.TrimSpace(line))
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, contentEncodingPrefix)), nil
+}
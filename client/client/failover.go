@@ -0,0 +1,265 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// standbyPrefix starts the answer of a standby central server, which is followed by the address of the primary if it is known
+	standbyPrefix = "ERR standby, the primary is "
+
+	dialTimeout = 3 * time.Second
+	// a new primary is elected within a few seconds, so the trackers are tried for a while before giving up
+	failoverAttempts = 30
+	failoverDelay    = time.Second
+
+	renamedPrefix      = "Successfully renamed "
+	aliasAddedPrefix   = "Successfully added alias "
+	aliasRemovedPrefix = "Successfully removed alias "
+	aliasRemovedSuffix = " and its files"
+	deviceSeparator    = "@"
+)
+
+// replayedFile is a struct that contains:
+//    - username - the username the file is registered as
+//    - path     - the path of the file
+type replayedFile struct {
+	username string
+	path     string
+}
+
+// replayedRegistration is a struct that contains:
+//    - scope       - the scope the file is registered with, empty if the registration names none
+//    - description - the content ID, the size and the BitTorrent info hash of the file, as "register-content" reports them
+type replayedRegistration struct {
+	scope       string
+	description string
+}
+
+// replayState is a struct that contains what the central server confirmed about the client, which is sent again
+// to the primary a client fails over to, since the servers of a cluster do not replicate the files of their clients:
+//    - username - the username of the client, empty until the first registration is confirmed
+//    - aliases  - a set of the aliases of the client
+//    - files    - a map whose keys are the registered files and values are how they were registered
+// It holds only the current registrations, so it grows only with the files that are registered at the same time.
+type replayState struct {
+	username string
+	aliases  map[string]struct{}
+	files    map[replayedFile]replayedRegistration
+}
+
+func createReplayState() replayState {
+	return replayState{
+		aliases: make(map[string]struct{}),
+		files:   make(map[replayedFile]replayedRegistration),
+	}
+}
+
+// rememberForFailover is a function that stores that the central server confirmed the registration of "path" as "username",
+// so that the file is registered again after a failover
+func (c *Client) rememberForFailover(username, path string, registration replayedRegistration) {
+	c.replayMutex.Lock()
+	defer c.replayMutex.Unlock()
+
+	if c.replay.username == "" {
+		c.replay.username = username
+	}
+	c.replay.files[replayedFile{username: username, path: path}] = registration
+}
+
+// forgetForFailover is a function that stops registering the files in an "unregister" request again after a failover
+func (c *Client) forgetForFailover(request string) {
+	username := strings.Fields(request)[userIndex]
+
+	c.replayMutex.Lock()
+	defer c.replayMutex.Unlock()
+
+	for _, path := range quotedArguments(request) {
+		delete(c.replay.files, replayedFile{username: username, path: path})
+	}
+}
+
+// followIdentityChange is a function that applies to what is sent again after a failover the renames and aliases
+// the central server confirmed in responses like
+// Successfully renamed alice@laptop to alicia@laptop.
+// Successfully added alias team@laptop.
+// Successfully removed alias team@laptop and its files.
+func (c *Client) followIdentityChange(response string) {
+	response = strings.TrimSuffix(strings.TrimSpace(response), ".")
+	usernameOf := func(identity string) string {
+		return strings.SplitN(identity, deviceSeparator, 2)[0]
+	}
+
+	c.replayMutex.Lock()
+	defer c.replayMutex.Unlock()
+
+	switch {
+	case strings.HasPrefix(response, renamedPrefix):
+		names := strings.Split(strings.TrimPrefix(response, renamedPrefix), " to ")
+		if len(names) != 2 {
+			return
+		}
+		oldUsername, newUsername := usernameOf(names[0]), usernameOf(names[1])
+		for file, registration := range c.replay.files {
+			if file.username == oldUsername {
+				delete(c.replay.files, file)
+				c.replay.files[replayedFile{username: newUsername, path: file.path}] = registration
+			}
+		}
+		c.replay.username = newUsername
+	case strings.HasPrefix(response, aliasAddedPrefix):
+		c.replay.aliases[usernameOf(strings.TrimPrefix(response, aliasAddedPrefix))] = struct{}{}
+	case strings.HasPrefix(response, aliasRemovedPrefix):
+		alias := usernameOf(strings.TrimSuffix(strings.TrimPrefix(response, aliasRemovedPrefix), aliasRemovedSuffix))
+		delete(c.replay.aliases, alias)
+		for file := range c.replay.files {
+			if file.username == alias {
+				delete(c.replay.files, file)
+			}
+		}
+	}
+}
+
+// replayedCommands is a function that returns the commands that register the client again on the primary it failed over to:
+// the files of its username first, its aliases and their files next and the links of all files last
+func (c *Client) replayedCommands() []string {
+	c.replayMutex.Lock()
+	defer c.replayMutex.Unlock()
+
+	files := make([]replayedFile, 0, len(c.replay.files))
+	for file := range c.replay.files {
+		files = append(files, file)
+	}
+	username := c.replay.username
+	sort.Slice(files, func(i, j int) bool {
+		if (files[i].username == username) != (files[j].username == username) {
+			return files[i].username == username
+		}
+		if files[i].username != files[j].username {
+			return files[i].username < files[j].username
+		}
+		return files[i].path < files[j].path
+	})
+
+	aliases := make([]string, 0, len(c.replay.aliases))
+	for alias := range c.replay.aliases {
+		aliases = append(aliases, "alias "+alias+"\n")
+	}
+	sort.Strings(aliases)
+
+	commands := make([]string, 0, 2*len(files)+len(aliases))
+	aliasesSent := false
+	for _, file := range files {
+		if file.username != username && !aliasesSent {
+			commands = append(commands, aliases...)
+			aliasesSent = true
+		}
+		scope := c.replay.files[file].scope
+		if scope != "" {
+			scope += " "
+		}
+		commands = append(commands, fmt.Sprintf("register %s %s\"%s\"\n", file.username, scope, file.path))
+	}
+	if !aliasesSent {
+		commands = append(commands, aliases...)
+	}
+	for _, file := range files {
+		commands = append(commands, registerContentCommand(file.username, file.path, c.replay.files[file].description))
+	}
+
+	return commands
+}
+
+// canFailOver is a function that returns whether the client knows more than one central server
+func (c *Client) canFailOver() bool {
+	return len(c.trackers) > 1
+}
+
+// handleStandby is a function that remembers the primary a standby pointed to, so that it is tried first
+func (c *Client) handleStandby(response string) {
+	primary := strings.TrimSpace(strings.TrimPrefix(response, standbyPrefix))
+	if _, _, err := net.SplitHostPort(primary); err != nil {
+		c.logger.Info("Connected to a standby that does not know the primary", "component", "tracker")
+		return
+	}
+
+	c.logger.Info("Connected to a standby, trying the primary", "component", "tracker", "primary", primary)
+	c.preferredTracker = primary
+}
+
+// connectToTracker is a function that connects to the first central server that accepts the connection,
+// the primary a standby pointed to first and then the configured ones in order
+func (c *Client) connectToTracker() (net.Conn, error) {
+	candidates := c.trackers
+	if c.preferredTracker != "" {
+		candidates = append([]string{c.preferredTracker}, c.trackers...)
+		c.preferredTracker = ""
+	}
+
+	var lastErr error
+	for _, address := range candidates {
+		conn, err := net.DialTimeout("tcp", address, dialTimeout)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// useServer is a function that sends the commands to the central server over "server" from now on
+func (c *Client) useServer(server net.Conn) {
+	c.serverWriterMutex.Lock()
+	defer c.serverWriterMutex.Unlock()
+
+	if server == nil {
+		c.serverWriter = nil
+		c.tracker = ""
+		return
+	}
+	c.serverWriter = bufio.NewWriterSize(server, 4096)
+	c.tracker, _, _ = net.SplitHostPort(server.RemoteAddr().String())
+}
+
+// registerWithServer is a function that tells the central server where the mini server is and which device the client is
+func (c *Client) registerWithServer() {
+	c.sendToServer("register-miniserver " + c.miniServerAddress + "\n")
+	if c.device != "" {
+		c.sendToServer("register-device " + c.device + "\n")
+	}
+}
+
+// failOver is a function that connects to another central server after the connection to the primary was lost
+// and sends it everything the client had registered, so that the new primary knows the same about the client
+//    (***) Returns nil if no central server accepted the connection
+func (c *Client) failOver() net.Conn {
+	c.useServer(nil)
+
+	for attempt := 0; attempt < failoverAttempts; attempt++ {
+		time.Sleep(failoverDelay)
+
+		server, err := c.connectToTracker()
+		if err != nil {
+			continue
+		}
+
+		c.useServer(server)
+		c.logger.Info("Failed over to another server", "component", "tracker", "server", server.RemoteAddr().String())
+		c.registerWithServer()
+
+		for _, request := range c.replayedCommands() {
+			if err := c.sendToServer(request); err != nil {
+				c.logger.Debug("Could not register again after failing over", "component", "tracker", "error", err)
+				break
+			}
+		}
+		return server
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+func TestFailOverRegistersTheCurrentStateAgain(t *testing.T) {
+	stopped, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped.Close()
+	primary, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+
+	c := CreateNewClient("", []string{stopped.Addr().String(), primary.Addr().String()}, logging.CreateDiscardLogger(), "laptop", nil, "", nil)
+	c.miniServerAddress = "127.0.0.1:9000"
+
+	c.rememberForFailover("alice", "/a", replayedRegistration{description: "1"})
+	c.rememberForFailover("alice", "/a", replayedRegistration{description: "2"})
+	c.rememberForFailover("alice", "/b", replayedRegistration{scope: "group:team", description: "3"})
+	c.rememberForFailover("alice", "/gone", replayedRegistration{description: "4"})
+	c.forgetForFailover(`unregister alice "/gone"`)
+	c.followIdentityChange("Successfully added alias team@laptop.\n")
+	c.rememberForFailover("team", "/c", replayedRegistration{description: "5"})
+	c.followIdentityChange("Successfully added alias old@laptop.\n")
+	c.rememberForFailover("old", "/d", replayedRegistration{description: "6"})
+	c.followIdentityChange("Successfully removed alias old@laptop and its files.\n")
+	c.followIdentityChange("Successfully renamed alice@laptop to alicia@laptop.\n")
+
+	if server := c.failOver(); server == nil {
+		t.Fatal("expected to fail over to the server that accepts the connection")
+	} else {
+		defer server.Close()
+	}
+
+	conn, err := primary.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	expected := []string{
+		"register-miniserver 127.0.0.1:9000\n",
+		"register-device laptop\n",
+		"register alicia \"/a\"\n",
+		"register alicia group:team \"/b\"\n",
+		"alias team\n",
+		"register team \"/c\"\n",
+		"register-content alicia \"/a\" 2\n",
+		"register-content alicia \"/b\" 3\n",
+		"register-content team \"/c\" 5\n",
+	}
+	reader := bufio.NewReader(conn)
+	received := make([]string, 0, len(expected))
+	for range expected {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected %q, got %q and %v", expected, received, err)
+		}
+		received = append(received, line)
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("got %q, want %q", received, expected)
+	}
+}
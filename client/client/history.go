@@ -0,0 +1,52 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/imaikeru/peer-to-peer/client/audit"
+)
+
+const (
+	historyCommand     = "history"
+	historyUploads     = "uploads"
+	unknownUser        = "-"
+	historyFilterIndex = 1
+)
+
+func (c *Client) recordTransfer(record audit.Record) {
+	if c.auditLog == nil {
+		return
+	}
+
+	if err := c.auditLog.Append(record); err != nil {
+		c.logger.Warn("Could not write audit record", "component", "audit", "error", err)
+	}
+}
+
+// printHistory is a function that prints the audited transfers for a request like
+// history uploads
+func (c *Client) printHistory(request string) {
+	if c.auditLog == nil {
+		fmt.Println("Transfers are not audited, start the client with -audit_log.")
+		return
+	}
+
+	direction := audit.Download
+	if strings.Fields(request)[historyFilterIndex] == historyUploads {
+		direction = audit.Upload
+	}
+
+	records, err := c.auditLog.Records(direction)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if len(records) == 0 {
+		fmt.Printf("There are no %ss yet.\n", direction)
+	}
+	for _, record := range records {
+		fmt.Println(record)
+	}
+}
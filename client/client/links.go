@@ -0,0 +1,249 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/imaikeru/peer-to-peer/client/content"
+	"github.com/imaikeru/peer-to-peer/client/torrent"
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+const (
+	linkCommand             = "link"
+	contentRegisteredPrefix = "content-registered "
+	locatedContentPrefix    = "located-content "
+	notLocatedContentPrefix = "not-located-content "
+
+	locatedContentIDIndex       = 1
+	locatedContentIdentityIndex = 2
+	locatedContentAddressIndex  = 3
+	locatedContentTicketIndex   = 4
+	locatedContentFileIndex     = 5
+	notLocatedContentIDIndex    = 1
+
+	contentIDLength = 64
+)
+
+var quotedArgumentRegex = regexp.MustCompile(`"[^"]+"`)
+
+// quotedArguments is a function that returns the arguments of "request" that are in double quotes, without the quotes
+func quotedArguments(request string) []string {
+	arguments := quotedArgumentRegex.FindAllString(request, -1)
+	for i := range arguments {
+		arguments[i] = strings.Trim(arguments[i], `"`)
+	}
+	return arguments
+}
+
+// registeredContent is a struct that contains:
+//    - link         - the "p2p:" link of a file the user registered
+//    - username     - the username the file is registered as
+//    - scope        - the scope the file is registered with, empty if the registration names none
+//    - description  - the content ID, the size and the BitTorrent info hash of the file, as "register-content" reports them
+type registeredContent struct {
+	link        content.Link
+	username    string
+	scope       string
+	description string
+}
+
+// registerContentCommand is a function that returns the command that reports the "description" of the file at "path" registered as "username"
+func registerContentCommand(username, path, description string) string {
+	return fmt.Sprintf("register-content %s \"%s\" %s\n", username, path, description)
+}
+
+// registerContent is a function that computes the content IDs and BitTorrent info hashes of the files in a "register" request
+// and reports them to the central server, so that the files can be downloaded through "p2p:" links and ".torrent" files.
+// The links are used only once the central server confirms them, since it refuses the files that it has not registered.
+// Without the central server they are used at once.
+func (c *Client) registerContent(request string) {
+	username := strings.Fields(request)[userIndex]
+	scope := registrationScope(request)
+
+	for _, path := range quotedArguments(request) {
+		link, err := content.Describe(path)
+		if err != nil {
+			c.logger.Warn("Could not compute content ID", "component", "content", "error", err)
+			continue
+		}
+
+		metainfo, err := torrent.Create(path, c.announceURL, torrent.DefaultPieceLength, link.ID)
+		if err != nil {
+			c.logger.Warn("Could not compute info hash", "component", "content", "error", err)
+			continue
+		}
+
+		registered := registeredContent{
+			link:        link,
+			username:    username,
+			scope:       scope,
+			description: fmt.Sprintf("%s %d %x", link.ID, link.Size, metainfo.InfoHash()),
+		}
+		c.linksMutex.Lock()
+		c.pendingContent[path] = registered
+		c.linksMutex.Unlock()
+
+		if err := c.sendToServer(registerContentCommand(username, path, registered.description)); err == errNotConnected {
+			c.confirmContent(path, link.ID)
+		} else if err != nil {
+			c.logger.Error("Error occurred while trying to write to server", "component", "tracker", "error", err)
+		}
+	}
+}
+
+// handleContentRegistered is a function that uses the link of the file the central server confirmed in a response like
+// content-registered <content id> "/path/to/file"
+func (c *Client) handleContentRegistered(response string) {
+	split := strings.SplitN(strings.TrimSpace(response), " ", 3)
+	if len(split) != 3 {
+		c.logger.Warn("Malformed content-registered response", "component", "tracker", "response", logging.Path(strings.TrimSpace(response)))
+		return
+	}
+
+	c.logger.Debug("Registered content", "component", "content", "response", logging.Path(strings.TrimSpace(response)))
+	c.confirmContent(strings.Trim(split[2], `"`), split[1])
+}
+
+// confirmContent is a function that uses the link with content ID "contentID" of the file at "path", if it waits for a confirmation.
+// The file can then be downloaded through its link and, if it is shared with everyone, without a ticket.
+func (c *Client) confirmContent(path, contentID string) {
+	c.linksMutex.Lock()
+	registered, ok := c.pendingContent[path]
+	if !ok || registered.link.ID != contentID {
+		c.linksMutex.Unlock()
+		return
+	}
+	delete(c.pendingContent, path)
+	c.links[path] = registered.link
+	c.linksMutex.Unlock()
+
+	c.rememberForFailover(registered.username, path, replayedRegistration{scope: registered.scope, description: registered.description})
+	if isPublicScope(registered.scope) {
+		c.publishContent(registered.link, path)
+	}
+}
+
+// forgetContent is a function that forgets the links of the files in an "unregister" request,
+// so that the mini server stops serving them to peers that found them on the DHT
+func (c *Client) forgetContent(request string) {
+	c.linksMutex.Lock()
+	defer c.linksMutex.Unlock()
+
+	for _, path := range quotedArguments(request) {
+		if link, ok := c.links[path]; ok && c.publicContent[link.ID] == path {
+			delete(c.publicContent, link.ID)
+		}
+		delete(c.links, path)
+		delete(c.pendingContent, path)
+	}
+}
+
+// printLink is a function that prints the "p2p:" link of the file in a request like
+// link "/path/to/file"
+func (c *Client) printLink(request string) {
+	path := quotedArguments(request)[0]
+
+	c.linksMutex.Lock()
+	link, registered := c.links[path]
+	c.linksMutex.Unlock()
+
+	if !registered {
+		described, err := content.Describe(path)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		link = described
+		fmt.Println("Warning: the file is not registered, register it before sharing the link.")
+	}
+
+	fmt.Println(link)
+}
+
+// downloadLink is a function that asks the central server who holds the file that "link" points to.
+// The download to "pathToSave" starts once the server answers.
+// Without the central server the holders learned from other peers and found on the DHT are tried.
+func (c *Client) downloadLink(link content.Link, pathToSave string) {
+	if !c.isConnectedToServer() {
+		go c.downloadFromPeers(link.ID, pathToSave)
+		return
+	}
+
+	c.pendingDownloadsMutex.Lock()
+	c.pendingDownloads[link.ID] = append(c.pendingDownloads[link.ID], pathToSave)
+	c.pendingDownloadsMutex.Unlock()
+
+	if err := c.sendToServer("locate-content " + link.ID + "\n"); err != nil {
+		c.logger.Error("Error occurred while trying to write to server", "component", "tracker", "error", err)
+	}
+}
+
+// handleLocatedContent is a function that starts the pending download of the content named in a response like
+// located-content <content id or info hash> alice@laptop 127.0.0.1:4000 eyJyZXF1ZXN0ZXIi... "/path/to/file"
+func (c *Client) handleLocatedContent(response string) {
+	split := strings.SplitN(strings.TrimSpace(response), " ", 6)
+	if len(split) != 6 {
+		c.logger.Warn("Malformed located-content response", "component", "tracker", "response", logging.Path(strings.TrimSpace(response)))
+		return
+	}
+
+	contentID := split[locatedContentIDIndex]
+	pathToSave, ok := c.popPendingDownload(contentID)
+	if !ok {
+		return
+	}
+
+	address := split[locatedContentAddressIndex]
+	c.warnIfUnreachable(split[locatedContentIdentityIndex])
+	fmt.Printf("Downloading from %s.\n", split[locatedContentIdentityIndex])
+
+	go func() {
+		pathToFileOnUser := strings.Trim(split[locatedContentFileIndex], `"`)
+		exchanged := ""
+		if len(contentID) == contentIDLength {
+			exchanged = contentID
+		}
+		downloaded := c.downloadFile(&address, split[locatedContentIdentityIndex], downloadRequest(split[locatedContentTicketIndex], pathToFileOnUser), exchanged, pathToFileOnUser, pathToSave)
+		if downloaded && exchanged != "" && c.verifyContent(contentID, pathToSave) {
+			c.learnHolders(contentID, []string{address})
+		}
+	}()
+}
+
+// verifyContent is a function that returns whether the content of the downloaded file matches its content ID and warns if it does not
+func (c *Client) verifyContent(contentID, pathToSave string) bool {
+	downloaded, err := content.Describe(pathToSave)
+	if err != nil {
+		c.logger.Warn("Could not verify downloaded file", "component", "content", "error", err)
+		return false
+	}
+
+	if downloaded.ID != contentID {
+		fmt.Printf("Warning: the content of %s does not match the link, the file has probably changed since it was shared.\n", pathToSave)
+		return false
+	}
+	return true
+}
+
+// handleNotLocatedContent is a function that drops the pending download of the content named in a response like
+// not-located-content <content id or info hash>
+func (c *Client) handleNotLocatedContent(response string) {
+	split := strings.Fields(response)
+	if len(split) != 2 {
+		c.logger.Warn("Malformed not-located-content response", "component", "tracker", "response", logging.Path(strings.TrimSpace(response)))
+		return
+	}
+
+	contentID := split[notLocatedContentIDIndex]
+	pathToSave, ok := c.popPendingDownload(contentID)
+	if !ok {
+		return
+	}
+	if len(contentID) == contentIDLength && (c.dht != nil || len(c.peers.Holders(contentID)) > 0) {
+		go c.downloadFromPeers(contentID, pathToSave)
+		return
+	}
+	fmt.Println("Nobody who shares files with you holds this file at the moment.")
+}
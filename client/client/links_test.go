@@ -0,0 +1,68 @@
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imaikeru/peer-to-peer/client/content"
+)
+
+func TestRegisteredContentIsUsedOnlyOnceTheServerConfirmsIt(t *testing.T) {
+	var tests = []struct {
+		name         string
+		confirmed    bool
+		otherContent bool
+		expected     bool
+	}{
+		{"confirmed", true, false, true},
+		{"refused", false, false, false},
+		{"confirmed for other content", true, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shared := filepath.Join(t.TempDir(), "report.csv")
+			if err := ioutil.WriteFile(shared, []byte("the report"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			link, err := content.Describe(shared)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, tracker := createTestClient(t)
+			registrations := make(chan string, 1)
+			go func() {
+				registration, _ := tracker.ReadString('\n')
+				registrations <- registration
+			}()
+			c.registerContent(`register alice "` + shared + `"`)
+			if registration := <-registrations; !strings.HasPrefix(registration, "register-content alice") {
+				t.Fatalf("expected the content to be reported, got %q", registration)
+			}
+			if c.holds(link.ID) {
+				t.Fatal("expected the content to wait for the confirmation of the server")
+			}
+
+			// the server answers a refused registration with an error instead of a confirmation
+			confirmedID := link.ID
+			if tt.otherContent {
+				confirmedID = strings.Repeat("ab", 32)
+			}
+			if tt.confirmed {
+				c.handleContentRegistered("content-registered " + confirmedID + ` "` + shared + `"` + "\n")
+			}
+
+			if c.holds(link.ID) != tt.expected {
+				t.Errorf("expected the client to hold the content %t", tt.expected)
+			}
+			c.linksMutex.Lock()
+			defer c.linksMutex.Unlock()
+			if _, public := c.publicContent[link.ID]; public != tt.expected {
+				t.Errorf("expected the content to be shared without a ticket %t", tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/imaikeru/peer-to-peer/client/content"
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+const (
+	locatedPrefix    = "located "
+	notLocatedPrefix = "not-located "
+
+	locatedIdentityIndex = 1
+	locatedAddressIndex  = 2
+	locatedTicketIndex   = 3
+	locatedFileIndex     = 4
+	notLocatedFileIndex  = 2
+)
+
+// userlessDownloadRegex matches the "download" requests that name no user, which download a "p2p:" link or a ".torrent" file
+var userlessDownloadRegex = regexp.MustCompile(`^\s*download\s+"`)
+
+// handleDownloadRequest is a function that starts the download of a request like
+// download alice "/path/to/file" "/path/to/save"
+// or, if the request names no user, the download of a "p2p:" link or of the file a ".torrent" file describes
+func (c *Client) handleDownloadRequest(request string) {
+	arguments := quotedArguments(request)
+	if !userlessDownloadRegex.MatchString(request) {
+		c.requestLocation(strings.Fields(request)[userIndex], arguments[0], arguments[1])
+	} else if content.IsLink(arguments[0]) {
+		if link, err := content.Parse(arguments[0]); err != nil {
+			fmt.Println(err)
+		} else {
+			c.downloadLink(link, arguments[1])
+		}
+	} else if isTorrentFile(arguments[0]) {
+		c.downloadTorrent(arguments[0], arguments[1])
+	}
+}
+
+// requestLocation is a function that asks the central server which device of "identity" holds "pathToFileOnUser".
+// The download to "pathToSave" starts once the server answers.
+func (c *Client) requestLocation(identity, pathToFileOnUser, pathToSave string) {
+	quotedPath := `"` + pathToFileOnUser + `"`
+
+	c.pendingDownloadsMutex.Lock()
+	c.pendingDownloads[quotedPath] = append(c.pendingDownloads[quotedPath], pathToSave)
+	c.pendingDownloadsMutex.Unlock()
+
+	if err := c.sendToServer("locate " + identity + " " + quotedPath + "\n"); err != nil {
+		c.logger.Error("Error occurred while trying to write to server", "component", "tracker", "error", err)
+	}
+}
+
+func (c *Client) popPendingDownload(quotedPath string) (string, bool) {
+	c.pendingDownloadsMutex.Lock()
+	defer c.pendingDownloadsMutex.Unlock()
+
+	pathsToSave := c.pendingDownloads[quotedPath]
+	if len(pathsToSave) == 0 {
+		return "", false
+	}
+
+	if len(pathsToSave) == 1 {
+		delete(c.pendingDownloads, quotedPath)
+	} else {
+		c.pendingDownloads[quotedPath] = pathsToSave[1:]
+	}
+	return pathsToSave[0], true
+}
+
+// handleLocated is a function that starts the pending download of the file named in a response like
+// located alice@laptop 127.0.0.1:4000 eyJyZXF1ZXN0ZXIi... "/path/to/file"
+// where the ticket is signed by the central server and allows downloading the file from that mini server
+func (c *Client) handleLocated(response string) {
+	split := strings.SplitN(strings.TrimSpace(response), " ", 5)
+	if len(split) != 5 {
+		c.logger.Warn("Malformed located response", "component", "tracker", "response", logging.Path(strings.TrimSpace(response)))
+		return
+	}
+
+	pathToSave, ok := c.popPendingDownload(split[locatedFileIndex])
+	if !ok {
+		return
+	}
+
+	address := split[locatedAddressIndex]
+	c.warnIfUnreachable(split[locatedIdentityIndex])
+	fmt.Printf("Downloading from %s.\n", split[locatedIdentityIndex])
+	pathToFileOnUser := strings.Trim(split[locatedFileIndex], `"`)
+	go c.downloadFile(&address, split[locatedIdentityIndex], downloadRequest(split[locatedTicketIndex], pathToFileOnUser), "", pathToFileOnUser, pathToSave)
+}
+
+// handleNotLocated is a function that drops the pending download of the file named in a response like
+// not-located alice "/path/to/file"
+func (c *Client) handleNotLocated(response string) {
+	split := strings.SplitN(strings.TrimSpace(response), " ", 3)
+	if len(split) != 3 {
+		c.logger.Warn("Malformed not-located response", "component", "tracker", "response", logging.Path(strings.TrimSpace(response)))
+		return
+	}
+
+	if _, ok := c.popPendingDownload(split[notLocatedFileIndex]); ok {
+		fmt.Printf("The user %s has not registered %s on any device or has not shared it with you.\n", split[userIndex], split[notLocatedFileIndex])
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+	"github.com/imaikeru/peer-to-peer/shared/ticket"
+)
+
+// serveTestMiniServer is a function that starts the mini server of "c" and returns its address
+func serveTestMiniServer(t *testing.T, c *Client) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	c.miniServerAddress = listener.Addr().String()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go c.miniServerHandleDownloadRequest(conn)
+		}
+	}()
+
+	return c.miniServerAddress
+}
+
+func TestDownloadOfARemoteTorrentFileFromAUser(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder := CreateNewClient("", nil, logging.CreateDiscardLogger(), "", nil, "", nil)
+	holder.ticketKey = public
+	holderAddress := serveTestMiniServer(t, holder)
+
+	directory := t.TempDir()
+	remote := filepath.Join(directory, "shared.torrent")
+	saved := filepath.Join(directory, "saved.torrent")
+	if err := ioutil.WriteFile(remote, []byte("d8:announce0:e"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, tracker := createTestClient(t)
+	go c.handleDownloadRequest(`download bob "` + remote + `" "` + saved + `"`)
+
+	expected := `locate bob "` + remote + `"` + "\n"
+	if request, err := tracker.ReadString('\n'); err != nil || request != expected {
+		t.Fatalf("expected the file to be located on the devices of bob, got %q and %v", request, err)
+	}
+
+	signed, err := ticket.Issue(private, ticket.Ticket{Requester: "alice", Owner: "bob", Holder: holderAddress, File: remote, Expires: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handleLocated("located bob " + holderAddress + " " + signed + ` "` + remote + `"` + "\n")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if received, err := ioutil.ReadFile(saved); err == nil && string(received) == "d8:announce0:e" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the .torrent file of bob to be downloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
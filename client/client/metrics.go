@@ -0,0 +1,89 @@
+package client
+
+import (
+	"io"
+
+	"github.com/imaikeru/peer-to-peer/client/metrics"
+)
+
+// clientMetrics is a struct that contains:
+//    - registry              - the registry all metrics of the client are exposed from
+//    - bytesUploaded         - the number of bytes sent by the mini server
+//    - bytesDownloaded       - the number of bytes received from other mini servers
+//    - contentUploaded       - the number of bytes of the files sent by the mini server, before they were compressed
+//    - contentDownloaded     - the number of bytes of the files received from other mini servers, after they were decompressed
+//    - reusedBytes           - the number of bytes of downloaded files that were copied from their old copies instead of being downloaded
+//    - activeUploads         - the number of files that are being sent by the mini server at the moment
+//    - activeDownloads       - the number of files that are being downloaded at the moment
+//    - miniServerConnections - the number of connections accepted by the mini server
+//    - failedDownloads       - the number of downloads that did not finish successfully
+//    - pushedDownloads       - the number of downloads pushed by the holder, since its mini server could not be connected to
+//    - relayedDownloads      - the number of downloads relayed by the central server, since the mini server could not be connected to
+type clientMetrics struct {
+	registry              *metrics.Registry
+	bytesUploaded         *metrics.Counter
+	bytesDownloaded       *metrics.Counter
+	contentUploaded       *metrics.Counter
+	contentDownloaded     *metrics.Counter
+	reusedBytes           *metrics.Counter
+	activeUploads         *metrics.Gauge
+	activeDownloads       *metrics.Gauge
+	miniServerConnections *metrics.Counter
+	failedDownloads       *metrics.Counter
+	pushedDownloads       *metrics.Counter
+	relayedDownloads      *metrics.Counter
+}
+
+func createClientMetrics() *clientMetrics {
+	registry := metrics.CreateRegistry()
+
+	return &clientMetrics{
+		registry:              registry,
+		bytesUploaded:         registry.NewCounter("p2p_client_uploaded_bytes_total", "Number of bytes sent by the mini server."),
+		bytesDownloaded:       registry.NewCounter("p2p_client_downloaded_bytes_total", "Number of bytes downloaded from other peers."),
+		contentUploaded:       registry.NewCounter("p2p_client_uploaded_content_bytes_total", "Number of bytes of files sent by the mini server before compression."),
+		contentDownloaded:     registry.NewCounter("p2p_client_downloaded_content_bytes_total", "Number of bytes of files downloaded from other peers after decompression."),
+		reusedBytes:           registry.NewCounter("p2p_client_reused_bytes_total", "Number of bytes of downloaded files copied from their old copies."),
+		activeUploads:         registry.NewGauge("p2p_client_active_uploads", "Number of files being sent by the mini server."),
+		activeDownloads:       registry.NewGauge("p2p_client_active_downloads", "Number of files being downloaded."),
+		miniServerConnections: registry.NewCounter("p2p_client_mini_server_connections_total", "Number of connections accepted by the mini server."),
+		failedDownloads:       registry.NewCounter("p2p_client_failed_downloads_total", "Number of downloads that failed."),
+		pushedDownloads:       registry.NewCounter("p2p_client_pushed_downloads_total", "Number of downloads pushed by the holder."),
+		relayedDownloads:      registry.NewCounter("p2p_client_relayed_downloads_total", "Number of downloads relayed by the central server."),
+	}
+}
+
+// countingWriter is an io.Writer that adds the number of written bytes to a Counter and to "written"
+type countingWriter struct {
+	writer  io.Writer
+	counter *metrics.Counter
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	written, err := w.writer.Write(p)
+	w.counter.Add(uint64(written))
+	w.written += int64(written)
+	return written, err
+}
+
+// countingReader is an io.Reader that adds the number of read bytes to a Counter and to "read"
+type countingReader struct {
+	reader  io.Reader
+	counter *metrics.Counter
+	read    int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	read, err := r.reader.Read(p)
+	r.counter.Add(uint64(read))
+	r.read += int64(read)
+	return read, err
+}
+
+// ServeMetrics is a function that:
+//    - exposes the metrics of the client on "/metrics" of an HTTP server listening on "address"
+//    (***) Returns error if the HTTP server cannot be started
+func (c *Client) ServeMetrics(address string) error {
+	return c.metrics.registry.Serve(address)
+}
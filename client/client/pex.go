@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/imaikeru/peer-to-peer/client/content"
+	"github.com/imaikeru/peer-to-peer/client/dht"
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+const (
+	pexPrefix = "pex "
+	// the most holders sent in a single peer exchange
+	maxExchangedPeers = 50
+)
+
+// pexMessage is a struct that contains:
+//    - Content - the content ID of the file that is downloaded
+//    - Peers   - the mini server addresses of other peers known to hold the file
+type pexMessage struct {
+	Content string   `json:"content"`
+	Peers   []string `json:"peers"`
+}
+
+// parsePexMessage is a function that returns the message from a line like
+// pex {"content":"<content id>","peers":["127.0.0.1:4000"]}
+func parsePexMessage(line string) (pexMessage, bool) {
+	if !strings.HasPrefix(line, pexPrefix) {
+		return pexMessage{}, false
+	}
+
+	var message pexMessage
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, pexPrefix)), &message); err != nil || message.Content == "" {
+		return pexMessage{}, false
+	}
+	return message, true
+}
+
+func writePexMessage(w io.Writer, message pexMessage) error {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("Could not encode peer exchange. %w", err)
+	}
+	_, err = w.Write([]byte(pexPrefix + string(encoded) + "\n"))
+	return err
+}
+
+// holds is a function that returns whether the user registered a file with content ID "contentID"
+func (c *Client) holds(contentID string) bool {
+	c.linksMutex.Lock()
+	defer c.linksMutex.Unlock()
+
+	for _, link := range c.links {
+		if link.ID == contentID {
+			return true
+		}
+	}
+	return false
+}
+
+// knownHolders is a function that returns the mini server addresses of at most "maxExchangedPeers" peers known to hold the content
+// with ID "contentID", other than this client and the peer at "except"
+func (c *Client) knownHolders(contentID, except string) []string {
+	holders := make([]string, 0)
+	for _, address := range c.peers.Holders(contentID) {
+		if address != c.miniServerAddress && address != except && len(holders) < maxExchangedPeers {
+			holders = append(holders, address)
+		}
+	}
+	return holders
+}
+
+// learnHolders is a function that adds the mini servers at "addresses" to the holders of the content with ID "contentID" in the peer directory
+func (c *Client) learnHolders(contentID string, addresses []string) {
+	learned := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if _, _, err := net.SplitHostPort(address); err == nil && address != c.miniServerAddress {
+			learned = append(learned, address)
+		}
+	}
+
+	added := c.peers.AddHolders(contentID, learned)
+	if added == 0 {
+		return
+	}
+
+	c.logger.Debug("Learned holders from another peer", "component", "pex", "content", contentID, "count", added)
+	if c.peersCachePath != "" {
+		if err := c.peers.SaveTo(c.peersCachePath); err != nil {
+			c.logger.Error("Error when saving users data", "file", logging.Path(c.peersCachePath), "error", err)
+		}
+	}
+}
+
+// exchangePeers is a function that tells the mini server at "address", before downloading the content with ID "contentID" from it,
+// which other peers hold the content and learns the ones it knows. The client names itself only if it holds the content already,
+// since the download has not been verified yet.
+//    (***) Returns error if the mini server did not answer with a peer exchange
+func (c *Client) exchangePeers(w io.Writer, reader *bufio.Reader, contentID, address string) error {
+	holders := c.knownHolders(contentID, address)
+	if c.holds(contentID) {
+		holders = append(holders, c.miniServerAddress)
+	}
+	if err := writePexMessage(w, pexMessage{Content: contentID, Peers: holders}); err != nil {
+		return err
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	answer, ok := parsePexMessage(strings.TrimSpace(line))
+	if !ok || answer.Content != contentID {
+		return fmt.Errorf("Malformed peer exchange answer %q", strings.TrimSpace(line))
+	}
+
+	c.learnHolders(contentID, answer.Peers)
+	return nil
+}
+
+// answerPeerExchange is a function that answers the peer exchange of a peer that is about to download from the mini server.
+// Holders are exchanged only about content the user holds, so that other peers can neither probe nor fill the directory with other content.
+func (c *Client) answerPeerExchange(w io.Writer, logger *logging.Logger, message pexMessage) {
+	answer := pexMessage{Content: message.Content, Peers: []string{}}
+	holds := c.holds(message.Content)
+	if holds {
+		answer.Peers = c.knownHolders(message.Content, "")
+	}
+
+	if err := writePexMessage(w, answer); err != nil {
+		logger.Warn("Error when answering peer exchange", "error", err)
+		return
+	}
+	if holds {
+		c.learnHolders(message.Content, message.Peers)
+	}
+}
+
+// downloadFromPeers is a function that downloads the content with ID "contentID" to "pathToSave" without the central server,
+// from the holders learned through peer exchange first and from the holders found on the DHT next.
+// Only files that were shared with everyone can be downloaded this way.
+func (c *Client) downloadFromPeers(contentID, pathToSave string) {
+	if c.downloadFromAny(c.peers.Holders(contentID), contentID, pathToSave, "through peer exchange") {
+		return
+	}
+
+	if c.dht == nil {
+		fmt.Println("Nobody known from other peers holds this file at the moment.")
+		return
+	}
+	if !c.downloadFromAny(c.dht.Lookup(dht.KeyFor(contentID)), contentID, pathToSave, "on the DHT") {
+		fmt.Println("Nobody on the DHT holds this file at the moment.")
+	}
+}
+
+// downloadFromAny is a function that downloads the content with ID "contentID" to "pathToSave"
+// from the first mini server in "addresses" that sends the right content. Other content is deleted.
+func (c *Client) downloadFromAny(addresses []string, contentID, pathToSave, source string) bool {
+	for _, address := range addresses {
+		if address == c.miniServerAddress {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			continue
+		}
+
+		fmt.Printf("Downloading from %s found %s.\n", address, source)
+		if !c.downloadFile(&address, unknownUser, contentRequest(contentID), contentID, contentID, pathToSave) {
+			continue
+		}
+		if downloaded, err := content.Describe(pathToSave); err == nil && downloaded.ID == contentID {
+			c.learnHolders(contentID, []string{address})
+			return true
+		}
+		c.logger.Warn("Peer sent other content", "component", "download", "peer", address, "source", source)
+		if err := os.Remove(pathToSave); err != nil {
+			c.logger.Warn("Could not delete other content", "component", "download", "file", logging.Path(pathToSave), "error", err)
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/imaikeru/peer-to-peer/client/content"
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+func TestExchangePeersNamesTheClientOnlyIfItHoldsTheContent(t *testing.T) {
+	contentID := strings.Repeat("ab", 32)
+
+	var tests = []struct {
+		name     string
+		holds    bool
+		expected []string
+	}{
+		{"downloading", false, []string{"127.0.0.1:4002"}},
+		{"holding", true, []string{"127.0.0.1:4002", "127.0.0.1:5000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := CreateNewClient("", nil, logging.CreateDiscardLogger(), "", nil, "", nil)
+			c.miniServerAddress = "127.0.0.1:5000"
+			c.peers.AddHolders(contentID, []string{"127.0.0.1:4001", "127.0.0.1:4002"})
+			if tt.holds {
+				c.links["/files/report.csv"] = content.Link{ID: contentID, Name: "report.csv"}
+			}
+
+			clientEnd, peerEnd := net.Pipe()
+			defer clientEnd.Close()
+			defer peerEnd.Close()
+
+			sent := make(chan pexMessage, 1)
+			go func() {
+				line, err := bufio.NewReader(peerEnd).ReadString('\n')
+				message, ok := parsePexMessage(strings.TrimSpace(line))
+				if err != nil || !ok {
+					t.Errorf("expected a peer exchange, got %q and %v", line, err)
+				}
+				sent <- message
+				writePexMessage(peerEnd, pexMessage{Content: contentID, Peers: []string{"127.0.0.1:4003", "127.0.0.1:5000", "not an address"}})
+			}()
+
+			if err := c.exchangePeers(clientEnd, bufio.NewReader(clientEnd), contentID, "127.0.0.1:4001"); err != nil {
+				t.Fatal(err)
+			}
+
+			if message := <-sent; !reflect.DeepEqual(message.Peers, tt.expected) {
+				t.Errorf("sent %q, want %q", message.Peers, tt.expected)
+			}
+			if holders := c.peers.Holders(contentID); !reflect.DeepEqual(holders, []string{"127.0.0.1:4001", "127.0.0.1:4002", "127.0.0.1:4003"}) {
+				t.Errorf("expected to learn only the valid addresses of other peers, got %q", holders)
+			}
+		})
+	}
+}
+
+func TestDownloadThroughPeerExchangeWithoutTheDHT(t *testing.T) {
+	var tests = []struct {
+		name       string
+		scope      string
+		downloaded bool
+	}{
+		{"shared with everyone", "public", true},
+		{"shared with a group", "group:team", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := t.TempDir()
+			shared := filepath.Join(directory, "report.csv")
+			saved := filepath.Join(directory, "saved.csv")
+			if err := ioutil.WriteFile(shared, []byte("the report"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			link, err := content.Describe(shared)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			holder, tracker := createTestClient(t)
+			holderAddress := serveTestMiniServer(t, holder)
+			registrations := make(chan string, 1)
+			go func() {
+				registration, _ := tracker.ReadString('\n')
+				registrations <- registration
+			}()
+			holder.registerContent("register alice " + tt.scope + ` "` + shared + `"`)
+			if registration := <-registrations; !strings.HasPrefix(registration, "register-content alice") {
+				t.Fatalf("expected the content to be registered, got %q", registration)
+			}
+			holder.handleContentRegistered("content-registered " + link.ID + ` "` + shared + `"` + "\n")
+
+			c := CreateNewClient("", nil, logging.CreateDiscardLogger(), "", nil, "", nil)
+			c.peers.AddHolders(link.ID, []string{holderAddress})
+			c.downloadFromPeers(link.ID, saved)
+
+			received, err := ioutil.ReadFile(saved)
+			if downloaded := err == nil && string(received) == "the report"; downloaded != tt.downloaded {
+				t.Errorf("expected the file to be downloaded %t, got %q and %v", tt.downloaded, received, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	pushCommand       = "push"
+	pushRequestPrefix = "push-request "
+	pushReadyPrefix   = "push-ready "
+	pushRefusedPrefix = "push-refused "
+	pushJoinPrefix    = "push "
+
+	// how long a downloader waits for the holder to connect to its mini server
+	pushWaitTimeout = 5 * time.Second
+	pushTokenLength = 16
+)
+
+// pushedConnection is a struct that contains:
+//    - conn   - the connection the holder of a file opened to the mini server in order to push the file
+//    - reader - a buffered reader over "conn"
+type pushedConnection struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// pushTo is a function that answers a line like
+// push-request <mini server address> <token>
+// with which the central server asks the client to push a file to a peer that could not connect to its mini server.
+// The client connects to the mini server of the peer and handles the request of the peer as if the peer had connected to it.
+func (c *Client) pushTo(response string) {
+	fields := strings.Fields(strings.TrimPrefix(response, pushRequestPrefix))
+	if len(fields) != 2 {
+		c.logger.Warn("Malformed push request", "component", "push", "response", strings.TrimSpace(response))
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", fields[0], dialTimeout)
+	if err != nil {
+		c.logger.Warn("Could not connect to the mini server of the peer", "component", "push", "peer", fields[0], "error", err)
+		return
+	}
+	if _, err := conn.Write([]byte(pushJoinPrefix + fields[1] + "\n")); err != nil {
+		c.logger.Warn("Could not connect to the mini server of the peer", "component", "push", "peer", fields[0], "error", err)
+		conn.Close()
+		return
+	}
+
+	c.logger.Debug("Pushing to peer", "component", "push", "peer", fields[0])
+	c.miniServerHandleDownloadRequest(conn)
+}
+
+// acceptPush is a function that passes a connection to the mini server, which started with a line like
+// push <token>
+// to the download that is waiting for the holder to push the file
+func (c *Client) acceptPush(conn net.Conn, reader *bufio.Reader, line string) {
+	token := strings.TrimSpace(strings.TrimPrefix(line, pushJoinPrefix))
+
+	c.pushesMutex.Lock()
+	defer c.pushesMutex.Unlock()
+
+	pushed, ok := c.pushes[token]
+	if !ok {
+		c.logger.Warn("Refused push nobody waits for", "component", "push", "peer", conn.RemoteAddr().String())
+		conn.Close()
+		return
+	}
+	delete(c.pushes, token)
+	// passed while the token is still held, so that a download which stops waiting right now finds the connection and closes it
+	pushed <- pushedConnection{conn: conn, reader: reader}
+}
+
+// handlePushAnswer is a function that passes an answer like
+// push-ready <mini server address>
+// push-refused <mini server address> <reason>
+// to the download that is waiting for it
+func (c *Client) handlePushAnswer(response string) {
+	if strings.HasPrefix(response, pushRefusedPrefix) {
+		c.handleRefusal(pushCommand, pushRefusedPrefix, response)
+		return
+	}
+	c.passAnswer(pushCommand, strings.TrimSpace(strings.TrimPrefix(response, pushReadyPrefix)), trackerAnswer{})
+}
+
+// dialThroughPush is a function that asks the holder of the mini server at "address", through the central server,
+// to connect to the mini server of the client and returns that connection,
+// over which the transfer continues as if the client had connected to the mini server at "address"
+//    (***) Returns error if:
+//        - the client is not connected to a central server
+//        - the central server did not answer in time or refused the request
+//        - the holder did not connect in time
+func (c *Client) dialThroughPush(address string) (net.Conn, *bufio.Reader, error) {
+	random := make([]byte, pushTokenLength)
+	if _, err := rand.Read(random); err != nil {
+		return nil, nil, fmt.Errorf("Could not generate push token. %w", err)
+	}
+	token := hex.EncodeToString(random)
+
+	pushed := make(chan pushedConnection, 1)
+	c.pushesMutex.Lock()
+	c.pushes[token] = pushed
+	c.pushesMutex.Unlock()
+
+	// a push accepted before the token is deleted is already in "pushed", a later one is refused by "acceptPush"
+	stopWaiting := func() {
+		c.pushesMutex.Lock()
+		delete(c.pushes, token)
+		c.pushesMutex.Unlock()
+
+		select {
+		case late := <-pushed:
+			late.conn.Close()
+		default:
+		}
+	}
+
+	if _, err := c.askServer(pushCommand, address, token); err != nil {
+		stopWaiting()
+		return nil, nil, err
+	}
+
+	select {
+	case connection := <-pushed:
+		return connection.conn, connection.reader, nil
+	case <-time.After(pushWaitTimeout):
+		stopWaiting()
+		return nil, nil, errors.New("The holder did not connect to the mini server")
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+// createTestClient is a function that returns a client connected to a central server played by the test
+// and a reader over the commands the client sends to it
+func createTestClient(t *testing.T) (*Client, *bufio.Reader) {
+	t.Helper()
+
+	c := CreateNewClient("", nil, logging.CreateDiscardLogger(), "", nil, "", nil)
+	trackerEnd, clientEnd := net.Pipe()
+	t.Cleanup(func() {
+		trackerEnd.Close()
+		clientEnd.Close()
+	})
+	c.useServer(clientEnd)
+
+	return c, bufio.NewReader(trackerEnd)
+}
+
+// answerPush is a function that reads the push request of "c" and answers that the holder was asked to push
+func answerPush(t *testing.T, c *Client, tracker *bufio.Reader, tokens chan<- string) {
+	request, err := tracker.ReadString('\n')
+	if err != nil {
+		t.Error(err)
+		close(tokens)
+		return
+	}
+
+	fields := strings.Fields(request)
+	if len(fields) != 3 || fields[0] != pushCommand || fields[1] != "127.0.0.1:9000" {
+		t.Errorf("unexpected push request %q", request)
+		close(tokens)
+		return
+	}
+	c.handlePushAnswer(pushReadyPrefix + fields[1] + "\n")
+	tokens <- fields[2]
+}
+
+// push is a function that connects to the mini server of "c" like a holder pushing with "token" and returns the end of the holder
+func push(t *testing.T, c *Client, token string) net.Conn {
+	t.Helper()
+
+	holderEnd, miniServerEnd := net.Pipe()
+	go c.miniServerHandleDownloadRequest(miniServerEnd)
+	if _, err := holderEnd.Write([]byte(pushJoinPrefix + token + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	return holderEnd
+}
+
+func TestDialThroughPush(t *testing.T) {
+	c, tracker := createTestClient(t)
+	tokens := make(chan string, 1)
+	go answerPush(t, c, tracker, tokens)
+
+	holders := make(chan net.Conn, 1)
+	go func() {
+		if token, ok := <-tokens; ok {
+			holders <- push(t, c, token)
+		}
+	}()
+
+	conn, reader, err := c.dialThroughPush("127.0.0.1:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	holder := <-holders
+	go holder.Write([]byte("the content\n"))
+	if line, err := reader.ReadString('\n'); err != nil || line != "the content\n" {
+		t.Errorf("expected to read what the holder pushed, got %q and %v", line, err)
+	}
+}
+
+func TestDialThroughPushTimesOut(t *testing.T) {
+	c, tracker := createTestClient(t)
+	tokens := make(chan string, 1)
+	go answerPush(t, c, tracker, tokens)
+
+	started := time.Now()
+	if _, _, err := c.dialThroughPush("127.0.0.1:9000"); err == nil {
+		t.Fatal("expected an error when the holder does not connect")
+	}
+	if waited := time.Since(started); waited < pushWaitTimeout {
+		t.Errorf("expected to wait for the holder %s, waited %s", pushWaitTimeout, waited)
+	}
+
+	// a holder that connects too late is refused and its connection is closed
+	holder := push(t, c, <-tokens)
+	holder.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := holder.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the late connection to be closed, got %v", err)
+	}
+
+	c.pushesMutex.Lock()
+	defer c.pushesMutex.Unlock()
+	if len(c.pushes) != 0 {
+		t.Errorf("expected no download to wait for a push, got %d", len(c.pushes))
+	}
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	relayCommand       = "relay"
+	relayRequestPrefix = "relay-request "
+	relayReadyPrefix   = "relay-ready "
+	relayRefusedPrefix = "relay-refused "
+	relayJoinPrefix    = "relay "
+
+	// how long the client waits for the central server to answer a relay or push request
+	answerTimeout = 10 * time.Second
+)
+
+// trackerAnswer is a struct that contains:
+//    - token   - the token both clients join the relayed transfer with, empty in other answers
+//    - port    - the port the central server relays transfers on, empty in other answers
+//    - refusal - why the central server refused the request, empty if it did not
+type trackerAnswer struct {
+	token   string
+	port    string
+	refusal string
+}
+
+// trackerHost is a function that returns the host of the central server the client is connected to, empty while not connected
+func (c *Client) trackerHost() string {
+	c.serverWriterMutex.Lock()
+	defer c.serverWriterMutex.Unlock()
+
+	return c.tracker
+}
+
+// joinRelay is a function that answers a line like
+// relay-request <token> <port>
+// with which the central server asks the mini server to send a file to a peer that could not connect to it.
+// The mini server joins the relay and handles the request of the peer as if the peer had connected directly.
+func (c *Client) joinRelay(response string) {
+	fields := strings.Fields(strings.TrimPrefix(response, relayRequestPrefix))
+	if len(fields) != 2 {
+		c.logger.Warn("Malformed relay request", "component", "relay", "response", strings.TrimSpace(response))
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.trackerHost(), fields[1]), dialTimeout)
+	if err != nil {
+		c.logger.Warn("Could not join relay", "component", "relay", "error", err)
+		return
+	}
+	if _, err := conn.Write([]byte(relayJoinPrefix + fields[0] + "\n")); err != nil {
+		c.logger.Warn("Could not join relay", "component", "relay", "error", err)
+		conn.Close()
+		return
+	}
+
+	c.logger.Debug("Joined relay", "component", "relay")
+	c.miniServerHandleDownloadRequest(conn)
+}
+
+// handleRelayAnswer is a function that passes an answer like
+// relay-ready <mini server address> <token> <port>
+// relay-refused <mini server address> <reason>
+// to the download that is waiting for it
+func (c *Client) handleRelayAnswer(response string) {
+	if strings.HasPrefix(response, relayRefusedPrefix) {
+		c.handleRefusal(relayCommand, relayRefusedPrefix, response)
+		return
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(response, relayReadyPrefix))
+	if len(fields) != 3 {
+		c.logger.Warn("Malformed relay answer", "component", "relay", "response", strings.TrimSpace(response))
+		return
+	}
+	c.passAnswer(relayCommand, fields[0], trackerAnswer{token: fields[1], port: fields[2]})
+}
+
+// handleRefusal is a function that passes an answer like
+// <refused prefix><mini server address> <reason>
+// to the download that is waiting for the answer to "command"
+func (c *Client) handleRefusal(command, refusedPrefix, response string) {
+	fields := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(response, refusedPrefix)), " ", 2)
+	if len(fields) != 2 {
+		c.logger.Warn("Malformed answer", "component", command, "response", strings.TrimSpace(response))
+		return
+	}
+	c.passAnswer(command, fields[0], trackerAnswer{refusal: fields[1]})
+}
+
+// passAnswer is a function that passes "answer" to the first download waiting for the answer to "command" about the mini server at "address"
+func (c *Client) passAnswer(command, address string, answer trackerAnswer) {
+	key := command + " " + address
+
+	c.answersMutex.Lock()
+	defer c.answersMutex.Unlock()
+
+	waiting := c.answers[key]
+	if len(waiting) == 0 {
+		return
+	}
+	waiting[0] <- answer
+	if len(waiting) == 1 {
+		delete(c.answers, key)
+	} else {
+		c.answers[key] = waiting[1:]
+	}
+}
+
+// stopWaiting is a function that removes "answers" from the downloads waiting for the answer to the request with "key"
+func (c *Client) stopWaiting(key string, answers chan trackerAnswer) {
+	c.answersMutex.Lock()
+	defer c.answersMutex.Unlock()
+
+	waiting := make([]chan trackerAnswer, 0, len(c.answers[key]))
+	for _, other := range c.answers[key] {
+		if other != answers {
+			waiting = append(waiting, other)
+		}
+	}
+	if len(waiting) == 0 {
+		delete(c.answers, key)
+	} else {
+		c.answers[key] = waiting
+	}
+}
+
+// askServer is a function that sends "command" about the mini server at "address" to the central server and returns its answer
+//    (***) Returns error if:
+//        - the client is not connected to a central server
+//        - the central server did not answer in time or refused the request
+func (c *Client) askServer(command, address string, arguments ...string) (trackerAnswer, error) {
+	key := command + " " + address
+	answers := make(chan trackerAnswer, 1)
+	c.answersMutex.Lock()
+	c.answers[key] = append(c.answers[key], answers)
+	c.answersMutex.Unlock()
+
+	request := strings.Join(append([]string{command, address}, arguments...), " ")
+	if err := c.sendToServer(request + "\n"); err != nil {
+		c.stopWaiting(key, answers)
+		return trackerAnswer{}, err
+	}
+
+	var answer trackerAnswer
+	select {
+	case answer = <-answers:
+	case <-time.After(answerTimeout):
+		c.stopWaiting(key, answers)
+		return trackerAnswer{}, fmt.Errorf("The server did not answer the %s request", command)
+	}
+	if answer.refusal != "" {
+		return trackerAnswer{}, fmt.Errorf("The server refused the %s request. %s", command, answer.refusal)
+	}
+	return answer, nil
+}
+
+// dialThroughRelay is a function that asks the central server to relay a transfer from the mini server at "address"
+// and returns a connection, over which the transfer continues as if the client had connected to the mini server directly
+//    (***) Returns error if:
+//        - the client is not connected to a central server
+//        - the central server did not answer in time or refused to relay
+//        - the relay cannot be connected to
+func (c *Client) dialThroughRelay(address string) (net.Conn, error) {
+	answer, err := c.askServer(relayCommand, address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.trackerHost(), answer.port), dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to relay. %w", err)
+	}
+	if _, err := conn.Write([]byte(relayJoinPrefix + answer.token + "\n")); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Could not join relay. %w", err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/ticket"
+)
+
+const (
+	ticketKeyPrefix     = "ticket-key "
+	ticketRequestPrefix = "ticket "
+)
+
+var errNoTicketKey = errors.New("the central server has not announced its ticket key yet")
+
+// handleTicketKey is a function that stores the public key from a response like
+// ticket-key 0123abcd...
+func (c *Client) handleTicketKey(response string) {
+	key, err := ticket.DecodePublicKey(strings.TrimSpace(strings.TrimPrefix(response, ticketKeyPrefix)))
+	if err != nil {
+		c.logger.Warn("Malformed ticket key", "component", "tracker", "error", err)
+		return
+	}
+
+	c.ticketKeyMutex.Lock()
+	defer c.ticketKeyMutex.Unlock()
+
+	c.ticketKey = key
+}
+
+func (c *Client) getTicketKey() ed25519.PublicKey {
+	c.ticketKeyMutex.RLock()
+	defer c.ticketKeyMutex.RUnlock()
+
+	return c.ticketKey
+}
+
+// authorize is a function that:
+//    - accepts:
+//         - encodedTicket - the ticket sent by the peer that wants to download a file
+//         - pathToFile    - the path of the requested file
+//    - returns the verified ticket
+//    (***) Returns error if the ticket was not signed by the central server, has expired or is not for "pathToFile" on this mini server
+func (c *Client) authorize(encodedTicket, pathToFile string) (ticket.Ticket, error) {
+	key := c.getTicketKey()
+	if key == nil {
+		return ticket.Ticket{}, errNoTicketKey
+	}
+
+	verified, err := ticket.Verify(key, encodedTicket, time.Now())
+	if err != nil {
+		return verified, err
+	}
+	if verified.Holder != c.miniServerAddress {
+		return verified, fmt.Errorf("the ticket is for mini server %s", verified.Holder)
+	}
+	if verified.File != pathToFile {
+		return verified, errors.New("the ticket is for another file")
+	}
+
+	return verified, nil
+}
+
+// parseDownloadRequest is a function that splits a request like
+// ticket eyJyZXF1ZXN0ZXIi... /path/to/file
+// into its ticket and file path
+func parseDownloadRequest(request string) (string, string, bool) {
+	if !strings.HasPrefix(request, ticketRequestPrefix) {
+		return "", request, false
+	}
+
+	split := strings.SplitN(strings.TrimPrefix(request, ticketRequestPrefix), " ", 2)
+	if len(split) != 2 {
+		return "", request, false
+	}
+	return split[0], split[1], true
+}
+
+func downloadRequest(encodedTicket, pathToFile string) string {
+	return ticketRequestPrefix + encodedTicket + " " + pathToFile + "\n"
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/imaikeru/peer-to-peer/client/content"
+	"github.com/imaikeru/peer-to-peer/client/torrent"
+)
+
+const (
+	torrentCommand = "torrent"
+
+	torrentFileIndex = 0
+	torrentSaveIndex = 1
+)
+
+func isTorrentFile(path string) bool {
+	return strings.HasSuffix(path, torrent.Extension)
+}
+
+// exportTorrent is a function that saves the ".torrent" metainfo of a registered file for a request like
+// torrent "/path/to/file" "/path/to/file.torrent"
+func (c *Client) exportTorrent(request string) {
+	arguments := quotedArguments(request)
+	path := arguments[torrentFileIndex]
+
+	c.linksMutex.Lock()
+	link, registered := c.links[path]
+	c.linksMutex.Unlock()
+
+	if !registered {
+		fmt.Println("Register the file before exporting its metainfo, so that it can be downloaded.")
+		return
+	}
+
+	metainfo, err := torrent.Create(path, c.announceURL, torrent.DefaultPieceLength, link.ID)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := metainfo.SaveTo(arguments[torrentSaveIndex]); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Saved the metainfo of %s, info hash %x.\n", metainfo.Name, metainfo.InfoHash())
+}
+
+// downloadTorrent is a function that downloads the file described by the ".torrent" metainfo at "torrentPath" to "pathToSave",
+// finding its holders through the central server
+func (c *Client) downloadTorrent(torrentPath, pathToSave string) {
+	metainfo, err := torrent.LoadFrom(torrentPath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if metainfo.ContentID == "" {
+		c.downloadByInfoHash(fmt.Sprintf("%x", metainfo.InfoHash()), pathToSave)
+		return
+	}
+
+	c.downloadLink(content.Link{ID: metainfo.ContentID, Name: metainfo.Name, Size: metainfo.Length}, pathToSave)
+}
+
+// downloadByInfoHash is a function that asks the central server who holds the file with BitTorrent info hash "infoHash".
+// It is used for metainfo that carries no content ID, e.g. one made by another BitTorrent client for the same file.
+func (c *Client) downloadByInfoHash(infoHash, pathToSave string) {
+	c.pendingDownloadsMutex.Lock()
+	c.pendingDownloads[infoHash] = append(c.pendingDownloads[infoHash], pathToSave)
+	c.pendingDownloadsMutex.Unlock()
+
+	if err := c.sendToServer("locate-torrent " + infoHash + "\n"); err != nil {
+		c.logger.Error("Error occurred while trying to write to server", "component", "tracker", "error", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Package compression negotiates how a file is compressed while it is sent between peers
+// and leaves out files that are compressed already.
+package compression
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Identity is the encoding of files that are sent as they are
+	Identity = "identity"
+	// Gzip is the encoding of files compressed with gzip
+	Gzip = "gzip"
+	// Deflate is the encoding of files compressed with raw DEFLATE
+	Deflate = "deflate"
+
+	// SniffLength is how many bytes from the start of a file are enough for recognizing its format
+	SniffLength = 512
+)
+
+// Supported are the encodings a peer can compress with, the preferred one first
+var Supported = []string{Gzip, Deflate}
+
+// compressedExtensions are the extensions of formats that are compressed already
+var compressedExtensions = map[string]struct{}{
+	".gz": {}, ".tgz": {}, ".zip": {}, ".bz2": {}, ".xz": {}, ".zst": {}, ".7z": {}, ".rar": {},
+	".jpg": {}, ".jpeg": {}, ".png": {}, ".gif": {}, ".webp": {}, ".mp3": {}, ".ogg": {}, ".flac": {},
+	".mp4": {}, ".mkv": {}, ".avi": {}, ".mov": {}, ".webm": {}, ".pdf": {}, ".docx": {}, ".xlsx": {},
+	".pptx": {}, ".jar": {}, ".apk": {},
+}
+
+// compressedTypes are the sniffed MIME types, or their prefixes, of formats that are compressed already
+var compressedTypes = []string{
+	"image/", "audio/", "video/", "font/",
+	"application/zip", "application/x-gzip", "application/x-rar-compressed", "application/pdf", "application/wasm",
+}
+
+// Choose is a function that returns the first of the "Supported" encodings that is in "offered", "Identity" if there is none
+func Choose(offered []string) string {
+	for _, encoding := range Supported {
+		for _, offer := range offered {
+			if offer == encoding {
+				return encoding
+			}
+		}
+	}
+	return Identity
+}
+
+// Compressible is a function that returns whether compressing the file at "path", which starts with "head", can make it smaller.
+// Files with the extension of a compressed format and files whose content is sniffed as one are not compressible.
+func Compressible(path string, head []byte) bool {
+	if _, ok := compressedExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+		return false
+	}
+
+	sniffed := http.DetectContentType(head)
+	for _, compressedType := range compressedTypes {
+		if strings.HasPrefix(sniffed, compressedType) {
+			return false
+		}
+	}
+	return true
+}
+
+// nopCloser is an io.WriteCloser whose Close does nothing
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// NewWriter is a function that returns a writer, which compresses what is written to it with "encoding" and writes it to "w".
+// Closing the writer flushes the compressed data, but does not close "w".
+//    (***) Returns error if the encoding is not supported
+func NewWriter(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case Identity:
+		return nopCloser{w}, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Deflate:
+		return flate.NewWriter(w, flate.DefaultCompression)
+	}
+	return nil, fmt.Errorf("Unsupported encoding %q", encoding)
+}
+
+// NewReader is a function that returns a reader, which decompresses what is read from "r" with "encoding"
+//    (***) Returns error if the encoding is not supported or "r" does not start with valid compressed data
+func NewReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case Identity:
+		return ioutil.NopCloser(r), nil
+	case Gzip:
+		reader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read gzip data. %w", err)
+		}
+		return reader, nil
+	case Deflate:
+		return flate.NewReader(r), nil
+	}
+	return nil, fmt.Errorf("Unsupported encoding %q", encoding)
+}
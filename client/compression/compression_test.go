@@ -0,0 +1,88 @@
+package compression_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/imaikeru/peer-to-peer/client/compression"
+)
+
+func TestEncodingsRoundTrip(t *testing.T) {
+	original := []byte(strings.Repeat("time=2024-01-01T00:00:00Z level=info msg=\"Sent file\" bytes=4096\n", 200))
+
+	for _, encoding := range []string{compression.Identity, compression.Gzip, compression.Deflate} {
+		t.Run(encoding, func(t *testing.T) {
+			var sent bytes.Buffer
+			writer, err := compression.NewWriter(encoding, &sent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := writer.Write(original); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if encoding != compression.Identity && sent.Len() >= len(original)/10 {
+				t.Errorf("expected repetitive text to compress at least 10x, got %d of %d bytes", sent.Len(), len(original))
+			}
+
+			reader, err := compression.NewReader(encoding, &sent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			received, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(received, original) {
+				t.Errorf("got %d different bytes back, want the %d original ones", len(received), len(original))
+			}
+		})
+	}
+}
+
+func TestChoose(t *testing.T) {
+	var tests = []struct {
+		offered  []string
+		expected string
+	}{
+		{[]string{"deflate", "gzip"}, compression.Gzip},
+		{[]string{"zstd", "deflate"}, compression.Deflate},
+		{[]string{"zstd"}, compression.Identity},
+		{nil, compression.Identity},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.offered, ","), func(t *testing.T) {
+			if got := compression.Choose(tt.offered); got != tt.expected {
+				t.Errorf("got %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	var tests = []struct {
+		path     string
+		head     []byte
+		expected bool
+	}{
+		{"/logs/server.log", []byte("time=2024-01-01 level=info\n"), true},
+		{"/data/report.csv", []byte("id,name,size\n1,bob,42\n"), true},
+		{"/backups/logs.tar.GZ", []byte("anything"), false},
+		{"/photos/holiday.JPG", []byte("anything"), false},
+		{"/downloads/archive", []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00"), false},
+		{"/downloads/picture", []byte("\x89PNG\r\n\x1a\n"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := compression.Compressible(tt.path, tt.head); got != tt.expected {
+				t.Errorf("got %t, want %t", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Package content identifies files by their content and builds the shareable "p2p:" links that point to them.
+package content
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	linkScheme  = "p2p:"
+	idPrefix    = "urn:sha256:"
+	idParameter = "xt"
+	// the name and the size follow the naming of magnet links
+	nameParameter = "dn"
+	sizeParameter = "xl"
+)
+
+var idRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ErrNotALink is returned for text that is not a "p2p:" link
+var ErrNotALink = errors.New("not a p2p: link")
+
+// Link is a struct that contains:
+//    - ID   - the hex encoded SHA-256 hash of the content of the file
+//    - Name - the name of the file without its directory
+//    - Size - the size of the file in bytes
+type Link struct {
+	ID   string
+	Name string
+	Size int64
+}
+
+// Describe is a function that:
+//    - accepts:
+//         - path - path to a file
+//    - returns the Link of the file, computing the hash of its whole content
+//    (***) Returns error if the file cannot be read
+func Describe(path string) (Link, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Link{}, fmt.Errorf("Could not open %s. %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return Link{}, fmt.Errorf("Could not read %s. %w", path, err)
+	}
+
+	return Link{
+		ID:   hex.EncodeToString(hash.Sum(nil)),
+		Name: filepath.Base(path),
+		Size: size,
+	}, nil
+}
+
+// String is a function that returns the Link as a URI like
+// p2p:?xt=urn:sha256:<id>&dn=<name>&xl=<size>
+func (l Link) String() string {
+	return fmt.Sprintf("%s?%s=%s%s&%s=%s&%s=%d",
+		linkScheme, idParameter, idPrefix, l.ID, nameParameter, url.QueryEscape(l.Name), sizeParameter, l.Size)
+}
+
+// IsLink is a function that returns whether "text" looks like a "p2p:" link
+func IsLink(text string) bool {
+	return strings.HasPrefix(text, linkScheme)
+}
+
+// Parse is a function that:
+//    - accepts:
+//         - text - a URI returned by Link.String
+//    - returns the Link
+//    (***) Returns error if "text" is not a valid "p2p:" link
+func Parse(text string) (Link, error) {
+	if !IsLink(text) {
+		return Link{}, ErrNotALink
+	}
+
+	query, err := url.ParseQuery(strings.TrimPrefix(strings.TrimPrefix(text, linkScheme), "?"))
+	if err != nil {
+		return Link{}, fmt.Errorf("Invalid p2p: link. %w", err)
+	}
+
+	id := strings.TrimPrefix(query.Get(idParameter), idPrefix)
+	if !idRegex.MatchString(id) {
+		return Link{}, fmt.Errorf("Invalid p2p: link. %q is not a SHA-256 content ID", id)
+	}
+
+	link := Link{ID: id, Name: query.Get(nameParameter)}
+	if sizeText := query.Get(sizeParameter); sizeText != "" {
+		if link.Size, err = strconv.ParseInt(sizeText, 10, 64); err != nil || link.Size < 0 {
+			return Link{}, fmt.Errorf("Invalid p2p: link. %q is not a size in bytes", sizeText)
+		}
+	}
+
+	return link, nil
+}
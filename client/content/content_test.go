@@ -0,0 +1,62 @@
+package content_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imaikeru/peer-to-peer/client/content"
+)
+
+func TestDescribeAndParseRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "my report & notes.txt")
+	if err := ioutil.WriteFile(path, []byte("hello-world\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := content.Describe(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := content.Link{
+		ID:   "d79f2e37784e5cd8631963896ebc6c9c66934af94a1854504717eaec04bc3d09",
+		Name: "my report & notes.txt",
+		Size: 12,
+	}
+	if link != expected {
+		t.Fatalf("got %+v, want %+v", link, expected)
+	}
+
+	parsed, err := content.Parse(link.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != link {
+		t.Errorf("got %+v, want %+v", parsed, link)
+	}
+}
+
+func TestParseRejectsInvalidLinks(t *testing.T) {
+	var tests = []string{
+		"http://example.com",
+		"p2p:?xt=urn:sha256:abc",
+		"p2p:?dn=file.txt",
+		"p2p:?xt=urn:sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef" + "&xl=-1",
+	}
+
+	for _, link := range tests {
+		t.Run(link, func(t *testing.T) {
+			if _, err := content.Parse(link); err == nil {
+				t.Errorf("expected an error for %s", link)
+			}
+		})
+	}
+}
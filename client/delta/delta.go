@@ -0,0 +1,394 @@
+// Package delta computes rsync-style differences between an old copy of a file and its new version,
+// so that only the changed parts of a file have to be sent to a peer that has an old copy.
+//
+// The peer with the old copy sends its Signature, the checksums of its blocks. The peer with the new version finds
+// these blocks anywhere in the new version with a rolling checksum and sends the delta, which copies the blocks
+// the old copy has and contains everything else. The delta ends with the SHA-256 hash of the new version.
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// MinBlockSize is the smallest block the old copy is split into
+	MinBlockSize = 1 << 10
+	// MaxBlockSize is the largest block the old copy is split into
+	MaxBlockSize = 1 << 17
+	// MaxBlocks is the most blocks a Signature may have
+	MaxBlocks = 1 << 20
+
+	strongLength = 16
+	// the most bytes of the new version sent in a single data operation
+	maxLiteral = 1 << 16
+
+	opCopy byte = 'C'
+	opData byte = 'D'
+	opEnd  byte = 'E'
+)
+
+// ErrCorrupted is returned when the new version built from the delta does not have the hash the delta ends with
+var ErrCorrupted = errors.New("the patched file does not match the new version")
+
+// Block is a struct that contains:
+//    - Weak   - the rolling checksum of the block
+//    - Strong - the first 16 bytes of the SHA-256 hash of the block
+type Block struct {
+	Weak   uint32
+	Strong [strongLength]byte
+}
+
+// Signature is a struct that contains:
+//    - BlockSize - the size of the blocks the old copy is split into, only its last block may be shorter
+//    - Size      - the size of the old copy
+//    - Blocks    - the checksums of the blocks of the old copy, in order
+type Signature struct {
+	BlockSize int
+	Size      int64
+	Blocks    []Block
+}
+
+// Stats is a struct that contains:
+//    - Copied  - how many bytes of the new version were copied from the old copy
+//    - Literal - how many bytes of the new version were sent in the delta
+type Stats struct {
+	Copied  int64
+	Literal int64
+}
+
+// BlockSizeFor is a function that returns the size of the blocks an old copy of "size" bytes is split into,
+// about its square root, which balances the size of the Signature against the size of the delta
+func BlockSizeFor(size int64) int {
+	blockSize := int(math.Sqrt(float64(size)))
+	if blocks := (size + MaxBlocks - 1) / MaxBlocks; int64(blockSize) < blocks {
+		blockSize = int(blocks)
+	}
+	if blockSize < MinBlockSize {
+		return MinBlockSize
+	}
+	if blockSize > MaxBlockSize {
+		return MaxBlockSize
+	}
+	return blockSize
+}
+
+func blockCount(size int64, blockSize int) int64 {
+	return (size + int64(blockSize) - 1) / int64(blockSize)
+}
+
+// blockLength is a function that returns the length of the block with index "index"
+func (s *Signature) blockLength(index int) int {
+	if index == len(s.Blocks)-1 {
+		return int(s.Size - int64(index)*int64(s.BlockSize))
+	}
+	return s.BlockSize
+}
+
+// weakChecksum is a function that returns the rolling checksum of "block" and its two halves
+func weakChecksum(block []byte) (uint32, uint32, uint32) {
+	var a, b uint32
+	for i, x := range block {
+		a += uint32(x)
+		b += uint32(len(block)-i) * uint32(x)
+	}
+	a, b = a&0xffff, b&0xffff
+	return b<<16 | a, a, b
+}
+
+func strongChecksum(block []byte) [strongLength]byte {
+	var strong [strongLength]byte
+	sum := sha256.Sum256(block)
+	copy(strong[:], sum[:])
+	return strong
+}
+
+// Sign is a function that returns the Signature of the old copy, which is read from "r" and has "size" bytes
+//    (***) Returns error if "r" cannot be read or the old copy is too large
+func Sign(r io.Reader, size int64) (*Signature, error) {
+	blockSize := BlockSizeFor(size)
+	if blockCount(size, blockSize) > MaxBlocks {
+		return nil, fmt.Errorf("The file has more than %d blocks of %d bytes", MaxBlocks, blockSize)
+	}
+
+	signature := &Signature{BlockSize: blockSize, Blocks: make([]Block, 0, blockCount(size, blockSize))}
+	block := make([]byte, blockSize)
+	for {
+		read, err := io.ReadFull(r, block)
+		if read > 0 {
+			if len(signature.Blocks) == MaxBlocks {
+				return nil, fmt.Errorf("The file has more than %d blocks of %d bytes", MaxBlocks, blockSize)
+			}
+			weak, _, _ := weakChecksum(block[:read])
+			signature.Blocks = append(signature.Blocks, Block{Weak: weak, Strong: strongChecksum(block[:read])})
+			signature.Size += int64(read)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return signature, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read the file. %w", err)
+		}
+	}
+}
+
+// WriteTo is a function that writes the Signature to "w" and returns how many bytes were written
+func (s *Signature) WriteTo(w io.Writer) (int64, error) {
+	encoded := make([]byte, 0, 2*binary.MaxVarintLen64+len(s.Blocks)*(4+strongLength))
+	encoded = appendUvarint(encoded, uint64(s.BlockSize))
+	encoded = appendUvarint(encoded, uint64(s.Size))
+	for _, block := range s.Blocks {
+		var weak [4]byte
+		binary.BigEndian.PutUint32(weak[:], block.Weak)
+		encoded = append(append(encoded, weak[:]...), block.Strong[:]...)
+	}
+
+	written, err := w.Write(encoded)
+	return int64(written), err
+}
+
+// ReadSignature is a function that reads a Signature written with "WriteTo" from "r"
+//    (***) Returns error if "r" cannot be read or does not contain a valid Signature
+func ReadSignature(r *bufio.Reader) (*Signature, error) {
+	blockSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read signature. %w", err)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read signature. %w", err)
+	}
+	if blockSize < MinBlockSize || blockSize > MaxBlockSize || size > math.MaxInt64 || blockCount(int64(size), int(blockSize)) > MaxBlocks {
+		return nil, fmt.Errorf("Invalid signature of %d bytes in blocks of %d bytes", size, blockSize)
+	}
+
+	signature := &Signature{BlockSize: int(blockSize), Size: int64(size), Blocks: make([]Block, blockCount(int64(size), int(blockSize)))}
+	var encoded [4 + strongLength]byte
+	for i := range signature.Blocks {
+		if _, err := io.ReadFull(r, encoded[:]); err != nil {
+			return nil, fmt.Errorf("Could not read signature. %w", err)
+		}
+		signature.Blocks[i].Weak = binary.BigEndian.Uint32(encoded[:4])
+		copy(signature.Blocks[i].Strong[:], encoded[4:])
+	}
+	return signature, nil
+}
+
+func appendUvarint(encoded []byte, value uint64) []byte {
+	var buffer [binary.MaxVarintLen64]byte
+	return append(encoded, buffer[:binary.PutUvarint(buffer[:], value)]...)
+}
+
+// encoder is a struct that contains:
+//    - out        - where the operations of the delta are written
+//    - copyStart  - the index of the first block of the copy operation that is not written yet
+//    - copyLength - how many blocks the copy operation that is not written yet has, 0 if there is none
+type encoder struct {
+	out        *bufio.Writer
+	copyStart  int
+	copyLength int
+}
+
+// copyBlock is a function that adds a copy of the block with index "index" to the delta,
+// merging copies of consecutive blocks into a single operation
+func (e *encoder) copyBlock(index int) {
+	if e.copyLength > 0 && index == e.copyStart+e.copyLength {
+		e.copyLength++
+		return
+	}
+	e.flushCopy()
+	e.copyStart, e.copyLength = index, 1
+}
+
+func (e *encoder) flushCopy() {
+	if e.copyLength == 0 {
+		return
+	}
+	e.out.WriteByte(opCopy)
+	e.out.Write(appendUvarint(appendUvarint(nil, uint64(e.copyStart)), uint64(e.copyLength)))
+	e.copyLength = 0
+}
+
+func (e *encoder) data(literal []byte) {
+	if len(literal) == 0 {
+		return
+	}
+	e.flushCopy()
+	e.out.WriteByte(opData)
+	e.out.Write(appendUvarint(nil, uint64(len(literal))))
+	e.out.Write(literal)
+}
+
+// Diff is a function that writes the delta between the old copy with Signature "signature" and the new version,
+// which is read from "r", to "w"
+//    (***) Returns error if "r" cannot be read or "w" cannot be written
+func Diff(signature *Signature, r io.Reader, w io.Writer) error {
+	index := make(map[uint32][]int, len(signature.Blocks))
+	for i, block := range signature.Blocks {
+		index[block.Weak] = append(index[block.Weak], i)
+	}
+	findBlock := func(weak uint32, window []byte) (int, bool) {
+		candidates, ok := index[weak]
+		if !ok {
+			return 0, false
+		}
+		strong := strongChecksum(window)
+		for _, i := range candidates {
+			if signature.blockLength(i) == len(window) && signature.Blocks[i].Strong == strong {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+
+	hash := sha256.New()
+	in := bufio.NewReaderSize(io.TeeReader(r, hash), signature.BlockSize)
+	e := &encoder{out: bufio.NewWriter(w)}
+	e.out.Write(appendUvarint(nil, uint64(signature.BlockSize)))
+
+	// pending holds the bytes that are not sent yet: the literal data before "start" and the window after it
+	pending := make([]byte, 0, maxLiteral+signature.BlockSize)
+	start := 0
+	fresh := true
+	eof := false
+	var a, b uint32
+	for {
+		if fresh {
+			for !eof && len(pending)-start < signature.BlockSize {
+				x, err := in.ReadByte()
+				if err == io.EOF {
+					eof = true
+				} else if err != nil {
+					return fmt.Errorf("Could not read the file. %w", err)
+				} else {
+					pending = append(pending, x)
+				}
+			}
+			_, a, b = weakChecksum(pending[start:])
+			fresh = false
+		}
+
+		window := pending[start:]
+		if len(window) == 0 {
+			break
+		}
+		if i, ok := findBlock(b<<16|a, window); ok {
+			e.data(pending[:start])
+			e.copyBlock(i)
+			pending, start, fresh = pending[:0], 0, true
+			continue
+		}
+
+		// slide the window by one byte, which becomes literal data
+		first, length := uint32(pending[start]), uint32(len(window))
+		start++
+		a -= first
+		b -= length * first
+		if !eof {
+			if x, err := in.ReadByte(); err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return fmt.Errorf("Could not read the file. %w", err)
+			} else {
+				pending = append(pending, x)
+				a += uint32(x)
+				b += a
+			}
+		}
+		a, b = a&0xffff, b&0xffff
+
+		if start >= maxLiteral {
+			e.data(pending[:start])
+			pending = append(pending[:0], pending[start:]...)
+			start = 0
+		}
+	}
+
+	e.data(pending[:start])
+	e.flushCopy()
+	e.out.WriteByte(opEnd)
+	e.out.Write(hash.Sum(nil))
+	return e.out.Flush()
+}
+
+// Patch is a function that builds the new version from the old copy "basis" and the delta, which is read from "r",
+// writes it to "w" and returns how much of it was copied from the old copy
+//    (***) Returns error if:
+//        - "r" cannot be read or does not contain a valid delta
+//        - the delta copies blocks the old copy does not have
+//        - the built new version does not have the hash the delta ends with
+func Patch(basis io.ReaderAt, r io.Reader, w io.Writer) (Stats, error) {
+	var stats Stats
+	in := bufio.NewReader(r)
+	blockSize, err := binary.ReadUvarint(in)
+	if err != nil {
+		return stats, fmt.Errorf("Could not read delta. %w", err)
+	}
+	if blockSize < MinBlockSize || blockSize > MaxBlockSize {
+		return stats, fmt.Errorf("Invalid delta with blocks of %d bytes", blockSize)
+	}
+
+	hash := sha256.New()
+	out := io.MultiWriter(w, hash)
+	for {
+		op, err := in.ReadByte()
+		if err != nil {
+			return stats, fmt.Errorf("Could not read delta. %w", err)
+		}
+
+		switch op {
+		case opCopy:
+			first, err := binary.ReadUvarint(in)
+			if err != nil {
+				return stats, fmt.Errorf("Could not read delta. %w", err)
+			}
+			count, err := binary.ReadUvarint(in)
+			if err != nil {
+				return stats, fmt.Errorf("Could not read delta. %w", err)
+			}
+			if first >= MaxBlocks || count == 0 || count > MaxBlocks-first {
+				return stats, fmt.Errorf("Invalid copy of %d blocks from block %d", count, first)
+			}
+
+			copied, err := io.Copy(out, io.NewSectionReader(basis, int64(first*blockSize), int64(count*blockSize)))
+			if err != nil {
+				return stats, fmt.Errorf("Could not copy from the old copy. %w", err)
+			}
+			if copied <= int64((count-1)*blockSize) {
+				return stats, fmt.Errorf("The old copy does not have blocks %d to %d", first, first+count-1)
+			}
+			stats.Copied += copied
+		case opData:
+			length, err := binary.ReadUvarint(in)
+			if err != nil {
+				return stats, fmt.Errorf("Could not read delta. %w", err)
+			}
+			if length == 0 || length > maxLiteral {
+				return stats, fmt.Errorf("Invalid data of %d bytes", length)
+			}
+
+			written, err := io.CopyN(out, in, int64(length))
+			stats.Literal += written
+			if err != nil {
+				return stats, fmt.Errorf("Could not read delta. %w", err)
+			}
+		case opEnd:
+			sum := make([]byte, sha256.Size)
+			if _, err := io.ReadFull(in, sum); err != nil {
+				return stats, fmt.Errorf("Could not read delta. %w", err)
+			}
+			if !bytes.Equal(sum, hash.Sum(nil)) {
+				return stats, ErrCorrupted
+			}
+			return stats, nil
+		default:
+			return stats, fmt.Errorf("Invalid delta operation %q", op)
+		}
+	}
+}
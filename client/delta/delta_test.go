@@ -0,0 +1,140 @@
+package delta_test
+
+import (
+	"bufio"
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/imaikeru/peer-to-peer/client/delta"
+)
+
+func randomBytes(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// sync is a function that sends "newVersion" to a peer that has "old" through a Signature and a delta
+// and returns what the peer built, how it was built and how large the delta was
+func sync(t *testing.T, old, newVersion []byte) ([]byte, delta.Stats, int) {
+	t.Helper()
+
+	signature, err := delta.Sign(bytes.NewReader(old), int64(len(old)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encodedSignature bytes.Buffer
+	if _, err := signature.WriteTo(&encodedSignature); err != nil {
+		t.Fatal(err)
+	}
+	received, err := delta.ReadSignature(bufio.NewReader(&encodedSignature))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var encodedDelta bytes.Buffer
+	if err := delta.Diff(received, bytes.NewReader(newVersion), &encodedDelta); err != nil {
+		t.Fatal(err)
+	}
+	deltaSize := encodedDelta.Len()
+
+	var patched bytes.Buffer
+	stats, err := delta.Patch(bytes.NewReader(old), &encodedDelta, &patched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return patched.Bytes(), stats, deltaSize
+}
+
+func TestPatchBuildsTheNewVersion(t *testing.T) {
+	old := randomBytes(1, 300000)
+	blockSize := delta.BlockSizeFor(int64(len(old)))
+
+	var tests = []struct {
+		name       string
+		newVersion []byte
+		// the most bytes the delta may send, since a change makes the blocks it touches differ
+		maxLiteral int
+	}{
+		{"unchanged", old, 0},
+		{"appended", join(old, []byte("new line\n")), blockSize + 9},
+		{"inserted in the middle", join(old[:100000], []byte("inserted"), old[100000:]), 2*blockSize + 8},
+		{"removed from the middle", join(old[:100000], old[100500:]), 2 * blockSize},
+		{"overwritten at the start", join([]byte("HEADER"), old[6:]), blockSize},
+		{"truncated", old[:123457], blockSize},
+		{"blocks reordered", join(old[200000:], old[:200000]), 2 * blockSize},
+		{"unrelated", randomBytes(2, 50000), 50000},
+		{"empty", []byte{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, stats, _ := sync(t, old, tt.newVersion)
+			if !bytes.Equal(patched, tt.newVersion) {
+				t.Fatalf("got %d bytes that differ from the %d bytes of the new version", len(patched), len(tt.newVersion))
+			}
+			if stats.Literal > int64(tt.maxLiteral) {
+				t.Errorf("expected at most %d bytes to be sent, got %d", tt.maxLiteral, stats.Literal)
+			}
+			if stats.Copied+stats.Literal != int64(len(tt.newVersion)) {
+				t.Errorf("expected %d copied and sent bytes, got %d copied and %d sent", len(tt.newVersion), stats.Copied, stats.Literal)
+			}
+		})
+	}
+}
+
+func TestDeltaOfSmallChangeIsSmall(t *testing.T) {
+	old := randomBytes(3, 4<<20)
+	newVersion := append([]byte(nil), old...)
+	copy(newVersion[2<<20:], "a colleague changed this")
+
+	_, _, deltaSize := sync(t, old, newVersion)
+	if deltaSize > 8*delta.BlockSizeFor(int64(len(old))) {
+		t.Errorf("expected a delta of a few blocks, got %d bytes for a %d bytes file", deltaSize, len(old))
+	}
+}
+
+func TestPatchRejectsCorruptedDelta(t *testing.T) {
+	old := randomBytes(4, 100000)
+	newVersion := join(old[:50000], []byte("changed"), old[50000:])
+
+	signature, err := delta.Sign(bytes.NewReader(old), int64(len(old)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encodedDelta bytes.Buffer
+	if err := delta.Diff(signature, bytes.NewReader(newVersion), &encodedDelta); err != nil {
+		t.Fatal(err)
+	}
+
+	// the old copy changed after it was signed
+	changedOld := append([]byte(nil), old...)
+	changedOld[10] ^= 0xff
+
+	var patched bytes.Buffer
+	if _, err := delta.Patch(bytes.NewReader(changedOld), &encodedDelta, &patched); err != delta.ErrCorrupted {
+		t.Errorf("expected %v, got %v", delta.ErrCorrupted, err)
+	}
+}
+
+func TestReadSignatureRejectsInvalidSignatures(t *testing.T) {
+	var tests = map[string][]byte{
+		"empty":                 {},
+		"too small blocks":      {0x10, 0x10},
+		"too many blocks":       {0x80, 0x08, 0xff, 0xff, 0xff, 0xff, 0x0f},
+		"missing block entries": {0x80, 0x08, 0x80, 0x10},
+	}
+
+	for name, encoded := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := delta.ReadSignature(bufio.NewReader(bytes.NewReader(encoded))); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,431 @@
+// Package dht implements a Kademlia distributed hash table over UDP, which lets peers find each other without the central server.
+// Nodes store records that map keys(e.g. content IDs) to values(e.g. mini server addresses) on the nodes whose IDs are the closest to the key.
+package dht
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// alpha is how many nodes are queried at once during a lookup
+	alpha = 3
+
+	maxMessageSize  = 64 * 1024
+	maxStoredKeys   = 10000
+	maxValuesPerKey = 64
+
+	pingMessage      = "ping"
+	pongMessage      = "pong"
+	findNodeMessage  = "find_node"
+	findValueMessage = "find_value"
+	nodesMessage     = "nodes"
+	storeMessage     = "store"
+	storedMessage    = "stored"
+)
+
+var (
+	// ErrNoPeers is returned when no other node answered
+	ErrNoPeers = errors.New("no DHT node answered")
+	// ErrTimeout is returned when a node did not answer in time
+	ErrTimeout = errors.New("the DHT node did not answer in time")
+	// ErrClosed is returned when the node has been closed
+	ErrClosed = errors.New("the DHT node is closed")
+)
+
+// message is a struct that contains:
+//    - Type        - the kind of the message, e.g. "find_node"
+//    - Transaction - the number that pairs a response with its request
+//    - Sender      - the ID of the node that sent the message
+//    - Target      - the ID or key that is looked up or stored
+//    - Value       - the value that is stored
+//    - Nodes       - the contacts that are the closest to "Target", sent in responses
+//    - Values      - the values stored under "Target", sent in responses
+type message struct {
+	Type        string    `json:"type"`
+	Transaction uint64    `json:"transaction"`
+	Sender      ID        `json:"sender"`
+	Target      *ID       `json:"target,omitempty"`
+	Value       string    `json:"value,omitempty"`
+	Nodes       []Contact `json:"nodes,omitempty"`
+	Values      []string  `json:"values,omitempty"`
+}
+
+// Node is a struct that contains:
+//    - id              - the ID of the node
+//    - connection      - the UDP socket the node sends and receives messages on
+//    - table           - the routing table with the other known nodes
+//    - records         - the records other nodes stored on this one
+//    - requestTimeout  - how long the node waits for an answer
+//    - recordTTL       - how long a stored record lives unless it is announced again
+//    - lastTransaction - the number of the last sent request
+//    - pending         - a map whose keys are numbers of sent requests and values receive the answers
+//    - pendingMutex    - a Mutex that is used for working safely with "pending"
+//    - closed          - closed when the node stops
+type Node struct {
+	id              ID
+	connection      *net.UDPConn
+	table           *routingTable
+	records         *records
+	requestTimeout  time.Duration
+	recordTTL       time.Duration
+	lastTransaction uint64
+	pending         map[uint64]chan message
+	pendingMutex    sync.Mutex
+	closed          chan struct{}
+}
+
+// CreateNode is a factory method that:
+//    - accepts:
+//         - address        - the UDP address to listen on, e.g. "127.0.0.1:0"
+//         - requestTimeout - how long to wait for an answer from another node
+//         - recordTTL      - how long records stored on the node live unless they are announced again
+//    - creates a node with a random ID and starts answering other nodes
+//    (***) Returns error if the address cannot be listened on
+func CreateNode(address string, requestTimeout, recordTTL time.Duration) (*Node, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	udpAddress, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid DHT address %s. %w", address, err)
+	}
+	connection, err := net.ListenUDP("udp", udpAddress)
+	if err != nil {
+		return nil, fmt.Errorf("Could not listen on %s. %w", address, err)
+	}
+
+	n := &Node{
+		id:             id,
+		connection:     connection,
+		table:          createRoutingTable(id),
+		records:        createRecords(maxStoredKeys, maxValuesPerKey),
+		requestTimeout: requestTimeout,
+		recordTTL:      recordTTL,
+		pending:        make(map[uint64]chan message),
+		closed:         make(chan struct{}),
+	}
+	go n.serve()
+
+	return n, nil
+}
+
+// ID returns the ID of the node
+func (n *Node) ID() ID {
+	return n.id
+}
+
+// Address returns the UDP address the node listens on
+func (n *Node) Address() string {
+	return n.connection.LocalAddr().String()
+}
+
+// Contacts returns how many other nodes the node knows
+func (n *Node) Contacts() int {
+	return n.table.size()
+}
+
+// Close stops the node
+func (n *Node) Close() error {
+	select {
+	case <-n.closed:
+		return nil
+	default:
+		close(n.closed)
+	}
+	return n.connection.Close()
+}
+
+// Bootstrap is a function that:
+//    - accepts:
+//         - addresses - UDP addresses of nodes that are already in the network
+//    - adds the nodes that answer to the routing table and looks up the own ID, so that the table fills with nearby nodes
+//    (***) Returns ErrNoPeers if none of the nodes answered
+func (n *Node) Bootstrap(addresses []string) error {
+	answered := false
+	for _, address := range addresses {
+		if _, err := n.request(address, message{Type: pingMessage}); err == nil {
+			answered = true
+		}
+	}
+	if !answered {
+		return ErrNoPeers
+	}
+
+	n.lookup(n.id, false)
+	return nil
+}
+
+// Announce is a function that:
+//    - accepts:
+//         - key   - the key of the record, see KeyFor
+//         - value - the value of the record
+//    - stores the record on the nodes whose IDs are the closest to "key" and on this node
+//    (***) Returns ErrNoPeers if no other node stored it
+func (n *Node) Announce(key ID, value string) error {
+	n.records.store(key, value, time.Now().Add(n.recordTTL))
+
+	closest, _ := n.lookup(key, false)
+
+	var wait sync.WaitGroup
+	var stored int32
+	for _, contact := range closest {
+		wait.Add(1)
+		go func(contact Contact) {
+			defer wait.Done()
+			target := key
+			if _, err := n.request(contact.Address, message{Type: storeMessage, Target: &target, Value: value}); err == nil {
+				atomic.AddInt32(&stored, 1)
+			}
+		}(contact)
+	}
+	wait.Wait()
+
+	if stored == 0 {
+		return ErrNoPeers
+	}
+	return nil
+}
+
+// Lookup is a function that:
+//    - accepts:
+//         - key - the key of the wanted records, see KeyFor
+//    - returns the values stored under "key" on this node and on the nodes whose IDs are the closest to it
+func (n *Node) Lookup(key ID) []string {
+	found := make(map[string]struct{})
+	for _, value := range n.records.get(key, time.Now()) {
+		found[value] = struct{}{}
+	}
+
+	_, values := n.lookup(key, true)
+	for _, value := range values {
+		found[value] = struct{}{}
+	}
+
+	result := make([]string, 0, len(found))
+	for value := range found {
+		result = append(result, value)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// lookup is a function that iteratively queries the nodes closest to "target" for even closer ones.
+// It returns the closest nodes that answered and, if "wantValues" is true, the values they store under "target".
+func (n *Node) lookup(target ID, wantValues bool) ([]Contact, []string) {
+	shortlist := n.table.closest(target, BucketSize)
+	queried := map[ID]bool{n.id: true}
+	answered := make(map[ID]bool)
+	var values []string
+
+	requestType := findNodeMessage
+	if wantValues {
+		requestType = findValueMessage
+	}
+
+	for {
+		batch := make([]Contact, 0, alpha)
+		for _, contact := range shortlist {
+			if !queried[contact.ID] {
+				batch = append(batch, contact)
+				queried[contact.ID] = true
+			}
+			if len(batch) == alpha {
+				break
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		responses := make(chan message, len(batch))
+		for _, contact := range batch {
+			go func(contact Contact) {
+				requestTarget := target
+				response, err := n.request(contact.Address, message{Type: requestType, Target: &requestTarget})
+				if err != nil {
+					n.table.remove(contact.ID)
+					responses <- message{}
+					return
+				}
+				responses <- response
+			}(contact)
+		}
+
+		for range batch {
+			response := <-responses
+			if response.Type == "" {
+				continue
+			}
+			answered[response.Sender] = true
+			values = append(values, response.Values...)
+			for _, contact := range response.Nodes {
+				if !containsContact(shortlist, contact.ID) {
+					shortlist = append(shortlist, contact)
+				}
+			}
+		}
+
+		sortByDistance(shortlist, target)
+		if len(shortlist) > BucketSize*2 {
+			shortlist = shortlist[:BucketSize*2]
+		}
+	}
+
+	closest := make([]Contact, 0, BucketSize)
+	for _, contact := range shortlist {
+		if answered[contact.ID] && len(closest) < BucketSize {
+			closest = append(closest, contact)
+		}
+	}
+	return closest, values
+}
+
+func containsContact(contacts []Contact, id ID) bool {
+	for _, contact := range contacts {
+		if contact.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// request is a function that sends "request" to the node at "address" and waits for its answer.
+// The answering node is added to the routing table.
+func (n *Node) request(address string, request message) (message, error) {
+	udpAddress, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return message{}, fmt.Errorf("Invalid DHT address %s. %w", address, err)
+	}
+
+	request.Transaction = atomic.AddUint64(&n.lastTransaction, 1)
+	request.Sender = n.id
+	answer := make(chan message, 1)
+
+	n.pendingMutex.Lock()
+	n.pending[request.Transaction] = answer
+	n.pendingMutex.Unlock()
+
+	defer func() {
+		n.pendingMutex.Lock()
+		delete(n.pending, request.Transaction)
+		n.pendingMutex.Unlock()
+	}()
+
+	if err := n.send(udpAddress, request); err != nil {
+		return message{}, err
+	}
+
+	timer := time.NewTimer(n.requestTimeout)
+	defer timer.Stop()
+
+	select {
+	case response := <-answer:
+		return response, nil
+	case <-timer.C:
+		return message{}, ErrTimeout
+	case <-n.closed:
+		return message{}, ErrClosed
+	}
+}
+
+func (n *Node) send(address *net.UDPAddr, m message) error {
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("Could not encode DHT message. %w", err)
+	}
+	if _, err := n.connection.WriteToUDP(encoded, address); err != nil {
+		return fmt.Errorf("Could not send DHT message to %s. %w", address, err)
+	}
+	return nil
+}
+
+// serve is a function that reads messages until the node is closed, answering requests and handing responses to their senders
+func (n *Node) serve() {
+	buffer := make([]byte, maxMessageSize)
+	for {
+		length, address, err := n.connection.ReadFromUDP(buffer)
+		if err != nil {
+			select {
+			case <-n.closed:
+				return
+			default:
+				continue
+			}
+		}
+
+		var received message
+		if err := json.Unmarshal(buffer[:length], &received); err != nil {
+			continue
+		}
+		if received.Sender == (ID{}) {
+			continue
+		}
+		n.remember(Contact{ID: received.Sender, Address: address.String()})
+
+		switch received.Type {
+		case pongMessage, nodesMessage, storedMessage:
+			n.pendingMutex.Lock()
+			answer, ok := n.pending[received.Transaction]
+			n.pendingMutex.Unlock()
+			if ok {
+				answer <- received
+			}
+		default:
+			if response, ok := n.answer(received); ok {
+				response.Transaction = received.Transaction
+				response.Sender = n.id
+				n.send(address, response)
+			}
+		}
+	}
+}
+
+// answer is a function that returns the response to "request", false if the request is not known
+func (n *Node) answer(request message) (message, bool) {
+	switch request.Type {
+	case pingMessage:
+		return message{Type: pongMessage}, true
+	case findNodeMessage, findValueMessage:
+		if request.Target == nil {
+			return message{}, false
+		}
+		response := message{Type: nodesMessage, Nodes: n.table.closest(*request.Target, BucketSize)}
+		if request.Type == findValueMessage {
+			response.Values = n.records.get(*request.Target, time.Now())
+		}
+		return response, true
+	case storeMessage:
+		if request.Target == nil || request.Value == "" {
+			return message{}, false
+		}
+		if !n.records.store(*request.Target, request.Value, time.Now().Add(n.recordTTL)) {
+			return message{}, false
+		}
+		return message{Type: storedMessage}, true
+	}
+	return message{}, false
+}
+
+// remember is a function that adds "contact" to the routing table.
+// If its bucket is full, the least recently seen contact is pinged and replaced if it does not answer.
+func (n *Node) remember(contact Contact) {
+	stale, full := n.table.seen(contact)
+	if !full {
+		return
+	}
+
+	go func() {
+		if _, err := n.request(stale.Address, message{Type: pingMessage}); err != nil {
+			n.table.replace(stale, contact)
+		}
+	}()
+}
@@ -0,0 +1,124 @@
+package dht_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/client/dht"
+)
+
+const (
+	requestTimeout = 200 * time.Millisecond
+	recordTTL      = time.Minute
+)
+
+// createNetwork is a function that starts "size" nodes on loopback and bootstraps all of them from the first one
+func createNetwork(t *testing.T, size int, ttl time.Duration) []*dht.Node {
+	t.Helper()
+
+	nodes := make([]*dht.Node, 0, size)
+	for i := 0; i < size; i++ {
+		node, err := dht.CreateNode("127.0.0.1:0", requestTimeout, ttl)
+		if err != nil {
+			closeNetwork(nodes)
+			t.Fatal(err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	for _, node := range nodes[1:] {
+		if err := node.Bootstrap([]string{nodes[0].Address()}); err != nil {
+			closeNetwork(nodes)
+			t.Fatal(err)
+		}
+	}
+	return nodes
+}
+
+func closeNetwork(nodes []*dht.Node) {
+	for _, node := range nodes {
+		node.Close()
+	}
+}
+
+func TestAnnounceAndLookup(t *testing.T) {
+	nodes := createNetwork(t, 30, recordTTL)
+	defer closeNetwork(nodes)
+
+	key := dht.KeyFor("d79f2e37784e5cd8631963896ebc6c9c66934af94a1854504717eaec04bc3d09")
+	if err := nodes[7].Announce(key, "127.0.0.1:4000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[21].Announce(key, "127.0.0.1:5000"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		node     int
+		key      dht.ID
+		expected []string
+	}{
+		{"bootstrap node", 0, key, []string{"127.0.0.1:4000", "127.0.0.1:5000"}},
+		{"announcing node", 7, key, []string{"127.0.0.1:4000", "127.0.0.1:5000"}},
+		{"far node", 29, key, []string{"127.0.0.1:4000", "127.0.0.1:5000"}},
+		{"unknown key", 13, dht.KeyFor("unknown"), []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := nodes[test.node].Lookup(test.key); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("got %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestLookupSurvivesDepartedNodes(t *testing.T) {
+	nodes := createNetwork(t, 20, recordTTL)
+	defer closeNetwork(nodes)
+
+	key := dht.KeyFor("report.pdf")
+	if err := nodes[3].Announce(key, "127.0.0.1:4000"); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes[0].Close()
+	nodes[3].Close()
+
+	if got := nodes[11].Lookup(key); !reflect.DeepEqual(got, []string{"127.0.0.1:4000"}) {
+		t.Fatalf("got %v, want the record to outlive the node that announced it", got)
+	}
+}
+
+func TestRecordsExpire(t *testing.T) {
+	nodes := createNetwork(t, 5, 300*time.Millisecond)
+	defer closeNetwork(nodes)
+
+	key := dht.KeyFor("report.pdf")
+	if err := nodes[1].Announce(key, "127.0.0.1:4000"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(400 * time.Millisecond)
+
+	if got := nodes[4].Lookup(key); len(got) != 0 {
+		t.Fatalf("got %v, want the record to have expired", got)
+	}
+}
+
+func TestBootstrapWithoutPeers(t *testing.T) {
+	node, err := dht.CreateNode("127.0.0.1:0", requestTimeout, recordTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	if err := node.Bootstrap([]string{"127.0.0.1:1"}); err != dht.ErrNoPeers {
+		t.Fatalf("got %v, want %v", err, dht.ErrNoPeers)
+	}
+	if err := node.Announce(dht.KeyFor("report.pdf"), "127.0.0.1:4000"); err != dht.ErrNoPeers {
+		t.Fatalf("got %v, want %v", err, dht.ErrNoPeers)
+	}
+}
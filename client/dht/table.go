@@ -0,0 +1,253 @@
+package dht
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// IDLength is the length of node IDs and keys in bytes
+	IDLength = sha1.Size
+	// BucketSize is the most contacts a bucket keeps and how many nodes store every record
+	BucketSize = 8
+
+	idBits = IDLength * 8
+)
+
+// ID is the identifier of a node or the key of a record, both live in the same 160 bit space
+type ID [IDLength]byte
+
+// KeyFor is a function that returns the key under which records about "name" are stored
+func KeyFor(name string) ID {
+	return ID(sha1.Sum([]byte(name)))
+}
+
+func randomID() (ID, error) {
+	var id ID
+	if _, err := rand.Read(id[:]); err != nil {
+		return id, fmt.Errorf("Could not generate node ID. %w", err)
+	}
+	return id, nil
+}
+
+func (id ID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// MarshalText encodes the ID as hex
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText decodes a hex encoded ID
+func (id *ID) UnmarshalText(text []byte) error {
+	decoded, err := hex.DecodeString(string(text))
+	if err != nil || len(decoded) != IDLength {
+		return fmt.Errorf("%q is not a valid node ID", text)
+	}
+	copy(id[:], decoded)
+	return nil
+}
+
+func (id ID) distance(other ID) ID {
+	var result ID
+	for i := range id {
+		result[i] = id[i] ^ other[i]
+	}
+	return result
+}
+
+// bucketIndex is a function that returns the index of the bucket "other" belongs to in the routing table of "id",
+// which is the length of their common prefix in bits
+func (id ID) bucketIndex(other ID) int {
+	distance := id.distance(other)
+	for i, b := range distance {
+		for bit := 0; bit < 8; bit++ {
+			if b&(0x80>>uint(bit)) != 0 {
+				return i*8 + bit
+			}
+		}
+	}
+	return idBits - 1
+}
+
+// Contact is a struct that contains:
+//    - ID      - the ID of a node
+//    - Address - the UDP address the node listens on
+type Contact struct {
+	ID      ID     `json:"id"`
+	Address string `json:"address"`
+}
+
+// sortByDistance is a function that sorts "contacts" by their distance to "target", the closest first
+func sortByDistance(contacts []Contact, target ID) {
+	sort.Slice(contacts, func(i, j int) bool {
+		first, second := contacts[i].ID.distance(target), contacts[j].ID.distance(target)
+		return bytes.Compare(first[:], second[:]) < 0
+	})
+}
+
+// routingTable is a struct that contains:
+//    - self    - the ID of the node the table belongs to
+//    - buckets - the known contacts, bucket "i" holds the ones whose IDs share exactly "i" leading bits with "self",
+//                the least recently seen first
+//    - mutex   - a Mutex that is used for working safely with "buckets"
+type routingTable struct {
+	self    ID
+	buckets [idBits][]Contact
+	mutex   sync.Mutex
+}
+
+func createRoutingTable(self ID) *routingTable {
+	return &routingTable{self: self}
+}
+
+// seen is a function that moves "contact" to the end of its bucket.
+// If the bucket is full it returns its least recently seen contact, which should be evicted if it does not answer a ping.
+func (r *routingTable) seen(contact Contact) (Contact, bool) {
+	if contact.ID == r.self {
+		return Contact{}, false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	index := r.self.bucketIndex(contact.ID)
+	bucket := r.buckets[index]
+	for i, known := range bucket {
+		if known.ID == contact.ID {
+			r.buckets[index] = append(append(bucket[:i:i], bucket[i+1:]...), contact)
+			return Contact{}, false
+		}
+	}
+
+	if len(bucket) < BucketSize {
+		r.buckets[index] = append(bucket, contact)
+		return Contact{}, false
+	}
+	return bucket[0], true
+}
+
+// replace is a function that evicts "stale" from its bucket and adds "fresh" in its place
+func (r *routingTable) replace(stale, fresh Contact) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	index := r.self.bucketIndex(stale.ID)
+	bucket := r.buckets[index]
+	for i, known := range bucket {
+		if known.ID == stale.ID {
+			r.buckets[index] = append(append(bucket[:i:i], bucket[i+1:]...), fresh)
+			return
+		}
+	}
+}
+
+func (r *routingTable) remove(id ID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	index := r.self.bucketIndex(id)
+	bucket := r.buckets[index]
+	for i, known := range bucket {
+		if known.ID == id {
+			r.buckets[index] = append(bucket[:i:i], bucket[i+1:]...)
+			return
+		}
+	}
+}
+
+// closest is a function that returns at most "count" known contacts that are the closest to "target"
+func (r *routingTable) closest(target ID, count int) []Contact {
+	r.mutex.Lock()
+	all := make([]Contact, 0, count)
+	for _, bucket := range r.buckets {
+		all = append(all, bucket...)
+	}
+	r.mutex.Unlock()
+
+	sortByDistance(all, target)
+	if len(all) > count {
+		all = all[:count]
+	}
+	return all
+}
+
+func (r *routingTable) size() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	count := 0
+	for _, bucket := range r.buckets {
+		count += len(bucket)
+	}
+	return count
+}
+
+// records is a struct that contains:
+//    - values    - a map whose keys are record keys and values map the stored values to the time they expire
+//    - maxKeys   - the most keys that are stored, so that other nodes cannot exhaust the memory
+//    - maxValues - the most values that are stored under a key
+//    - mutex     - a Mutex that is used for working safely with "values"
+type records struct {
+	values    map[ID]map[string]time.Time
+	maxKeys   int
+	maxValues int
+	mutex     sync.Mutex
+}
+
+func createRecords(maxKeys, maxValues int) *records {
+	return &records{
+		values:    make(map[ID]map[string]time.Time),
+		maxKeys:   maxKeys,
+		maxValues: maxValues,
+	}
+}
+
+// store is a function that stores "value" under "key" until "expires" and returns whether it was stored
+func (r *records) store(key ID, value string, expires time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	values, ok := r.values[key]
+	if !ok {
+		if len(r.values) >= r.maxKeys {
+			return false
+		}
+		values = make(map[string]time.Time)
+		r.values[key] = values
+	}
+	if _, known := values[value]; !known && len(values) >= r.maxValues {
+		return false
+	}
+
+	values[value] = expires
+	return true
+}
+
+// get is a function that returns the values stored under "key", forgetting the ones that have expired
+func (r *records) get(key ID, now time.Time) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	values := make([]string, 0, len(r.values[key]))
+	for value, expires := range r.values[key] {
+		if now.After(expires) {
+			delete(r.values[key], value)
+			continue
+		}
+		values = append(values, value)
+	}
+	if len(r.values[key]) == 0 {
+		delete(r.values, key)
+	}
+
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,270 @@
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	listUsersPrefix = "list-users:"
+	recordSeparator = ";"
+	addressSplitter = " - "
+
+	// ReachabilityUnknown is the reachability of peers that have not been probed by the server yet
+	ReachabilityUnknown = "unknown"
+	// Unreachable is the reachability of peers whose mini servers did not answer the last probe of the server
+	Unreachable = "unreachable"
+
+	// the most content IDs and holders per content ID that are remembered from peer exchange,
+	// so that other peers cannot exhaust the memory
+	maxExchangedContent  = 1000
+	maxHoldersPerContent = 50
+)
+
+// Peer is a struct that contains:
+//    - Username     - the username of the peer
+//    - Address      - the address of the mini server of the peer
+//    - Reachability - whether the server could reach the mini server("reachable", "unreachable" or "unknown")
+type Peer struct {
+	Username     string `json:"username"`
+	Address      string `json:"address"`
+	Reachability string `json:"reachability"`
+}
+
+// cache is the format of the on-disk copy of the Directory
+type cache struct {
+	UpdatedAt time.Time           `json:"updated_at"`
+	Peers     map[string]Peer     `json:"peers"`
+	Holders   map[string][]string `json:"holders,omitempty"`
+}
+
+// Directory is a struct that contains:
+//    - peers     - a map whose keys are usernames and values are the peers with these usernames
+//    - updatedAt - the moment "peers" was last replaced
+//    - holders   - a map whose keys are content IDs and values are the sets of mini server addresses of the peers that hold the content,
+//                  learned from other peers rather than the server. Other peers are not trusted with usernames, so the holders have none.
+//    - mutex     - a Mutex that is used for working safely with "peers", "updatedAt" and "holders"
+type Directory struct {
+	peers     map[string]Peer
+	updatedAt time.Time
+	holders   map[string]map[string]struct{}
+	mutex     sync.RWMutex
+}
+
+// CreateDirectory is a factory method that:
+//    - creates and returns a pointer to an empty Directory struct
+func CreateDirectory() *Directory {
+	return &Directory{
+		peers:   make(map[string]Peer),
+		holders: make(map[string]map[string]struct{}),
+	}
+}
+
+// ParseListUsers is a function that:
+//    - accepts:
+//         - response - the response of the server to "list-users", e.g. "list-users:bob (reachable) - 127.0.0.1:4000;"
+//    - returns the peers contained in the response
+//    (***) Returns error if the response is not a "list-users" response
+func ParseListUsers(response string) ([]Peer, error) {
+	response = strings.TrimSpace(response)
+	if !strings.HasPrefix(response, listUsersPrefix) {
+		return nil, fmt.Errorf("Not a list-users response: %q", response)
+	}
+
+	peers := make([]Peer, 0)
+	for _, record := range strings.Split(strings.TrimPrefix(response, listUsersPrefix), recordSeparator) {
+		if peer, ok := parseRecord(record); ok {
+			peers = append(peers, peer)
+		}
+	}
+
+	return peers, nil
+}
+
+func parseRecord(record string) (Peer, bool) {
+	split := strings.SplitN(record, addressSplitter, 2)
+	if len(split) != 2 {
+		return Peer{}, false
+	}
+
+	user := strings.TrimSpace(split[0])
+	address := strings.TrimSpace(split[1])
+	reachability := ReachabilityUnknown
+
+	if open := strings.Index(user, " ("); open != -1 && strings.HasSuffix(user, ")") {
+		reachability = user[open+2 : len(user)-1]
+		user = user[:open]
+	}
+
+	if user == "" || address == "" {
+		return Peer{}, false
+	}
+
+	return Peer{Username: user, Address: address, Reachability: reachability}, true
+}
+
+// Replace is a function that replaces all peers of the Directory with "peers".
+// The holders learned from other peers are kept, since the server may not know about them.
+func (d *Directory) Replace(peers []Peer) {
+	replacement := make(map[string]Peer, len(peers))
+	for _, peer := range peers {
+		replacement[peer.Username] = peer
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.peers = replacement
+	d.updatedAt = time.Now()
+}
+
+// Lookup is a function that:
+//    - accepts:
+//         - username - the exact username of a peer
+//    - returns the peer with that username, as the server listed it
+//    (***) Returns error if there is no such peer
+func (d *Directory) Lookup(username string) (Peer, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if peer, ok := d.peers[username]; ok {
+		return peer, nil
+	}
+
+	return Peer{}, fmt.Errorf("There is no record of user %s and its address", username)
+}
+
+// Peers is a function that returns all peers the server listed sorted by username
+func (d *Directory) Peers() []Peer {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	peers := make([]Peer, 0, len(d.peers))
+	for _, peer := range d.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Username < peers[j].Username
+	})
+
+	return peers
+}
+
+// AddHolders is a function that:
+//    - accepts:
+//         - contentID - the content ID of a file
+//         - addresses - the mini server addresses of peers that hold the file
+//    - remembers that the peers at "addresses" hold the file
+//    - returns how many of the peers were not known to hold it
+func (d *Directory) AddHolders(contentID string, addresses []string) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	holders, ok := d.holders[contentID]
+	if !ok {
+		if len(d.holders) >= maxExchangedContent {
+			return 0
+		}
+		holders = make(map[string]struct{})
+		d.holders[contentID] = holders
+	}
+
+	added := 0
+	for _, address := range addresses {
+		if _, known := holders[address]; known || address == "" || len(holders) >= maxHoldersPerContent {
+			continue
+		}
+		holders[address] = struct{}{}
+		added++
+	}
+	return added
+}
+
+// Holders is a function that returns the mini server addresses of the peers known to hold the file with content ID "contentID", sorted
+func (d *Directory) Holders(contentID string) []string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return sortedAddresses(d.holders[contentID])
+}
+
+func sortedAddresses(set map[string]struct{}) []string {
+	addresses := make([]string, 0, len(set))
+	for address := range set {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// SaveTo is a function that:
+//    - writes the Directory as JSON to "path", replacing the file atomically
+//    (***) Returns error if the file cannot be written
+func (d *Directory) SaveTo(path string) error {
+	d.mutex.RLock()
+	holders := make(map[string][]string, len(d.holders))
+	for contentID, addresses := range d.holders {
+		holders[contentID] = sortedAddresses(addresses)
+	}
+	content, err := json.MarshalIndent(cache{UpdatedAt: d.updatedAt, Peers: d.peers, Holders: holders}, "", "  ")
+	d.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	temporary, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("Could not save peers to %s. %w", path, err)
+	}
+	defer os.Remove(temporary.Name())
+
+	if _, err := temporary.Write(content); err != nil {
+		temporary.Close()
+		return fmt.Errorf("Could not save peers to %s. %w", path, err)
+	}
+	if err := temporary.Close(); err != nil {
+		return fmt.Errorf("Could not save peers to %s. %w", path, err)
+	}
+
+	return os.Rename(temporary.Name(), path)
+}
+
+// LoadFrom is a function that:
+//    - replaces the peers of the Directory with the ones saved in "path" by SaveTo
+//    (***) Returns error if the file cannot be read or parsed
+func (d *Directory) LoadFrom(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Could not load peers from %s. %w", path, err)
+	}
+
+	var saved cache
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return fmt.Errorf("Could not parse peers from %s. %w", path, err)
+	}
+	if saved.Peers == nil {
+		saved.Peers = make(map[string]Peer)
+	}
+	holders := make(map[string]map[string]struct{}, len(saved.Holders))
+	for contentID, addresses := range saved.Holders {
+		holders[contentID] = make(map[string]struct{}, len(addresses))
+		for _, address := range addresses {
+			holders[contentID][address] = struct{}{}
+		}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.peers = saved.Peers
+	d.updatedAt = saved.UpdatedAt
+	d.holders = holders
+	return nil
+}
@@ -0,0 +1,112 @@
+package directory_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/imaikeru/peer-to-peer/client/directory"
+)
+
+func TestLookupIsExact(t *testing.T) {
+	peers, err := directory.ParseListUsers("list-users:bobby (reachable) - 127.0.0.1:4001;bob (unreachable) - 127.0.0.1:4000;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := directory.CreateDirectory()
+	d.Replace(peers)
+
+	var tests = []struct {
+		username     string
+		address      string
+		reachability string
+		found        bool
+	}{
+		{"bob", "127.0.0.1:4000", "unreachable", true},
+		{"bobby", "127.0.0.1:4001", "reachable", true},
+		{"bo", "", "", false},
+		{"alice", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			peer, err := d.Lookup(tt.username)
+			if (err == nil) != tt.found {
+				t.Fatalf("got error %v, want found %t", err, tt.found)
+			}
+			if peer.Address != tt.address || peer.Reachability != tt.reachability {
+				t.Errorf("got %+v, want address %s and reachability %s", peer, tt.address, tt.reachability)
+			}
+		})
+	}
+}
+
+func TestParseListUsersRejectsOtherResponses(t *testing.T) {
+	if _, err := directory.ParseListUsers("list-files:bob : /file;"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "peers.json")
+
+	original := directory.CreateDirectory()
+	original.Replace([]directory.Peer{{Username: "bob", Address: "127.0.0.1:4000", Reachability: "reachable"}})
+	if err := original.SaveTo(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := directory.CreateDirectory()
+	if err := loaded.LoadFrom(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if peer, err := loaded.Lookup("bob"); err != nil || peer.Address != "127.0.0.1:4000" {
+		t.Errorf("got %+v, %v", peer, err)
+	}
+}
+
+func TestExchangedHoldersOutliveReplace(t *testing.T) {
+	d := directory.CreateDirectory()
+	d.Replace([]directory.Peer{{Username: "bob", Address: "127.0.0.1:4000", Reachability: "reachable"}})
+
+	if added := d.AddHolders("content", []string{"127.0.0.1:4002", "127.0.0.1:4003"}); added != 2 {
+		t.Errorf("expected 2 new holders, got %d", added)
+	}
+	if added := d.AddHolders("content", []string{"127.0.0.1:4002"}); added != 0 {
+		t.Errorf("expected a known holder not to be added again, got %d", added)
+	}
+
+	d.Replace(nil)
+
+	if holders := d.Holders("content"); !reflect.DeepEqual(holders, []string{"127.0.0.1:4002", "127.0.0.1:4003"}) {
+		t.Errorf("got holders %q", holders)
+	}
+	if peer, err := d.Lookup("bob"); err == nil {
+		t.Errorf("expected bob to be forgotten, got %+v", peer)
+	}
+}
+
+func TestExchangedHoldersDoNotAnswerLookups(t *testing.T) {
+	d := directory.CreateDirectory()
+	d.Replace([]directory.Peer{{Username: "bob", Address: "127.0.0.1:4000", Reachability: "reachable"}})
+
+	// another peer claims that bob holds the content at its own address
+	d.AddHolders("content", []string{"127.0.0.1:6666"})
+
+	if peer, err := d.Lookup("bob"); err != nil || peer.Address != "127.0.0.1:4000" {
+		t.Errorf("expected bob at the address the server listed, got %+v and %v", peer, err)
+	}
+	if peers := d.Peers(); len(peers) != 1 || peers[0].Address != "127.0.0.1:4000" {
+		t.Errorf("expected only the peers the server listed, got %+v", peers)
+	}
+}
@@ -1,3 +1,7 @@
 module github.com/imaikeru/peer-to-peer/client
 
 go 1.15
+
+require github.com/imaikeru/peer-to-peer/shared v0.0.0
+
+replace github.com/imaikeru/peer-to-peer/shared => ../shared
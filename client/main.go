@@ -2,21 +2,172 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/imaikeru/peer-to-peer/client/audit"
 	"github.com/imaikeru/peer-to-peer/client/client"
+	"github.com/imaikeru/peer-to-peer/client/dht"
+	"github.com/imaikeru/peer-to-peer/shared/discovery"
+	"github.com/imaikeru/peer-to-peer/shared/logging"
 )
 
+func createLogger(levelName, formatName, path string) (*logging.Logger, error) {
+	level, err := logging.ParseLevel(levelName)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := logging.ParseFormat(formatName)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := logging.OpenSink(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return logging.CreateLogger(sink, level, format), nil
+}
+
+const (
+	dhtRequestTimeout = time.Second
+	dhtRecordTTL      = time.Hour
+
+	defaultServerAddress = ":13337"
+	// how many DHT nodes found on the local network are enough for joining the DHT
+	discoveredPeers = 8
+)
+
+// findServer is a function that returns the address of a tracker on the local network,
+// or the default address if discovery is disabled or no tracker answered
+func findServer(group string, timeout time.Duration, logger *logging.Logger) string {
+	if group == "" {
+		return defaultServerAddress
+	}
+
+	trackers, err := discovery.Find(group, discovery.TrackerService, "", timeout, 1)
+	if err != nil {
+		logger.Info("No tracker found on the local network, using the default address", "component", "discovery", "address", defaultServerAddress, "error", err)
+		return defaultServerAddress
+	}
+
+	logger.Info("Found tracker on the local network", "component", "discovery", "address", trackers[0].Address)
+	return trackers[0].Address
+}
+
+func createDHTNode(address, bootstrap, group string, timeout time.Duration, logger *logging.Logger) (*dht.Node, error) {
+	node, err := dht.CreateNode(address, dhtRequestTimeout, dhtRecordTTL)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("DHT node started", "component", "dht", "address", node.Address(), "id", node.ID().String())
+
+	var bootstrapAddresses []string
+	if bootstrap != "" {
+		bootstrapAddresses = strings.Split(bootstrap, ",")
+	}
+	if group != "" {
+		bootstrapAddresses = append(bootstrapAddresses, discoverDHTPeers(node, group, timeout, logger)...)
+	}
+
+	if len(bootstrapAddresses) > 0 {
+		if err := node.Bootstrap(bootstrapAddresses); err != nil {
+			logger.Warn("Could not join the DHT, waiting for other nodes to contact this one", "component", "dht", "error", err)
+		}
+	}
+	return node, nil
+}
+
+// discoverDHTPeers is a function that makes "node" findable on the local network
+// and returns the addresses of the DHT nodes of other clients there
+func discoverDHTPeers(node *dht.Node, group string, timeout time.Duration, logger *logging.Logger) []string {
+	_, portText, _ := net.SplitHostPort(node.Address())
+	port, _ := strconv.Atoi(portText)
+	instance := node.ID().String()
+
+	responder, err := discovery.CreateResponder(group, discovery.Announcement{Service: discovery.PeerService, Port: port, Instance: instance})
+	if err != nil {
+		logger.Warn("Could not join the local network discovery", "component", "discovery", "error", err)
+	} else {
+		go func() {
+			if err := responder.Serve(); err != nil {
+				logger.Warn("Local network discovery stopped", "component", "discovery", "error", err)
+			}
+		}()
+	}
+
+	peers, err := discovery.Find(group, discovery.PeerService, instance, timeout, discoveredPeers)
+	if err != nil {
+		logger.Debug("No DHT nodes found on the local network", "component", "discovery", "error", err)
+		return nil
+	}
+
+	addresses := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		addresses = append(addresses, peer.Address)
+	}
+	logger.Info("Found DHT nodes on the local network", "component", "discovery", "count", len(addresses))
+	return addresses
+}
+
 func main() {
 
-	filePathPtr := flag.String("file_path", "/path/to/file/where/users/and/their/addresses/are/saved", "string")
+	filePathPtr := flag.String("file_path", "", "optional path to a JSON file where users and their addresses are cached")
+	metricsAddressPtr := flag.String("metrics_address", "", "address of the HTTP endpoint that exposes \"/metrics\", empty disables it")
+	logLevelPtr := flag.String("log_level", "info", "least severe level that is logged: debug, info, warn or error")
+	logFormatPtr := flag.String("log_format", "logfmt", "format of the log records: logfmt or json")
+	logFilePtr := flag.String("log_file", "", "path to the log file, standard error if empty")
+	auditLogPtr := flag.String("audit_log", "transfers.log", "path to the log of the files sent to and received from other peers, empty disables it")
+	auditLogMaxSizePtr := flag.Int64("audit_log_max_size", 1<<20, "size in bytes after which the audit log is rotated")
+	auditLogBackupsPtr := flag.Int("audit_log_backups", 3, "how many rotated audit logs are kept")
+	announceURLPtr := flag.String("announce_url", "http://127.0.0.1:6969/announce", "tracker URL written to exported .torrent files")
+	devicePtr := flag.String("device", "", "name of this device, needed for using the same username on several devices")
+	dhtAddressPtr := flag.String("dht_address", "", "UDP address of the DHT node used when the central server is unavailable, empty disables it")
+	dhtBootstrapPtr := flag.String("dht_bootstrap", "", "comma separated UDP addresses of DHT nodes to join the DHT through")
+	serverAddressPtr := flag.String("server_address", "", "comma separated addresses of the central server and its standbys, found on the local network if empty")
+	discoveryGroupPtr := flag.String("discovery_group", discovery.DefaultGroup, "UDP multicast group for finding the central server and DHT nodes on the local network, empty disables it")
+	discoveryTimeoutPtr := flag.Duration("discovery_timeout", time.Second, "how long to wait for answers on the local network")
 
 	flag.Parse()
 
-	fmt.Print(*filePathPtr)
+	logger, err := createLogger(*logLevelPtr, *logFormatPtr, *logFilePtr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var auditLog *audit.Log
+	if *auditLogPtr != "" {
+		auditLog = audit.CreateLog(*auditLogPtr, *auditLogMaxSizePtr, *auditLogBackupsPtr)
+	}
+
+	var dhtNode *dht.Node
+	if *dhtAddressPtr != "" {
+		if dhtNode, err = createDHTNode(*dhtAddressPtr, *dhtBootstrapPtr, *discoveryGroupPtr, *discoveryTimeoutPtr, logger); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	var trackers []string
+	if *serverAddressPtr != "" {
+		trackers = strings.Split(*serverAddressPtr, ",")
+	} else {
+		trackers = []string{findServer(*discoveryGroupPtr, *discoveryTimeoutPtr, logger)}
+	}
 
-	client := client.CreateNewClient(*filePathPtr, "13337")
+	client := client.CreateNewClient(*filePathPtr, trackers, logger, *devicePtr, auditLog, *announceURLPtr, dhtNode)
+
+	if *metricsAddressPtr != "" {
+		go func() {
+			if err := client.ServeMetrics(*metricsAddressPtr); err != nil {
+				logger.Error("Metrics endpoint stopped", "component", "metrics", "error", err)
+			}
+		}()
+	}
 
 	if err := client.Start(); err != nil {
 		log.Fatalln(err)
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	value uint64
+}
+
+// Inc is a function that increases the Counter by one
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add is a function that increases the Counter by "delta"
+func (c *Counter) Add(delta uint64) {
+	atomic.AddUint64(&c.value, delta)
+}
+
+// Value is a function that returns the current value of the Counter
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	value int64
+}
+
+// Inc is a function that increases the Gauge by one
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.value, 1)
+}
+
+// Dec is a function that decreases the Gauge by one
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.value, -1)
+}
+
+// Set is a function that sets the Gauge to "value"
+func (g *Gauge) Set(value int64) {
+	atomic.StoreInt64(&g.value, value)
+}
+
+// Value is a function that returns the current value of the Gauge
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+type metric struct {
+	name       string
+	help       string
+	metricType string
+	write      func(w io.Writer, name string)
+}
+
+// Registry is a struct that contains:
+//    - metrics - the registered metrics in the order of their registration
+//    - mutex   - a Mutex that is used for working safely with "metrics"
+type Registry struct {
+	metrics []metric
+	mutex   sync.Mutex
+}
+
+// CreateRegistry is a factory method that:
+//    - creates and returns a pointer to an empty Registry struct
+func CreateRegistry() *Registry {
+	return &Registry{
+		metrics: make([]metric, 0),
+	}
+}
+
+func (r *Registry) register(name, help, metricType string, write func(w io.Writer, name string)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.metrics = append(r.metrics, metric{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		write:      write,
+	})
+}
+
+// NewCounter is a function that registers and returns a new Counter
+func (r *Registry) NewCounter(name, help string) *Counter {
+	counter := &Counter{}
+	r.register(name, help, "counter", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, counter.Value())
+	})
+	return counter
+}
+
+// NewGauge is a function that registers and returns a new Gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	gauge := &Gauge{}
+	r.register(name, help, "gauge", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, gauge.Value())
+	})
+	return gauge
+}
+
+// WriteText is a function that writes all registered metrics to "w" in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, m := range r.metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.metricType)
+		m.write(w, m.name)
+	}
+}
+
+// ServeHTTP is a function that answers every request with the metrics in the Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.WriteText(w)
+}
+
+// Serve is a function that:
+//    - starts an HTTP server on "address" that exposes the metrics of the Registry on "/metrics"
+//    (***) Returns error if the HTTP server cannot be started
+func (r *Registry) Serve(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+
+	if err := http.ListenAndServe(address, mux); err != nil {
+		return fmt.Errorf("Error starting metrics endpoint on %s. %w", address, err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Package torrent creates and reads BitTorrent v1 ".torrent" metainfo files for single files.
+package torrent
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/imaikeru/peer-to-peer/shared/bencode"
+)
+
+const (
+	// DefaultPieceLength is the length of the pieces of created metainfo files, 256 KiB like most BitTorrent clients use
+	DefaultPieceLength = 256 * 1024
+
+	// contentIDKey is the key of the content ID of the file in the metainfo, which BitTorrent clients ignore
+	contentIDKey = "p2p content id"
+	// Extension is the file extension of metainfo files
+	Extension = ".torrent"
+)
+
+// Metainfo is a struct that contains:
+//    - Announce    - the URL of the tracker
+//    - Name        - the name of the file
+//    - Length      - the size of the file in bytes
+//    - PieceLength - the size of every piece but the last one in bytes
+//    - Pieces      - the SHA-1 hashes of the pieces of the file, 20 bytes each
+//    - ContentID   - the content ID of the file in the p2p tracker, empty for metainfo created by other clients
+type Metainfo struct {
+	Announce    string
+	Name        string
+	Length      int64
+	PieceLength int64
+	Pieces      []byte
+	ContentID   string
+}
+
+// Create is a function that:
+//    - accepts:
+//         - path        - path to the file
+//         - announce    - the URL of the tracker
+//         - pieceLength - the size of the pieces in bytes
+//         - contentID   - the content ID of the file in the p2p tracker
+//    - returns the metainfo of the file, hashing its content piece by piece
+//    (***) Returns error if the file cannot be read
+func Create(path, announce string, pieceLength int64, contentID string) (*Metainfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open %s. %w", path, err)
+	}
+	defer file.Close()
+
+	metainfo := &Metainfo{
+		Announce:    announce,
+		Name:        filepath.Base(path),
+		PieceLength: pieceLength,
+		Pieces:      make([]byte, 0),
+		ContentID:   contentID,
+	}
+
+	piece := make([]byte, pieceLength)
+	for {
+		read, err := io.ReadFull(file, piece)
+		if read > 0 {
+			hash := sha1.Sum(piece[:read])
+			metainfo.Pieces = append(metainfo.Pieces, hash[:]...)
+			metainfo.Length += int64(read)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read %s. %w", path, err)
+		}
+	}
+
+	return metainfo, nil
+}
+
+func (m *Metainfo) info() map[string]interface{} {
+	return map[string]interface{}{
+		"name":         m.Name,
+		"length":       m.Length,
+		"piece length": m.PieceLength,
+		"pieces":       m.Pieces,
+	}
+}
+
+// InfoHash is a function that returns the SHA-1 hash of the bencoded info dictionary, which identifies the torrent
+func (m *Metainfo) InfoHash() [sha1.Size]byte {
+	encoded, _ := bencode.Encode(m.info())
+	return sha1.Sum(encoded)
+}
+
+// Encode is a function that returns the bencoded metainfo file
+func (m *Metainfo) Encode() ([]byte, error) {
+	metainfo := map[string]interface{}{
+		"announce": m.Announce,
+		"info":     m.info(),
+	}
+	if m.ContentID != "" {
+		metainfo[contentIDKey] = m.ContentID
+	}
+
+	return bencode.Encode(metainfo)
+}
+
+// SaveTo is a function that writes the bencoded metainfo to the file at "path"
+func (m *Metainfo) SaveTo(path string) error {
+	encoded, err := m.Encode()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, encoded, 0644); err != nil {
+		return fmt.Errorf("Could not write %s. %w", path, err)
+	}
+	return nil
+}
+
+var errInvalidMetainfo = errors.New("invalid metainfo")
+
+// Parse is a function that:
+//    - accepts:
+//         - data - the content of a single file ".torrent" metainfo file
+//    - returns the metainfo
+//    (***) Returns error if "data" is not valid single file metainfo
+func Parse(data []byte) (*Metainfo, error) {
+	decoded, err := bencode.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode metainfo. %w", err)
+	}
+
+	metainfo, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, errInvalidMetainfo
+	}
+	info, ok := metainfo["info"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: missing info dictionary", errInvalidMetainfo)
+	}
+
+	m := &Metainfo{}
+	m.Announce, _ = metainfo["announce"].(string)
+	m.ContentID, _ = metainfo[contentIDKey].(string)
+
+	var pieces string
+	if m.Name, ok = info["name"].(string); !ok {
+		return nil, fmt.Errorf("%w: missing name", errInvalidMetainfo)
+	}
+	if m.Length, ok = info["length"].(int64); !ok {
+		return nil, fmt.Errorf("%w: missing length, only single file torrents are supported", errInvalidMetainfo)
+	}
+	if m.PieceLength, ok = info["piece length"].(int64); !ok || m.PieceLength <= 0 {
+		return nil, fmt.Errorf("%w: missing piece length", errInvalidMetainfo)
+	}
+	if pieces, ok = info["pieces"].(string); !ok || len(pieces)%sha1.Size != 0 {
+		return nil, fmt.Errorf("%w: pieces must be a multiple of %d bytes", errInvalidMetainfo, sha1.Size)
+	}
+	m.Pieces = []byte(pieces)
+
+	return m, nil
+}
+
+// LoadFrom is a function that reads and parses the metainfo file at "path"
+func LoadFrom(path string) (*Metainfo, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s. %w", path, err)
+	}
+	return Parse(data)
+}
+
+// Verify is a function that:
+//    - accepts:
+//         - path - path to a downloaded file
+//    - returns the number of the first piece of the file that does not match the metainfo, -1 if all of them match
+//    (***) Returns error if the file cannot be read
+func (m *Metainfo) Verify(path string) (int, error) {
+	downloaded, err := Create(path, m.Announce, m.PieceLength, m.ContentID)
+	if err != nil {
+		return 0, err
+	}
+
+	if downloaded.Length != m.Length {
+		return len(downloaded.Pieces) / sha1.Size, nil
+	}
+	for index := 0; index*sha1.Size < len(m.Pieces); index++ {
+		piece := m.Pieces[index*sha1.Size : (index+1)*sha1.Size]
+		if index*sha1.Size >= len(downloaded.Pieces) || string(piece) != string(downloaded.Pieces[index*sha1.Size:(index+1)*sha1.Size]) {
+			return index, nil
+		}
+	}
+	return -1, nil
+}
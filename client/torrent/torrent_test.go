@@ -0,0 +1,68 @@
+package torrent_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/imaikeru/peer-to-peer/client/torrent"
+)
+
+func TestCreateParseAndVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data.bin")
+	data := bytes.Repeat([]byte("0123456789"), 5)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := torrent.Create(path, "http://127.0.0.1:6969/announce", 16, "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Length != 50 || len(created.Pieces) != 4*20 {
+		t.Fatalf("got length %d and %d bytes of piece hashes, want 50 and 80", created.Length, len(created.Pieces))
+	}
+
+	encoded, err := created.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := torrent.Parse(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, created) {
+		t.Fatalf("got %+v, want %+v", parsed, created)
+	}
+	if parsed.InfoHash() != created.InfoHash() {
+		t.Error("the info hash changed after parsing")
+	}
+
+	if piece, err := parsed.Verify(path); err != nil || piece != -1 {
+		t.Errorf("got piece %d and error %v for the original file, want -1 and no error", piece, err)
+	}
+
+	data[20] = 'x'
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if piece, err := parsed.Verify(path); err != nil || piece != 1 {
+		t.Errorf("got piece %d and error %v for a corrupted file, want 1 and no error", piece, err)
+	}
+}
+
+func TestParseRejectsMultiFileTorrents(t *testing.T) {
+	multiFile := "d8:announce3:url4:infod5:filesle4:name3:dir12:piece lengthi16e6:pieces0:ee"
+	if _, err := torrent.Parse([]byte(multiFile)); err == nil {
+		t.Error("expected an error for a multi file torrent")
+	}
+}
@@ -3,11 +3,23 @@ package validator
 import "regexp"
 
 const (
-	disconnect = `^\s*disconnect\s*$`
-	listFiles  = `^\s*list-files\s*$`
-	register   = `^\s*register\s+[a-z]+(\s+(?:\"[^"]+\")\s*)+$`
-	unregister = `^\s*unregister\s+[a-z]+(\s+(?:\"[^"]+\")\s*)+$`
-	download   = `^\s*download\s+[a-z]+(\s+(?:\"[^"]+\")\s*){2}$`
+	disconnect      = `^\s*disconnect\s*$`
+	listFiles       = `^\s*list-files\s*$`
+	register        = `^\s*register\s+[a-z]+(\s+(public|group:[a-z0-9-]+|users:[a-z]+(,[a-z]+)*))?(\s+(?:\"[^"]+\")\s*)+$`
+	unregister      = `^\s*unregister\s+[a-z]+(\s+(?:\"[^"]+\")\s*)+$`
+	download        = `^\s*download\s+[a-z]+(@[a-z0-9-]+)?(\s+(?:\"[^"]+\")\s*){2}$`
+	rename          = `^\s*rename\s+[a-z]+\s*$`
+	alias           = `^\s*alias\s+[a-z]+\s*$`
+	unalias         = `^\s*unalias\s+[a-z]+\s*$`
+	search          = `^\s*search\s+\"[^"]+\"\s*$`
+	groupAdd        = `^\s*group-add\s+[a-z0-9-]+\s+[a-z]+\s*$`
+	groupRemove     = `^\s*group-remove\s+[a-z0-9-]+\s+[a-z]+\s*$`
+	listGroups      = `^\s*list-groups\s*$`
+	history         = `^\s*history\s+(uploads|downloads)\s*$`
+	link            = `^\s*link\s+\"[^"]+\"\s*$`
+	downloadLink    = `^\s*download\s+\"p2p:[^"]+\"\s+\"[^"]+\"\s*$`
+	torrent         = `^\s*torrent\s+\"[^"]+\"\s+\"[^"]+\.torrent\"\s*$`
+	downloadTorrent = `^\s*download\s+\"[^"]+\.torrent\"\s+\"[^"]+\"\s*$`
 )
 
 // Validator is a struct that contains:
@@ -19,12 +31,24 @@ type Validator struct {
 // CreateValidator is a factory method that:
 //    - creates and returns a pointer to Validator struct with predefined regexes
 func CreateValidator() *Validator {
-	regexes := make([]*regexp.Regexp, 0, 5)
+	regexes := make([]*regexp.Regexp, 0, 17)
 	regexes = append(regexes, regexp.MustCompile(disconnect))
 	regexes = append(regexes, regexp.MustCompile(listFiles))
 	regexes = append(regexes, regexp.MustCompile(register))
 	regexes = append(regexes, regexp.MustCompile(unregister))
 	regexes = append(regexes, regexp.MustCompile(download))
+	regexes = append(regexes, regexp.MustCompile(rename))
+	regexes = append(regexes, regexp.MustCompile(alias))
+	regexes = append(regexes, regexp.MustCompile(unalias))
+	regexes = append(regexes, regexp.MustCompile(search))
+	regexes = append(regexes, regexp.MustCompile(groupAdd))
+	regexes = append(regexes, regexp.MustCompile(groupRemove))
+	regexes = append(regexes, regexp.MustCompile(listGroups))
+	regexes = append(regexes, regexp.MustCompile(history))
+	regexes = append(regexes, regexp.MustCompile(link))
+	regexes = append(regexes, regexp.MustCompile(downloadLink))
+	regexes = append(regexes, regexp.MustCompile(torrent))
+	regexes = append(regexes, regexp.MustCompile(downloadTorrent))
 	return &Validator{
 		regexes: regexes,
 	}
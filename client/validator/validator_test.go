@@ -29,6 +29,38 @@ func TestValidateCommandsTableDriven(t *testing.T) {
 		{`register ivancho "file1" "file2" "file3" file 5`, false},
 		{`unregister ivancho "file1" "file2" "file3" file4`, false},
 		{`unregister ivancho "file1" "file2" "file3"`, true},
+		{`download ivancho@laptop "E:\ivancho\file1.txt" "E:\petio\file1copy.txt"`, true},
+		{`download ivancho@Laptop "E:\ivancho\file1.txt" "E:\petio\file1copy.txt"`, false},
+		{`rename ivan`, true},
+		{`rename ivan petio`, false},
+		{`rename Ivan`, false},
+		{`alias team`, true},
+		{`alias`, false},
+		{`unalias team`, true},
+		{`unalias "team"`, false},
+		{`register ivancho group:friends "file1"`, true},
+		{`register ivancho users:petio,gosho "file1" "file2"`, true},
+		{`register ivancho public "file1"`, true},
+		{`register ivancho secret "file1"`, false},
+		{`register ivancho users:Petio "file1"`, false},
+		{`search "report"`, true},
+		{`search report`, false},
+		{`group-add friends petio`, true},
+		{`group-add friends`, false},
+		{`group-remove friends petio`, true},
+		{`list-groups`, true},
+		{`history uploads`, true},
+		{` history   downloads `, true},
+		{`history`, false},
+		{`history everything`, false},
+		{`link "/path/to/file"`, true},
+		{`link /path/to/file`, false},
+		{`download "p2p:?xt=urn:sha256:abc&dn=file.txt&xl=12" "/path/to/save"`, true},
+		{`download "p2p:?xt=urn:sha256:abc"`, false},
+		{`download "http://example.com" "/path/to/save"`, false},
+		{`torrent "/path/to/file" "/path/to/file.torrent"`, true},
+		{`torrent "/path/to/file" "/path/to/file.txt"`, false},
+		{`download "/path/to/file.torrent" "/path/to/save"`, true},
 		{` asdkalsdkl `, false},
 	}
 
@@ -0,0 +1,328 @@
+// Package announce implements the BitTorrent HTTP tracker protocol("/announce" and "/scrape"),
+// so that stock BitTorrent clients can find each other through the central server.
+package announce
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/bencode"
+)
+
+const (
+	infoHashLength  = 20
+	defaultNumWant  = 50
+	maxNumWant      = 200
+	eventStopped    = "stopped"
+	eventCompleted  = "completed"
+	contentType     = "text/plain"
+	compactPeerSize = 6
+)
+
+// peer is a struct that contains:
+//     - id       - the peer ID the BitTorrent client has chosen
+//     - ip       - the IP address of the peer
+//     - port     - the port the peer listens on
+//     - left     - how many bytes the peer still has to download, 0 for seeders
+//     - lastSeen - the moment of the last announce of the peer
+type peer struct {
+	id       string
+	ip       net.IP
+	port     int
+	left     int64
+	lastSeen time.Time
+}
+
+// swarm is a struct that contains:
+//     - peers      - a map whose keys are peer IDs and values are the peers that share the same torrent
+//     - downloaded - how many times a peer has announced that it completed the download
+type swarm struct {
+	peers      map[string]*peer
+	downloaded int64
+}
+
+// Tracker is a struct that contains:
+//     - interval - how often peers are asked to announce themselves, peers that are silent for twice as long are forgotten
+//     - swarms   - a map whose keys are info hashes(20 raw bytes) and values are the swarms of the torrents
+//     - mutex    - a Mutex that is used for working safely with "swarms"
+type Tracker struct {
+	interval time.Duration
+	swarms   map[string]*swarm
+	mutex    sync.Mutex
+}
+
+// CreateTracker is a factory method that:
+//    - accepts:
+//         - interval - how often peers are asked to announce themselves
+//    - creates and returns a pointer to an empty Tracker struct
+func CreateTracker(interval time.Duration) *Tracker {
+	return &Tracker{
+		interval: interval,
+		swarms:   make(map[string]*swarm),
+	}
+}
+
+// forgetSilentPeers is a function that removes the peers of "s" that have not announced themselves for too long.
+// It has to be called while "mutex" is held.
+func (t *Tracker) forgetSilentPeers(s *swarm, now time.Time) {
+	for id, p := range s.peers {
+		if now.Sub(p.lastSeen) > 2*t.interval {
+			delete(s.peers, id)
+		}
+	}
+}
+
+func counts(s *swarm) (int64, int64) {
+	var complete, incomplete int64
+	for _, p := range s.peers {
+		if p.left == 0 {
+			complete++
+		} else {
+			incomplete++
+		}
+	}
+	return complete, incomplete
+}
+
+// PeerCount is a function that returns the number of peers in all swarms
+func (t *Tracker) PeerCount() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	count := 0
+	for _, s := range t.swarms {
+		count += len(s.peers)
+	}
+	return count
+}
+
+func writeResponse(w http.ResponseWriter, response map[string]interface{}) {
+	encoded, err := bencode.Encode(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(encoded)
+}
+
+func writeFailure(w http.ResponseWriter, reason string) {
+	writeResponse(w, map[string]interface{}{"failure reason": reason})
+}
+
+func parseInt(query url.Values, name string) (int64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return number, nil
+}
+
+func ipOf(r *http.Request) net.IP {
+	if ip := net.ParseIP(r.URL.Query().Get("ip")); ip != nil {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return net.ParseIP(r.RemoteAddr)
+	}
+	return net.ParseIP(host)
+}
+
+// encodePeers is a function that returns the peers either in the compact format(6 bytes per IPv4 peer)
+// or as a list of dictionaries, which can contain IPv6 peers as well
+func encodePeers(peers []*peer, compact bool) interface{} {
+	if compact {
+		encoded := make([]byte, 0, len(peers)*compactPeerSize)
+		for _, p := range peers {
+			if ip := p.ip.To4(); ip != nil {
+				port := make([]byte, 2)
+				binary.BigEndian.PutUint16(port, uint16(p.port))
+				encoded = append(append(encoded, ip...), port...)
+			}
+		}
+		return encoded
+	}
+
+	list := make([]interface{}, 0, len(peers))
+	for _, p := range peers {
+		list = append(list, map[string]interface{}{
+			"peer id": p.id,
+			"ip":      p.ip.String(),
+			"port":    p.port,
+		})
+	}
+	return list
+}
+
+// announce is a function that records the peer from an announce request and returns the other peers of its swarm
+func (t *Tracker) announce(infoHash string, announced *peer, event string, numWant int) (*swarm, []*peer) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	s, ok := t.swarms[infoHash]
+	if !ok {
+		s = &swarm{peers: make(map[string]*peer)}
+		t.swarms[infoHash] = s
+	}
+	t.forgetSilentPeers(s, announced.lastSeen)
+
+	if event == eventStopped {
+		delete(s.peers, announced.id)
+	} else {
+		if previous, ok := s.peers[announced.id]; event == eventCompleted && (!ok || previous.left > 0) {
+			s.downloaded++
+		}
+		s.peers[announced.id] = announced
+	}
+
+	others := make([]*peer, 0, numWant)
+	for id, p := range s.peers {
+		if len(others) == numWant {
+			break
+		}
+		if id != announced.id {
+			others = append(others, p)
+		}
+	}
+
+	if len(s.peers) == 0 && s.downloaded == 0 {
+		delete(t.swarms, infoHash)
+	}
+
+	return s, others
+}
+
+// handleAnnounce is a function that answers "/announce" requests as described in BEP 3 and BEP 23
+func (t *Tracker) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	infoHash := query.Get("info_hash")
+	if len(infoHash) != infoHashLength {
+		writeFailure(w, "info_hash must be 20 bytes long")
+		return
+	}
+	peerID := query.Get("peer_id")
+	if len(peerID) != infoHashLength {
+		writeFailure(w, "peer_id must be 20 bytes long")
+		return
+	}
+	port, err := strconv.Atoi(query.Get("port"))
+	if err != nil || port <= 0 || port > 65535 {
+		writeFailure(w, "invalid port")
+		return
+	}
+	left, err := parseInt(query, "left")
+	if err != nil {
+		writeFailure(w, err.Error())
+		return
+	}
+	numWant, err := parseInt(query, "numwant")
+	if err != nil {
+		writeFailure(w, err.Error())
+		return
+	}
+	if query.Get("numwant") == "" {
+		numWant = defaultNumWant
+	}
+	if numWant > maxNumWant {
+		numWant = maxNumWant
+	}
+
+	ip := ipOf(r)
+	if ip == nil {
+		writeFailure(w, "invalid ip")
+		return
+	}
+
+	s, others := t.announce(infoHash, &peer{
+		id:       peerID,
+		ip:       ip,
+		port:     port,
+		left:     left,
+		lastSeen: time.Now(),
+	}, query.Get("event"), int(numWant))
+
+	t.mutex.Lock()
+	complete, incomplete := counts(s)
+	response := map[string]interface{}{
+		"interval":   int64(t.interval.Seconds()),
+		"complete":   complete,
+		"incomplete": incomplete,
+		"peers":      encodePeers(others, query.Get("compact") != "0"),
+	}
+	t.mutex.Unlock()
+
+	writeResponse(w, response)
+}
+
+// scrape is a function that returns the statistics of the torrents with "infoHashes", or of all torrents if there are none
+func (t *Tracker) scrape(infoHashes []string) map[string]interface{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(infoHashes) == 0 {
+		for infoHash := range t.swarms {
+			infoHashes = append(infoHashes, infoHash)
+		}
+	}
+
+	now := time.Now()
+	files := make(map[string]interface{})
+	for _, infoHash := range infoHashes {
+		s, ok := t.swarms[infoHash]
+		if !ok {
+			continue
+		}
+		t.forgetSilentPeers(s, now)
+
+		complete, incomplete := counts(s)
+		files[infoHash] = map[string]interface{}{
+			"complete":   complete,
+			"incomplete": incomplete,
+			"downloaded": s.downloaded,
+		}
+	}
+
+	return files
+}
+
+// handleScrape is a function that answers "/scrape" requests as described in BEP 48
+func (t *Tracker) handleScrape(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, map[string]interface{}{"files": t.scrape(r.URL.Query()["info_hash"])})
+}
+
+// ServeHTTP is a function that answers "/announce" and "/scrape" requests
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/announce":
+		t.handleAnnounce(w, r)
+	case "/scrape":
+		t.handleScrape(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Serve is a function that:
+//    - starts an HTTP server on "address" that answers "/announce" and "/scrape" requests
+//    (***) Returns error if the HTTP server cannot be started
+func (t *Tracker) Serve(address string) error {
+	if err := http.ListenAndServe(address, t); err != nil {
+		return fmt.Errorf("Error starting announce endpoint on %s. %w", address, err)
+	}
+	return nil
+}
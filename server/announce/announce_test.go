@@ -0,0 +1,105 @@
+package announce_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/server/announce"
+	"github.com/imaikeru/peer-to-peer/shared/bencode"
+)
+
+const infoHash = "0123456789abcdefghij"
+
+func get(t *testing.T, server *httptest.Server, path string, query url.Values) map[string]interface{} {
+	response, err := http.Get(server.URL + path + "?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := bencode.Decode(body)
+	if err != nil {
+		t.Fatalf("could not decode %q: %v", body, err)
+	}
+	return decoded.(map[string]interface{})
+}
+
+func announceQuery(peerID, port, left, event string) url.Values {
+	return url.Values{
+		"info_hash": {infoHash},
+		"peer_id":   {peerID},
+		"port":      {port},
+		"left":      {left},
+		"event":     {event},
+		"ip":        {"10.0.0.1"},
+	}
+}
+
+func TestAnnounceAndScrape(t *testing.T) {
+	server := httptest.NewServer(announce.CreateTracker(time.Minute))
+	defer server.Close()
+
+	seeder := get(t, server, "/announce", announceQuery(strings.Repeat("s", 20), "6881", "0", "started"))
+	if peers := seeder["peers"]; peers != "" {
+		t.Errorf("got peers %q for the first peer, want none", peers)
+	}
+
+	leecher := get(t, server, "/announce", announceQuery(strings.Repeat("l", 20), "6882", "100", "started"))
+	if peers, expected := leecher["peers"], "\x0a\x00\x00\x01\x1a\xe1"; peers != expected {
+		t.Errorf("got compact peers %q, want %q", peers, expected)
+	}
+	if leecher["complete"] != int64(1) || leecher["incomplete"] != int64(1) || leecher["interval"] != int64(60) {
+		t.Errorf("got %v, want 1 complete and 1 incomplete peer and an interval of 60 seconds", leecher)
+	}
+
+	listQuery := announceQuery(strings.Repeat("l", 20), "6882", "0", "completed")
+	listQuery.Set("compact", "0")
+	completed := get(t, server, "/announce", listQuery)
+	expectedPeers := []interface{}{map[string]interface{}{"peer id": strings.Repeat("s", 20), "ip": "10.0.0.1", "port": int64(6881)}}
+	if !reflect.DeepEqual(completed["peers"], expectedPeers) {
+		t.Errorf("got peers %v, want %v", completed["peers"], expectedPeers)
+	}
+
+	get(t, server, "/announce", announceQuery(strings.Repeat("s", 20), "6881", "0", "stopped"))
+
+	scrape := get(t, server, "/scrape", url.Values{"info_hash": {infoHash}})
+	expected := map[string]interface{}{
+		infoHash: map[string]interface{}{"complete": int64(1), "incomplete": int64(0), "downloaded": int64(1)},
+	}
+	if !reflect.DeepEqual(scrape["files"], expected) {
+		t.Errorf("got %v, want %v", scrape["files"], expected)
+	}
+}
+
+func TestAnnounceRejectsInvalidRequests(t *testing.T) {
+	server := httptest.NewServer(announce.CreateTracker(time.Minute))
+	defer server.Close()
+
+	var tests = []struct {
+		name  string
+		query url.Values
+	}{
+		{"short info hash", url.Values{"info_hash": {"abc"}, "peer_id": {strings.Repeat("p", 20)}, "port": {"6881"}}},
+		{"missing peer id", url.Values{"info_hash": {infoHash}, "port": {"6881"}}},
+		{"invalid port", url.Values{"info_hash": {infoHash}, "peer_id": {strings.Repeat("p", 20)}, "port": {"70000"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if response := get(t, server, "/announce", tt.query); response["failure reason"] == nil {
+				t.Errorf("got %v, want a failure reason", response)
+			}
+		})
+	}
+}
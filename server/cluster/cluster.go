@@ -0,0 +1,631 @@
+// Package cluster runs central servers as a primary and standbys. The servers elect the primary like Raft does
+// and the primary replicates a log of state changes to the standbys, so that any of them can take over with the same state
+// when the primary stops. The log is kept in memory and the servers talk to each other over HTTP.
+package cluster
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// VotePath is the path on which a server asks the others to elect it
+	VotePath = "/cluster/vote"
+	// AppendPath is the path on which the primary sends log entries and heartbeats to the standbys
+	AppendPath = "/cluster/append"
+
+	authorizationPrefix = "Bearer "
+	maxMessageSize      = 64 << 20
+	// the primary sends this many heartbeats during an election timeout
+	heartbeatsPerTimeout = 5
+	maxEntriesPerAppend  = 256
+)
+
+var (
+	// ErrNotPrimary is returned when a change is proposed to a server that is not the primary
+	ErrNotPrimary = errors.New("this server is not the primary")
+	// ErrNotCommitted is returned when a majority of the servers did not store a change in time
+	ErrNotCommitted = errors.New("the change was not replicated to a majority of the servers in time")
+)
+
+// Role is the role of a server in the cluster
+type Role int
+
+const (
+	// Standby servers replicate the log of the primary and refuse clients
+	Standby Role = iota
+	// Candidate servers are asking the others to elect them
+	Candidate
+	// Primary is the server that clients connect to and whose log is replicated
+	Primary
+)
+
+func (r Role) String() string {
+	switch r {
+	case Candidate:
+		return "candidate"
+	case Primary:
+		return "primary"
+	}
+	return "standby"
+}
+
+// Entry is a struct that contains:
+//    - Term    - the term of the primary that added the entry
+//    - Command - the state change, empty for the entry every new primary starts its term with
+type Entry struct {
+	Term    uint64 `json:"term"`
+	Command string `json:"command"`
+}
+
+type voteRequest struct {
+	Term         uint64 `json:"term"`
+	Candidate    string `json:"candidate"`
+	LastLogIndex uint64 `json:"last_log_index"`
+	LastLogTerm  uint64 `json:"last_log_term"`
+}
+
+type voteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+type appendRequest struct {
+	Term          uint64  `json:"term"`
+	Leader        string  `json:"leader"`
+	LeaderTracker string  `json:"leader_tracker"`
+	PrevLogIndex  uint64  `json:"prev_log_index"`
+	PrevLogTerm   uint64  `json:"prev_log_term"`
+	Entries       []Entry `json:"entries"`
+	LeaderCommit  uint64  `json:"leader_commit"`
+}
+
+// appendResponse is the answer to an appendRequest, "LastLogIndex" tells the primary from where to resend the log
+// when the entries did not fit
+type appendResponse struct {
+	Term         uint64 `json:"term"`
+	Success      bool   `json:"success"`
+	LastLogIndex uint64 `json:"last_log_index"`
+}
+
+// Node is a struct that contains:
+//    - address          - the address of the cluster endpoint of the server, which identifies it in the cluster
+//    - tracker          - the address clients connect to when the server is the primary
+//    - token            - the secret shared by all servers of the cluster
+//    - peers            - the cluster addresses of the other servers
+//    - electionTimeout  - how long a standby waits for the primary before it asks to be elected
+//    - apply            - called with every committed command, in the order of the log
+//    - client           - the HTTP client requests to the other servers are sent with
+//    - role             - the role of the server
+//    - term             - the current term, which grows with every election
+//    - votedFor         - the server this one voted for in the current term, empty if it has not voted
+//    - primary          - the cluster address of the primary, empty if it is not known
+//    - primaryTracker   - the address clients connect to on the primary, empty if it is not known
+//    - log              - the replicated log, the first entry is a placeholder so that entries are numbered from 1
+//    - commitIndex      - the number of the last entry stored on a majority of the servers
+//    - lastApplied      - the number of the last entry passed to "apply"
+//    - nextIndex        - a map whose keys are peers and values are the numbers of the next entries sent to them
+//    - matchIndex       - a map whose keys are peers and values are the numbers of the last entries they stored
+//    - electionDeadline - when the server asks to be elected unless it hears from a primary
+//    - changed          - closed and replaced whenever the role, the term or "commitIndex" changes
+//    - mutex            - a Mutex that is used for working safely with the state above
+//    - applyMutex       - a Mutex that keeps "apply" called in the order of the log
+//    - stopped          - closed when the node stops
+type Node struct {
+	address          string
+	tracker          string
+	token            string
+	peers            []string
+	electionTimeout  time.Duration
+	apply            func(command string)
+	client           *http.Client
+	role             Role
+	term             uint64
+	votedFor         string
+	primary          string
+	primaryTracker   string
+	log              []Entry
+	commitIndex      uint64
+	lastApplied      uint64
+	nextIndex        map[string]uint64
+	matchIndex       map[string]uint64
+	electionDeadline time.Time
+	changed          chan struct{}
+	mutex            sync.Mutex
+	applyMutex       sync.Mutex
+	stopped          chan struct{}
+}
+
+// CreateNode is a factory method that:
+//    - accepts:
+//         - address         - the address("host:port") of the cluster endpoint of this server, as the other servers list it
+//         - tracker         - the address clients connect to when this server is the primary
+//         - token           - the secret shared by all servers of the cluster
+//         - peers           - the cluster addresses of the other servers
+//         - electionTimeout - how long a standby waits for the primary before it asks to be elected
+//         - apply           - called with every committed command, in the order of the log
+//    - creates and returns a pointer to a standby Node with an empty log
+func CreateNode(address, tracker, token string, peers []string, electionTimeout time.Duration, apply func(command string)) *Node {
+	n := &Node{
+		address:         address,
+		tracker:         tracker,
+		token:           token,
+		peers:           peers,
+		electionTimeout: electionTimeout,
+		apply:           apply,
+		client:          &http.Client{Timeout: electionTimeout},
+		log:             []Entry{{}},
+		nextIndex:       make(map[string]uint64),
+		matchIndex:      make(map[string]uint64),
+		changed:         make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	n.resetElectionDeadline()
+	return n
+}
+
+// Role returns the role of the server
+func (n *Node) Role() Role {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.role
+}
+
+// Term returns the current term
+func (n *Node) Term() uint64 {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.term
+}
+
+// Primary returns the address clients connect to on the primary, empty if no primary is known
+func (n *Node) Primary() string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.primaryTracker
+}
+
+// Peers returns the cluster addresses of the other servers
+func (n *Node) Peers() []string {
+	return n.peers
+}
+
+// Stop stops the elections and heartbeats of the node
+func (n *Node) Stop() {
+	select {
+	case <-n.stopped:
+	default:
+		close(n.stopped)
+	}
+}
+
+// Serve is a function that:
+//    - answers the other servers of the cluster on "address"
+//    (***) Returns error if the HTTP server cannot be started
+func (n *Node) Serve(address string) error {
+	if err := http.ListenAndServe(address, n); err != nil {
+		return fmt.Errorf("Error starting cluster endpoint on %s. %w", address, err)
+	}
+	return nil
+}
+
+// Run is a function that sends heartbeats while the server is the primary
+// and starts an election when a standby has not heard from the primary in time, until the node is stopped
+func (n *Node) Run() {
+	ticker := time.NewTicker(n.electionTimeout / heartbeatsPerTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stopped:
+			return
+		case <-ticker.C:
+		}
+
+		n.mutex.Lock()
+		role, expired := n.role, time.Now().After(n.electionDeadline)
+		n.mutex.Unlock()
+
+		if role == Primary {
+			n.replicate()
+		} else if expired {
+			n.campaign()
+		}
+	}
+}
+
+// Propose is a function that:
+//    - accepts:
+//         - command - the state change
+//    - appends "command" to the log and waits until a majority of the servers stored it and it was applied on this server
+//    (***) Returns ErrNotPrimary if the server is not the primary or stops being it,
+//    ErrNotCommitted if a majority did not store it in an election timeout
+func (n *Node) Propose(command string) error {
+	n.mutex.Lock()
+	if n.role != Primary {
+		n.mutex.Unlock()
+		return ErrNotPrimary
+	}
+	n.log = append(n.log, Entry{Term: n.term, Command: command})
+	index, term := uint64(len(n.log)-1), n.term
+	n.advanceCommit()
+	n.mutex.Unlock()
+
+	n.replicate()
+
+	deadline := time.NewTimer(n.electionTimeout)
+	defer deadline.Stop()
+
+	for {
+		n.mutex.Lock()
+		committed := n.commitIndex >= index && n.log[index].Term == term
+		lost := n.term != term || n.role != Primary
+		changed := n.changed
+		n.mutex.Unlock()
+
+		if committed {
+			n.applyCommitted()
+			return nil
+		}
+		if lost {
+			return ErrNotPrimary
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return ErrNotCommitted
+		}
+	}
+}
+
+func (n *Node) majority() int {
+	return (len(n.peers)+1)/2 + 1
+}
+
+// resetElectionDeadline is a function that postpones the next election by a random time between one and two election timeouts,
+// so that the standbys rarely ask to be elected at the same time
+func (n *Node) resetElectionDeadline() {
+	n.electionDeadline = time.Now().Add(n.electionTimeout + time.Duration(rand.Int63n(int64(n.electionTimeout))))
+}
+
+// notify is a function that wakes up everyone waiting for a change, called with "mutex" held
+func (n *Node) notify() {
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+// becomeStandby is a function that makes the server a standby in "term", following "primary" if it is not empty.
+// Called with "mutex" held.
+func (n *Node) becomeStandby(term uint64, primary, primaryTracker string) {
+	if term > n.term {
+		n.term = term
+		n.votedFor = ""
+	}
+	n.role = Standby
+	if primary != "" {
+		n.resetElectionDeadline()
+	}
+	n.primary, n.primaryTracker = primary, primaryTracker
+	n.notify()
+}
+
+func (n *Node) lastLog() (uint64, uint64) {
+	index := uint64(len(n.log) - 1)
+	return index, n.log[index].Term
+}
+
+// campaign is a function that starts a new term and asks the other servers to elect this one
+func (n *Node) campaign() {
+	n.mutex.Lock()
+	n.term++
+	n.role = Candidate
+	n.votedFor = n.address
+	n.primary, n.primaryTracker = "", ""
+	n.resetElectionDeadline()
+	n.notify()
+	request := voteRequest{Term: n.term, Candidate: n.address}
+	request.LastLogIndex, request.LastLogTerm = n.lastLog()
+	n.mutex.Unlock()
+
+	votes := make(chan bool, len(n.peers))
+	for _, peer := range n.peers {
+		go func(peer string) {
+			var response voteResponse
+			if err := n.call(peer, VotePath, request, &response); err != nil {
+				votes <- false
+				return
+			}
+
+			n.mutex.Lock()
+			if response.Term > n.term {
+				n.becomeStandby(response.Term, "", "")
+			}
+			n.mutex.Unlock()
+			votes <- response.Granted
+		}(peer)
+	}
+
+	granted := 1
+	for i := 0; granted < n.majority() && i < len(n.peers); i++ {
+		if <-votes {
+			granted++
+		}
+	}
+	if granted >= n.majority() {
+		n.becomePrimary(request.Term)
+	}
+}
+
+// becomePrimary is a function that makes a candidate of "term" the primary.
+// The primary starts its term with an empty entry, since entries of earlier terms count as committed only together with one of its own.
+func (n *Node) becomePrimary(term uint64) {
+	n.mutex.Lock()
+	if n.term != term || n.role != Candidate {
+		n.mutex.Unlock()
+		return
+	}
+
+	n.role = Primary
+	n.primary, n.primaryTracker = n.address, n.tracker
+	n.log = append(n.log, Entry{Term: n.term})
+	for _, peer := range n.peers {
+		n.nextIndex[peer] = uint64(len(n.log) - 1)
+		n.matchIndex[peer] = 0
+	}
+	n.advanceCommit()
+	n.notify()
+	n.mutex.Unlock()
+
+	n.replicate()
+}
+
+// replicate is a function that sends the entries each standby is missing, or a heartbeat if it has them all
+func (n *Node) replicate() {
+	for _, peer := range n.peers {
+		go n.sendAppend(peer)
+	}
+}
+
+func (n *Node) sendAppend(peer string) {
+	n.mutex.Lock()
+	if n.role != Primary {
+		n.mutex.Unlock()
+		return
+	}
+	next := n.nextIndex[peer]
+	end := uint64(len(n.log))
+	if end-next > maxEntriesPerAppend {
+		end = next + maxEntriesPerAppend
+	}
+	request := appendRequest{
+		Term:          n.term,
+		Leader:        n.address,
+		LeaderTracker: n.tracker,
+		PrevLogIndex:  next - 1,
+		PrevLogTerm:   n.log[next-1].Term,
+		Entries:       append([]Entry(nil), n.log[next:end]...),
+		LeaderCommit:  n.commitIndex,
+	}
+	n.mutex.Unlock()
+
+	var response appendResponse
+	if err := n.call(peer, AppendPath, request, &response); err != nil {
+		return
+	}
+
+	n.mutex.Lock()
+	if response.Term > n.term {
+		n.becomeStandby(response.Term, "", "")
+		n.mutex.Unlock()
+		return
+	}
+	if n.role != Primary || n.term != request.Term {
+		n.mutex.Unlock()
+		return
+	}
+
+	if response.Success {
+		if match := request.PrevLogIndex + uint64(len(request.Entries)); match > n.matchIndex[peer] {
+			n.matchIndex[peer] = match
+			n.nextIndex[peer] = match + 1
+		}
+		n.advanceCommit()
+	} else if next := response.LastLogIndex + 1; next < n.nextIndex[peer] {
+		n.nextIndex[peer] = next
+	} else if n.nextIndex[peer] > 1 {
+		n.nextIndex[peer]--
+	}
+	n.mutex.Unlock()
+
+	n.applyCommitted()
+}
+
+// advanceCommit is a function that commits the last entry of the current term that a majority of the servers stored.
+// Called with "mutex" held.
+func (n *Node) advanceCommit() {
+	for index := uint64(len(n.log) - 1); index > n.commitIndex; index-- {
+		if n.log[index].Term != n.term {
+			break
+		}
+
+		stored := 1
+		for _, peer := range n.peers {
+			if n.matchIndex[peer] >= index {
+				stored++
+			}
+		}
+		if stored >= n.majority() {
+			n.commitIndex = index
+			n.notify()
+			return
+		}
+	}
+}
+
+// applyCommitted is a function that passes the committed entries that have not been applied yet to "apply"
+func (n *Node) applyCommitted() {
+	n.applyMutex.Lock()
+	defer n.applyMutex.Unlock()
+
+	n.mutex.Lock()
+	entries := append([]Entry(nil), n.log[n.lastApplied+1:n.commitIndex+1]...)
+	n.lastApplied = n.commitIndex
+	n.mutex.Unlock()
+
+	for _, entry := range entries {
+		if entry.Command != "" {
+			n.apply(entry.Command)
+		}
+	}
+}
+
+func (n *Node) handleVote(request voteRequest) voteResponse {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if request.Term > n.term {
+		n.becomeStandby(request.Term, "", "")
+	}
+
+	lastIndex, lastTerm := n.lastLog()
+	upToDate := request.LastLogTerm > lastTerm || (request.LastLogTerm == lastTerm && request.LastLogIndex >= lastIndex)
+	granted := request.Term == n.term && (n.votedFor == "" || n.votedFor == request.Candidate) && upToDate
+	if granted {
+		n.votedFor = request.Candidate
+		n.resetElectionDeadline()
+	}
+
+	return voteResponse{Term: n.term, Granted: granted}
+}
+
+func (n *Node) handleAppend(request appendRequest) appendResponse {
+	n.mutex.Lock()
+
+	if request.Term < n.term {
+		defer n.mutex.Unlock()
+		return appendResponse{Term: n.term, LastLogIndex: uint64(len(n.log) - 1)}
+	}
+	n.becomeStandby(request.Term, request.Leader, request.LeaderTracker)
+
+	if request.PrevLogIndex >= uint64(len(n.log)) {
+		defer n.mutex.Unlock()
+		return appendResponse{Term: n.term, LastLogIndex: uint64(len(n.log) - 1)}
+	}
+	if n.log[request.PrevLogIndex].Term != request.PrevLogTerm {
+		n.log = n.log[:request.PrevLogIndex]
+		defer n.mutex.Unlock()
+		return appendResponse{Term: n.term, LastLogIndex: request.PrevLogIndex - 1}
+	}
+
+	for i, entry := range request.Entries {
+		index := request.PrevLogIndex + 1 + uint64(i)
+		if index < uint64(len(n.log)) {
+			if n.log[index].Term == entry.Term {
+				continue
+			}
+			n.log = n.log[:index]
+		}
+		n.log = append(n.log, entry)
+	}
+
+	if lastNew := request.PrevLogIndex + uint64(len(request.Entries)); request.LeaderCommit > n.commitIndex {
+		n.commitIndex = request.LeaderCommit
+		if lastNew < n.commitIndex {
+			n.commitIndex = lastNew
+		}
+		n.notify()
+	}
+	response := appendResponse{Term: n.term, Success: true, LastLogIndex: uint64(len(n.log) - 1)}
+	n.mutex.Unlock()
+
+	n.applyCommitted()
+	return response
+}
+
+// call is a function that posts "request" to "path" on "peer" and decodes its answer into "response"
+func (n *Node) call(peer, path string, request, response interface{}) error {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("Could not encode request. %w", err)
+	}
+
+	httpRequest, err := http.NewRequest(http.MethodPost, "http://"+peer+path, bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("%s: %v", peer, err)
+	}
+	httpRequest.Header.Set("Authorization", authorizationPrefix+n.token)
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	httpResponse, err := n.client.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf("%s: %v", peer, err)
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", peer, httpResponse.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(httpResponse.Body, maxMessageSize)).Decode(response); err != nil {
+		return fmt.Errorf("%s: malformed answer. %v", peer, err)
+	}
+	return nil
+}
+
+// ServeHTTP answers the vote and append requests of servers that know the shared token
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != VotePath && r.URL.Path != AppendPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "cluster requests have to be posted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), authorizationPrefix)
+	if n.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(n.token)) != 1 {
+		http.Error(w, "wrong cluster token", http.StatusUnauthorized)
+		return
+	}
+
+	select {
+	case <-n.stopped:
+		http.Error(w, "the server has left the cluster", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	body := json.NewDecoder(io.LimitReader(r.Body, maxMessageSize))
+	var response interface{}
+	if r.URL.Path == VotePath {
+		var request voteRequest
+		if err := body.Decode(&request); err != nil {
+			http.Error(w, "malformed vote request", http.StatusBadRequest)
+			return
+		}
+		response = n.handleVote(request)
+	} else {
+		var request appendRequest
+		if err := body.Decode(&request); err != nil {
+			http.Error(w, "malformed append request", http.StatusBadRequest)
+			return
+		}
+		response = n.handleAppend(request)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
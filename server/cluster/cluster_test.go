@@ -0,0 +1,220 @@
+package cluster_test
+
+import (
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/server/cluster"
+)
+
+const (
+	token           = "shared-secret"
+	electionTimeout = 150 * time.Millisecond
+	waitTimeout     = 5 * time.Second
+)
+
+// server is a struct that contains:
+//    - node     - the cluster node of the server
+//    - applied  - the commands the server applied, in order
+//    - mutex    - a Mutex that is used for working safely with "applied"
+//    - listener - the listener of the cluster endpoint
+type server struct {
+	node     *cluster.Node
+	applied  []string
+	mutex    sync.Mutex
+	listener net.Listener
+}
+
+func (s *server) commands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string(nil), s.applied...)
+}
+
+// stop is a function that makes the server look dead to the others
+func (s *server) stop() {
+	s.node.Stop()
+	s.listener.Close()
+}
+
+// startCluster is a function that starts "count" servers on loopback ports, every one of them peering with all the others
+func startCluster(t *testing.T, count int) []*server {
+	t.Helper()
+
+	listeners := make([]net.Listener, count)
+	for i := range listeners {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[i] = listener
+	}
+
+	servers := make([]*server, count)
+	for i, listener := range listeners {
+		peers := make([]string, 0, count-1)
+		for j, other := range listeners {
+			if j != i {
+				peers = append(peers, other.Addr().String())
+			}
+		}
+
+		s := &server{listener: listener}
+		s.node = cluster.CreateNode(listener.Addr().String(), "tracker-"+listener.Addr().String(), token, peers, electionTimeout, func(command string) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			s.applied = append(s.applied, command)
+		})
+		servers[i] = s
+
+		go http.Serve(listener, s.node)
+		go s.node.Run()
+	}
+
+	t.Cleanup(func() {
+		for _, s := range servers {
+			s.stop()
+		}
+	})
+	return servers
+}
+
+// waitForPrimary is a function that waits until exactly one of "servers" is the primary and returns it
+func waitForPrimary(t *testing.T, servers []*server) *server {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		var primaries []*server
+		for _, s := range servers {
+			if s.node.Role() == cluster.Primary {
+				primaries = append(primaries, s)
+			}
+		}
+		if len(primaries) == 1 {
+			return primaries[0]
+		}
+		time.Sleep(electionTimeout / 5)
+	}
+
+	t.Fatal("no primary was elected")
+	return nil
+}
+
+func waitForCommands(t *testing.T, s *server, expected []string) {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		if reflect.DeepEqual(s.commands(), expected) {
+			return
+		}
+		time.Sleep(electionTimeout / 5)
+	}
+
+	t.Fatalf("expected commands %v, got %v", expected, s.commands())
+}
+
+func without(servers []*server, excluded *server) []*server {
+	rest := make([]*server, 0, len(servers))
+	for _, s := range servers {
+		if s != excluded {
+			rest = append(rest, s)
+		}
+	}
+	return rest
+}
+
+func TestStandbysReplicateThePrimary(t *testing.T) {
+	servers := startCluster(t, 3)
+	primary := waitForPrimary(t, servers)
+
+	commands := []string{"ban 10.0.0.1", "group-add alice team bob", "group-remove alice team bob"}
+	for _, command := range commands {
+		if err := primary.node.Propose(command); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := primary.commands(); !reflect.DeepEqual(got, commands) {
+		t.Errorf("expected the primary to apply %v before Propose returns, got %v", commands, got)
+	}
+
+	for _, standby := range without(servers, primary) {
+		waitForCommands(t, standby, commands)
+		if err := standby.node.Propose("ban 10.0.0.2"); err != cluster.ErrNotPrimary {
+			t.Errorf("expected ErrNotPrimary from a standby, got %v", err)
+		}
+		if got, expected := standby.node.Primary(), "tracker-"+primary.listener.Addr().String(); got != expected {
+			t.Errorf("expected a standby to point clients to %q, got %q", expected, got)
+		}
+	}
+}
+
+func TestStandbyTakesOverWhenThePrimaryStops(t *testing.T) {
+	servers := startCluster(t, 3)
+	first := waitForPrimary(t, servers)
+	if err := first.node.Propose("ban mallory"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range servers {
+		waitForCommands(t, s, []string{"ban mallory"})
+	}
+
+	first.stop()
+	rest := without(servers, first)
+	second := waitForPrimary(t, rest)
+	if second.node.Term() <= first.node.Term() {
+		t.Errorf("expected the new primary to start a later term than %d, got %d", first.node.Term(), second.node.Term())
+	}
+
+	if err := second.node.Propose("ban eve"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range rest {
+		waitForCommands(t, s, []string{"ban mallory", "ban eve"})
+	}
+}
+
+func TestMinorityCannotCommit(t *testing.T) {
+	servers := startCluster(t, 3)
+	primary := waitForPrimary(t, servers)
+	for _, standby := range without(servers, primary) {
+		standby.stop()
+	}
+
+	if err := primary.node.Propose("ban mallory"); err != cluster.ErrNotCommitted && err != cluster.ErrNotPrimary {
+		t.Errorf("expected the change to fail without a majority, got %v", err)
+	}
+	if got := primary.commands(); len(got) != 0 {
+		t.Errorf("expected nothing to be applied without a majority, got %v", got)
+	}
+}
+
+func TestWrongTokenIsRejected(t *testing.T) {
+	servers := startCluster(t, 1)
+
+	request, err := http.NewRequest(http.MethodPost, "http://"+servers[0].listener.Addr().String()+cluster.VotePath, strings.NewReader(`{"term":100,"candidate":"intruder"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer wrong")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, response.StatusCode)
+	}
+	if term := servers[0].node.Term(); term >= 100 {
+		t.Errorf("expected the term not to be changed by a rejected request, got %d", term)
+	}
+}
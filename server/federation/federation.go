@@ -0,0 +1,328 @@
+// Package federation replicates the index of a central server to its peers, so that several servers,
+// e.g. one per office, answer with a merged view of all users and files.
+// Every server periodically pushes a snapshot of its own users, files and groups to all of its peers over HTTP.
+package federation
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SnapshotPath is the path on which a server accepts the snapshots of its peers
+	SnapshotPath = "/federation/snapshot"
+
+	authorizationPrefix = "Bearer "
+	deviceSeparator     = "@"
+	maxSnapshotSize     = 64 << 20
+)
+
+// User is a struct that contains:
+//    - Identity          - the username of the user, e.g. "alice" or "alice@laptop"
+//    - MiniServerAddress - the address of the mini server of the user
+//    - Reachability      - whether the origin could reach the mini server("reachable", "unreachable" or "unknown")
+//    - ConnectedAt       - when the user connected to the origin, the earliest user keeps a username that is used on several servers
+type User struct {
+	Identity          string    `json:"identity"`
+	MiniServerAddress string    `json:"mini_server_address"`
+	Reachability      string    `json:"reachability"`
+	ConnectedAt       time.Time `json:"connected_at"`
+}
+
+// File is a struct that contains:
+//    - Identity  - the username of the user that registered the file
+//    - Path      - the path of the file on the mini server of the user
+//    - Scope     - who can see the file("public", "group:name" or "users:first,second")
+//    - ContentID - the content ID of the file, empty if the client has not reported it
+//    - Size      - the size of the file in bytes
+//    - InfoHash  - the BitTorrent info hash of the file, empty if the client has not reported it
+type File struct {
+	Identity  string `json:"identity"`
+	Path      string `json:"path"`
+	Scope     string `json:"scope"`
+	ContentID string `json:"content_id,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	InfoHash  string `json:"info_hash,omitempty"`
+}
+
+// Group is a struct that contains:
+//    - Name    - the name of the sharing group
+//    - Owner   - the username that manages the group
+//    - Members - the usernames in the group
+type Group struct {
+	Name    string   `json:"name"`
+	Owner   string   `json:"owner"`
+	Members []string `json:"members"`
+}
+
+// Snapshot is a struct that contains:
+//    - Origin   - the name of the server the snapshot comes from
+//    - Users    - the users connected to the origin
+//    - Files    - the files registered on the origin
+//    - Groups   - the sharing groups of the origin, which decide who can see its group scoped files
+//    - Received - when the snapshot was received, set by the receiving server
+type Snapshot struct {
+	Origin   string    `json:"origin"`
+	Users    []User    `json:"users"`
+	Files    []File    `json:"files"`
+	Groups   []Group   `json:"groups"`
+	Received time.Time `json:"-"`
+}
+
+// Federation is a struct that contains:
+//    - name      - the name of this server, with which its snapshots are tagged
+//    - token     - the secret shared by all servers of the federation
+//    - peers     - the addresses of the federation endpoints of the other servers
+//    - maxAge    - how long a snapshot is used, servers that have not pushed for longer are left out of the merged view
+//    - snapshots - a map whose keys are names of other servers and values are their last snapshots
+//    - mutex     - a Mutex that is used for working safely with "snapshots"
+//    - client    - the HTTP client snapshots are pushed with
+type Federation struct {
+	name      string
+	token     string
+	peers     []string
+	maxAge    time.Duration
+	snapshots map[string]Snapshot
+	mutex     sync.RWMutex
+	client    *http.Client
+}
+
+// CreateFederation is a factory method that:
+//    - accepts:
+//         - name   - the name of this server
+//         - token  - the secret shared by all servers of the federation
+//         - peers  - the addresses("host:port") of the federation endpoints of the other servers
+//         - maxAge - how long a snapshot of a peer is used
+//    - creates and returns a pointer to a Federation struct without snapshots
+func CreateFederation(name, token string, peers []string, maxAge time.Duration) *Federation {
+	return &Federation{
+		name:      name,
+		token:     token,
+		peers:     peers,
+		maxAge:    maxAge,
+		snapshots: make(map[string]Snapshot),
+		client:    &http.Client{Timeout: maxAge},
+	}
+}
+
+// Name returns the name of this server
+func (f *Federation) Name() string {
+	return f.name
+}
+
+// Peers returns the addresses of the federation endpoints of the other servers
+func (f *Federation) Peers() []string {
+	return f.peers
+}
+
+// Push is a function that:
+//    - sends "snapshot" of this server, tagged with its name, to all peers
+//    (***) Returns error naming the peers that did not accept it
+func (f *Federation) Push(snapshot Snapshot) error {
+	snapshot.Origin = f.name
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("Could not encode snapshot. %w", err)
+	}
+
+	var failed []string
+	for _, peer := range f.peers {
+		if err := f.pushTo(peer, encoded); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Could not push snapshot to %d of %d peers. %s", len(failed), len(f.peers), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (f *Federation) pushTo(peer string, encoded []byte) error {
+	request, err := http.NewRequest(http.MethodPost, "http://"+peer+SnapshotPath, bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("%s: %v", peer, err)
+	}
+	request.Header.Set("Authorization", authorizationPrefix+f.token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := f.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("%s: %v", peer, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("%s: %s", peer, response.Status)
+	}
+	return nil
+}
+
+// ServeHTTP accepts the snapshots of peers that know the shared token
+func (f *Federation) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != SnapshotPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "snapshots have to be posted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), authorizationPrefix)
+	if f.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(f.token)) != 1 {
+		http.Error(w, "wrong federation token", http.StatusUnauthorized)
+		return
+	}
+
+	var snapshot Snapshot
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxSnapshotSize)).Decode(&snapshot); err != nil {
+		http.Error(w, "malformed snapshot", http.StatusBadRequest)
+		return
+	}
+	if snapshot.Origin == "" || snapshot.Origin == f.name {
+		http.Error(w, "the snapshot has to come from another server", http.StatusBadRequest)
+		return
+	}
+
+	f.Receive(snapshot, time.Now())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Receive is a function that stores "snapshot", replacing the previous snapshot of its origin
+func (f *Federation) Receive(snapshot Snapshot, now time.Time) {
+	snapshot.Received = now
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.snapshots[snapshot.Origin] = snapshot
+}
+
+// Serve is a function that:
+//    - accepts the snapshots of peers on "address"
+//    (***) Returns error if the HTTP server cannot be started
+func (f *Federation) Serve(address string) error {
+	if err := http.ListenAndServe(address, f); err != nil {
+		return fmt.Errorf("Error starting federation endpoint on %s. %w", address, err)
+	}
+	return nil
+}
+
+// Snapshots is a function that returns the fresh snapshots of the peers, sorted by origin
+func (f *Federation) Snapshots(now time.Time) []Snapshot {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	fresh := make([]Snapshot, 0, len(f.snapshots))
+	for _, snapshot := range f.snapshots {
+		if now.Sub(snapshot.Received) <= f.maxAge {
+			fresh = append(fresh, snapshot)
+		}
+	}
+
+	sort.Slice(fresh, func(i, j int) bool { return fresh[i].Origin < fresh[j].Origin })
+	return fresh
+}
+
+// Merge is a function that:
+//    - accepts:
+//         - local - the users of this server
+//         - now   - the current time, snapshots older than the max age are left out
+//    - returns the fresh snapshots of the peers without the users, and their files, that lose a username conflict.
+//    Usernames conflict like on a single server: unless both users are on different named devices.
+//    Users of this server never lose on this server. Between users of other servers, the one that connected first wins,
+//    on a tie the one whose origin name is smaller.
+func (f *Federation) Merge(local []User, now time.Time) []Snapshot {
+	snapshots := f.Snapshots(now)
+
+	type contender struct {
+		origin string
+		user   User
+	}
+	contenders := make([]contender, 0)
+	for _, snapshot := range snapshots {
+		for _, user := range snapshot.Users {
+			contenders = append(contenders, contender{origin: snapshot.Origin, user: user})
+		}
+	}
+
+	loses := func(c contender) bool {
+		for _, user := range local {
+			if identitiesConflict(user.Identity, c.user.Identity) {
+				return true
+			}
+		}
+		for _, other := range contenders {
+			if other.origin == c.origin || !identitiesConflict(other.user.Identity, c.user.Identity) {
+				continue
+			}
+			if other.user.ConnectedAt.Before(c.user.ConnectedAt) ||
+				(other.user.ConnectedAt.Equal(c.user.ConnectedAt) && other.origin < c.origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	merged := make([]Snapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		losers := make(map[string]struct{})
+		kept := Snapshot{Origin: snapshot.Origin, Groups: snapshot.Groups, Received: snapshot.Received}
+		for _, user := range snapshot.Users {
+			if loses(contender{origin: snapshot.Origin, user: user}) {
+				losers[user.Identity] = struct{}{}
+				continue
+			}
+			kept.Users = append(kept.Users, user)
+		}
+		for _, file := range snapshot.Files {
+			if _, lost := losers[file.Identity]; !lost {
+				kept.Files = append(kept.Files, file)
+			}
+		}
+		merged = append(merged, kept)
+	}
+	return merged
+}
+
+// Owner is a function that returns the peer that has a user whose identity conflicts with "identity"
+//    (***) Returns false if no peer has such a user
+func (f *Federation) Owner(identity string, now time.Time) (string, bool) {
+	for _, snapshot := range f.Snapshots(now) {
+		for _, user := range snapshot.Users {
+			if identitiesConflict(user.Identity, identity) {
+				return snapshot.Origin, true
+			}
+		}
+	}
+	return "", false
+}
+
+func splitIdentity(identity string) (string, string) {
+	split := strings.SplitN(identity, deviceSeparator, 2)
+	if len(split) == 2 {
+		return split[0], split[1]
+	}
+	return identity, ""
+}
+
+// identitiesConflict is a function that returns whether two identities cannot be held by different users,
+// which is the case unless both are on different named devices of the same username
+func identitiesConflict(first, second string) bool {
+	firstUsername, firstDevice := splitIdentity(first)
+	secondUsername, secondDevice := splitIdentity(second)
+
+	if firstUsername != secondUsername {
+		return false
+	}
+	return firstDevice == "" || secondDevice == "" || firstDevice == secondDevice
+}
@@ -0,0 +1,179 @@
+package federation_test
+
+import (
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/server/federation"
+)
+
+const token = "shared-secret"
+
+// startServers is a function that starts the federation endpoints of servers with "names" on loopback ports,
+// every one of them peering with all the others
+func startServers(t *testing.T, names ...string) map[string]*federation.Federation {
+	t.Helper()
+
+	listeners := make(map[string]net.Listener)
+	for _, name := range names {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[name] = listener
+	}
+
+	federations := make(map[string]*federation.Federation)
+	for _, name := range names {
+		peers := make([]string, 0, len(names)-1)
+		for _, other := range names {
+			if other != name {
+				peers = append(peers, listeners[other].Addr().String())
+			}
+		}
+		federations[name] = federation.CreateFederation(name, token, peers, time.Minute)
+		go http.Serve(listeners[name], federations[name])
+	}
+
+	t.Cleanup(func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	})
+	return federations
+}
+
+func origins(snapshots []federation.Snapshot) []string {
+	names := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		names = append(names, snapshot.Origin)
+	}
+	return names
+}
+
+func TestPushReplicatesToAllPeers(t *testing.T) {
+	servers := startServers(t, "sofia", "plovdiv", "varna")
+
+	snapshot := federation.Snapshot{
+		Users: []federation.User{{Identity: "alice", MiniServerAddress: "10.0.0.1:4000", Reachability: "reachable"}},
+		Files: []federation.File{{Identity: "alice", Path: "/report.pdf", Scope: "public"}},
+	}
+	if err := servers["sofia"].Push(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := servers["varna"].Push(federation.Snapshot{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		server   string
+		expected []string
+	}{
+		{"sofia", []string{"varna"}},
+		{"plovdiv", []string{"sofia", "varna"}},
+		{"varna", []string{"sofia"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.server, func(t *testing.T) {
+			snapshots := servers[test.server].Snapshots(time.Now())
+			if got := origins(snapshots); !reflect.DeepEqual(got, test.expected) {
+				t.Fatalf("got snapshots from %v, want from %v", got, test.expected)
+			}
+		})
+	}
+
+	replicated := servers["plovdiv"].Snapshots(time.Now())[0]
+	if !reflect.DeepEqual(replicated.Files, snapshot.Files) || !reflect.DeepEqual(replicated.Users, snapshot.Users) {
+		t.Fatalf("got %+v, want the users and files of %+v", replicated, snapshot)
+	}
+}
+
+func TestPushWithWrongTokenIsRejected(t *testing.T) {
+	servers := startServers(t, "sofia", "plovdiv")
+
+	intruder := federation.CreateFederation("intruder", "guess", servers["sofia"].Peers(), time.Minute)
+	if err := intruder.Push(federation.Snapshot{}); err == nil {
+		t.Fatal("got no error, want the snapshot to be rejected")
+	}
+	if snapshots := servers["plovdiv"].Snapshots(time.Now()); len(snapshots) != 0 {
+		t.Fatalf("got %v, want no snapshots", origins(snapshots))
+	}
+}
+
+func TestMergeResolvesUsernameConflicts(t *testing.T) {
+	early := time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	now := late
+
+	f := federation.CreateFederation("sofia", token, nil, time.Minute)
+	f.Receive(federation.Snapshot{
+		Origin: "plovdiv",
+		Users: []federation.User{
+			{Identity: "alice", ConnectedAt: late},
+			{Identity: "bob@laptop", ConnectedAt: late},
+			{Identity: "carol", ConnectedAt: early},
+		},
+		Files: []federation.File{
+			{Identity: "alice", Path: "/plovdiv/alice"},
+			{Identity: "bob@laptop", Path: "/plovdiv/bob"},
+			{Identity: "carol", Path: "/plovdiv/carol"},
+		},
+	}, now)
+	f.Receive(federation.Snapshot{
+		Origin: "varna",
+		Users: []federation.User{
+			{Identity: "alice", ConnectedAt: early},
+			{Identity: "bob@desktop", ConnectedAt: early},
+		},
+		Files: []federation.File{
+			{Identity: "alice", Path: "/varna/alice"},
+			{Identity: "bob@desktop", Path: "/varna/bob"},
+		},
+	}, now)
+	f.Receive(federation.Snapshot{Origin: "burgas", Users: []federation.User{{Identity: "dave"}}}, now.Add(-2*time.Minute))
+
+	local := []federation.User{{Identity: "carol", ConnectedAt: late}}
+
+	expected := []federation.Snapshot{
+		{
+			Origin:   "plovdiv",
+			Users:    []federation.User{{Identity: "bob@laptop", ConnectedAt: late}},
+			Files:    []federation.File{{Identity: "bob@laptop", Path: "/plovdiv/bob"}},
+			Received: now,
+		},
+		{
+			Origin:   "varna",
+			Users:    []federation.User{{Identity: "alice", ConnectedAt: early}, {Identity: "bob@desktop", ConnectedAt: early}},
+			Files:    []federation.File{{Identity: "alice", Path: "/varna/alice"}, {Identity: "bob@desktop", Path: "/varna/bob"}},
+			Received: now,
+		},
+	}
+
+	if got := f.Merge(local, now); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %+v, want %+v", got, expected)
+	}
+
+	tests := []struct {
+		identity string
+		origin   string
+		owned    bool
+	}{
+		{"alice", "plovdiv", true},
+		{"bob@phone", "", false},
+		{"bob", "plovdiv", true},
+		{"dave", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.identity, func(t *testing.T) {
+			origin, owned := f.Owner(test.identity, now)
+			if origin != test.origin || owned != test.owned {
+				t.Fatalf("got %q %v, want %q %v", origin, owned, test.origin, test.owned)
+			}
+		})
+	}
+}
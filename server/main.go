@@ -1,15 +1,85 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"strings"
 
 	"github.com/imaikeru/peer-to-peer/server/server"
 )
 
-const port = "13337"
+const defaultPort = "13337"
 
 func main() {
-	ts := server.CreateNewServer(port)
+	config := server.CreateDefaultConfig()
+
+	port := flag.String("port", defaultPort, "the port on which clients connect to the server")
+	configPath := flag.String("config", "", "path to a JSON config file, which is re-read by the \"reload-config\" admin command")
+	flag.DurationVar(&config.HeartbeatInterval, "heartbeat_interval", config.HeartbeatInterval, "how often clients are pinged and leases are checked")
+	flag.DurationVar(&config.LeaseDuration, "lease_duration", config.LeaseDuration, "how long a silent client stays registered")
+	flag.DurationVar(&config.ProbeInterval, "probe_interval", config.ProbeInterval, "how often the mini servers of clients are probed")
+	flag.DurationVar(&config.ProbeTimeout, "probe_timeout", config.ProbeTimeout, "how long to wait for a mini server to answer a probe")
+	flag.StringVar(&config.AdminAddress, "admin_address", config.AdminAddress, "address of the admin interface, \"host:port\" or \"unix:/path/to/socket\"")
+	flag.StringVar(&config.AdminToken, "admin_token", config.AdminToken, "token that admin connections authenticate with")
+	flag.StringVar(&config.LogLevel, "log_level", config.LogLevel, "least severe level that is logged: debug, info, warn or error")
+	flag.StringVar(&config.LogFormat, "log_format", config.LogFormat, "format of the log records: logfmt or json")
+	flag.StringVar(&config.LogFile, "log_file", config.LogFile, "path to the log file, standard error if empty")
+	flag.DurationVar(&config.TicketTTL, "ticket_ttl", config.TicketTTL, "how long a download ticket is valid")
+	flag.StringVar(&config.TicketKeyFile, "ticket_key_file", config.TicketKeyFile, "path to the file with the key that download tickets are signed with, created if missing")
+	flag.Float64Var(&config.CommandRate, "command_rate", config.CommandRate, "how many commands per second a connection may send on average, 0 disables the limit")
+	flag.IntVar(&config.CommandBurst, "command_burst", config.CommandBurst, "how many commands a connection may send at once")
+	flag.IntVar(&config.MaxFilesPerUser, "max_files_per_user", config.MaxFilesPerUser, "how many files can be registered per username, 0 disables the limit")
+	flag.IntVar(&config.MaxLineLength, "max_line_length", config.MaxLineLength, "the most bytes a command may have, 0 disables the limit")
+	flag.IntVar(&config.MaxConnectionsPerIP, "max_connections_per_ip", config.MaxConnectionsPerIP, "how many connections an IP may have at once, 0 disables the limit")
+	flag.IntVar(&config.ViolationsBeforeBan, "violations_before_ban", config.ViolationsBeforeBan, "after how many violations of the limits an IP is banned for a while, 0 disables the bans")
+	flag.DurationVar(&config.TemporaryBanDuration, "temporary_ban_duration", config.TemporaryBanDuration, "how long an IP that violated the limits is banned")
+	flag.StringVar(&config.AnnounceAddress, "announce_address", config.AnnounceAddress, "the address of the BitTorrent HTTP tracker, empty disables it")
+	flag.DurationVar(&config.AnnounceInterval, "announce_interval", config.AnnounceInterval, "how often BitTorrent clients are asked to announce themselves")
+	flag.StringVar(&config.DiscoveryGroup, "discovery_group", config.DiscoveryGroup, "the UDP multicast group on which clients on the local network can find the server, empty disables it")
+	flag.StringVar(&config.FederationName, "federation_name", config.FederationName, "the name of the server in the federation, the host name if empty")
+	flag.StringVar(&config.FederationAddress, "federation_address", config.FederationAddress, "the address on which the indexes of the other federated servers are accepted")
+	federationPeers := flag.String("federation_peers", "", "comma separated federation addresses of the other servers")
+	flag.StringVar(&config.FederationToken, "federation_token", config.FederationToken, "the secret shared by all federated servers, empty disables the federation")
+	flag.DurationVar(&config.FederationInterval, "federation_interval", config.FederationInterval, "how often the index is pushed to the other servers")
+	flag.StringVar(&config.ClusterAddress, "cluster_address", config.ClusterAddress, "the address on which the servers of a primary/standby cluster elect the primary, as the other servers list it")
+	clusterPeers := flag.String("cluster_peers", "", "comma separated cluster addresses of the other servers")
+	flag.StringVar(&config.ClusterToken, "cluster_token", config.ClusterToken, "the secret shared by all servers of the cluster, empty disables the cluster")
+	flag.DurationVar(&config.ClusterTimeout, "cluster_timeout", config.ClusterTimeout, "how long a standby waits for the primary before it asks to be elected")
+	flag.StringVar(&config.RelayAddress, "relay_address", config.RelayAddress, "the address on which transfers between clients that cannot connect to each other are relayed, empty disables it")
+	flag.IntVar(&config.RelayRate, "relay_rate", config.RelayRate, "how many bytes per second a relayed transfer may send in each direction, 0 disables the limit")
+	flag.IntVar(&config.RelayMaxTransfers, "relay_max_transfers", config.RelayMaxTransfers, "how many transfers can be relayed at once, 0 disables the limit")
+	flag.StringVar(&config.MetricsAddress, "metrics_address", config.MetricsAddress, "address of the HTTP endpoint that exposes \"/metrics\"")
+
+	flag.Parse()
+
+	// the flags given on the command line take precedence over the config file
+	explicitFlags := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		explicitFlags[f.Name] = f.Value.String()
+	})
+
+	if *configPath != "" {
+		if err := config.LoadFrom(*configPath); err != nil {
+			log.Fatalln(err)
+		}
+		for name, value := range explicitFlags {
+			if err := flag.Set(name, value); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+
+	if *federationPeers != "" {
+		config.FederationPeers = strings.Split(*federationPeers, ",")
+	}
+	if *clusterPeers != "" {
+		config.ClusterPeers = strings.Split(*clusterPeers, ",")
+	}
+
+	ts, err := server.CreateNewServerWithConfig(*port, config, *configPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
 	if err := ts.Start(); err != nil {
 		log.Fatalln(err)
@@ -0,0 +1,308 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	value uint64
+}
+
+// Inc is a function that increases the Counter by one
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add is a function that increases the Counter by "delta"
+func (c *Counter) Add(delta uint64) {
+	atomic.AddUint64(&c.value, delta)
+}
+
+// Value is a function that returns the current value of the Counter
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	value int64
+}
+
+// Inc is a function that increases the Gauge by one
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.value, 1)
+}
+
+// Dec is a function that decreases the Gauge by one
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.value, -1)
+}
+
+// Set is a function that sets the Gauge to "value"
+func (g *Gauge) Set(value int64) {
+	atomic.StoreInt64(&g.value, value)
+}
+
+// Value is a function that returns the current value of the Gauge
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+// CounterVec is a set of Counters that are told apart by the value of a single label
+type CounterVec struct {
+	label    string
+	counters map[string]*Counter
+	mutex    sync.RWMutex
+}
+
+// WithLabel is a function that returns the Counter for "value" of the label, creating it if needed
+func (v *CounterVec) WithLabel(value string) *Counter {
+	v.mutex.RLock()
+	counter, ok := v.counters[value]
+	v.mutex.RUnlock()
+	if ok {
+		return counter
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if counter, ok = v.counters[value]; !ok {
+		counter = &Counter{}
+		v.counters[value] = counter
+	}
+	return counter
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+	mutex   sync.Mutex
+}
+
+// Observe is a function that records a single observation in the Histogram
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// HistogramVec is a set of Histograms that are told apart by the value of a single label
+type HistogramVec struct {
+	label      string
+	buckets    []float64
+	histograms map[string]*Histogram
+	mutex      sync.RWMutex
+}
+
+// WithLabel is a function that returns the Histogram for "value" of the label, creating it if needed
+func (v *HistogramVec) WithLabel(value string) *Histogram {
+	v.mutex.RLock()
+	histogram, ok := v.histograms[value]
+	v.mutex.RUnlock()
+	if ok {
+		return histogram
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if histogram, ok = v.histograms[value]; !ok {
+		histogram = createHistogram(v.buckets)
+		v.histograms[value] = histogram
+	}
+	return histogram
+}
+
+// DefaultLatencyBuckets are the upper bounds(in seconds) of the buckets used for latencies
+var DefaultLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+func createHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+type metric struct {
+	name       string
+	help       string
+	metricType string
+	write      func(w io.Writer, name string)
+}
+
+// Registry is a struct that contains:
+//    - metrics - the registered metrics in the order of their registration
+//    - mutex   - a Mutex that is used for working safely with "metrics"
+type Registry struct {
+	metrics []metric
+	mutex   sync.Mutex
+}
+
+// CreateRegistry is a factory method that:
+//    - creates and returns a pointer to an empty Registry struct
+func CreateRegistry() *Registry {
+	return &Registry{
+		metrics: make([]metric, 0),
+	}
+}
+
+func (r *Registry) register(name, help, metricType string, write func(w io.Writer, name string)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.metrics = append(r.metrics, metric{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		write:      write,
+	})
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// NewCounter is a function that registers and returns a new Counter
+func (r *Registry) NewCounter(name, help string) *Counter {
+	counter := &Counter{}
+	r.register(name, help, "counter", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, counter.Value())
+	})
+	return counter
+}
+
+// NewGauge is a function that registers and returns a new Gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	gauge := &Gauge{}
+	r.register(name, help, "gauge", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, gauge.Value())
+	})
+	return gauge
+}
+
+// NewGaugeFunc is a function that registers a gauge whose value is computed by "value" on every scrape
+func (r *Registry) NewGaugeFunc(name, help string, value func() float64) {
+	r.register(name, help, "gauge", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(value()))
+	})
+}
+
+// NewCounterVec is a function that registers and returns a new CounterVec with a single label
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	vec := &CounterVec{
+		label:    label,
+		counters: make(map[string]*Counter),
+	}
+	r.register(name, help, "counter", func(w io.Writer, name string) {
+		vec.mutex.RLock()
+		defer vec.mutex.RUnlock()
+
+		for _, value := range sortedLabelValues(vec.counters) {
+			fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, vec.label, escapeLabelValue(value), vec.counters[value].Value())
+		}
+	})
+	return vec
+}
+
+// NewHistogramVec is a function that registers and returns a new HistogramVec with a single label
+func (r *Registry) NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	vec := &HistogramVec{
+		label:      label,
+		buckets:    buckets,
+		histograms: make(map[string]*Histogram),
+	}
+	r.register(name, help, "histogram", func(w io.Writer, name string) {
+		vec.mutex.RLock()
+		defer vec.mutex.RUnlock()
+
+		values := make([]string, 0, len(vec.histograms))
+		for value := range vec.histograms {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+
+		for _, value := range values {
+			histogram := vec.histograms[value]
+			labelPair := fmt.Sprintf("%s=\"%s\"", vec.label, escapeLabelValue(value))
+
+			histogram.mutex.Lock()
+			for i, bound := range histogram.buckets {
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labelPair, formatFloat(bound), histogram.counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labelPair, histogram.count)
+			fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labelPair, formatFloat(histogram.sum))
+			fmt.Fprintf(w, "%s_count{%s} %d\n", name, labelPair, histogram.count)
+			histogram.mutex.Unlock()
+		}
+	})
+	return vec
+}
+
+func sortedLabelValues(counters map[string]*Counter) []string {
+	values := make([]string, 0, len(counters))
+	for value := range counters {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// WriteText is a function that writes all registered metrics to "w" in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, m := range r.metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.metricType)
+		m.write(w, m.name)
+	}
+}
+
+// ServeHTTP is a function that answers every request with the metrics in the Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.WriteText(w)
+}
+
+// Serve is a function that:
+//    - starts an HTTP server on "address" that exposes the metrics of the Registry on "/metrics"
+//    (***) Returns error if the HTTP server cannot be started
+func (r *Registry) Serve(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+
+	if err := http.ListenAndServe(address, mux); err != nil {
+		return fmt.Errorf("Error starting metrics endpoint on %s. %w", address, err)
+	}
+	return nil
+}
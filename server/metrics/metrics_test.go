@@ -0,0 +1,60 @@
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/imaikeru/peer-to-peer/server/metrics"
+)
+
+func TestWriteTextFormat(t *testing.T) {
+	registry := metrics.CreateRegistry()
+
+	counter := registry.NewCounter("requests_total", "Number of requests.")
+	counter.Add(3)
+	counter.Inc()
+
+	gauge := registry.NewGauge("active", "Active things.")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+
+	registry.NewGaugeFunc("computed", "Computed value.", func() float64 { return 1.5 })
+
+	commands := registry.NewCounterVec("commands_total", "Commands.", "command")
+	commands.WithLabel("list-files").Inc()
+	commands.WithLabel("register").Add(2)
+
+	latency := registry.NewHistogramVec("latency_seconds", "Latency.", "command", []float64{0.1, 1})
+	latency.WithLabel("register").Observe(0.05)
+	latency.WithLabel("register").Observe(0.5)
+
+	var out bytes.Buffer
+	registry.WriteText(&out)
+
+	expected := `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total 4
+# HELP active Active things.
+# TYPE active gauge
+active 1
+# HELP computed Computed value.
+# TYPE computed gauge
+computed 1.5
+# HELP commands_total Commands.
+# TYPE commands_total counter
+commands_total{command="list-files"} 1
+commands_total{command="register"} 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{command="register",le="0.1"} 1
+latency_seconds_bucket{command="register",le="1"} 2
+latency_seconds_bucket{command="register",le="+Inf"} 2
+latency_seconds_sum{command="register"} 0.55
+latency_seconds_count{command="register"} 2
+`
+
+	if out.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	publicScope      = "public"
+	groupScopePrefix = "group:"
+	usersScopePrefix = "users:"
+	usersSeparator   = ","
+
+	groupIndex       = 1
+	groupMemberIndex = 2
+)
+
+// scope is a struct that contains:
+//     - group - the name of the group whose members can see the file, empty if the file is not shared with a group
+//     - users - a set of usernames that can see the file, nil if the file is not shared with specific users
+// A scope without group and users is public.
+type scope struct {
+	group string
+	users map[string]struct{}
+}
+
+// fileInfo is a struct that contains:
+//     - scope     - who can see and download the file
+//     - contentID - the hex encoded SHA-256 hash of the content of the file, empty until the client reports it
+//     - size      - the size of the file in bytes
+//     - infoHash  - the hex encoded BitTorrent info hash of the file, empty until the client reports it
+type fileInfo struct {
+	scope     *scope
+	contentID string
+	size      int64
+	infoHash  string
+}
+
+// group is a struct that contains:
+//     - owner   - the username of the user who created the group and manages its members
+//     - members - a set of usernames that belong to the group, including the owner
+type group struct {
+	owner   string
+	members map[string]struct{}
+}
+
+func createPublicScope() *scope {
+	return &scope{}
+}
+
+// parseScope is a function that:
+//    - accepts:
+//         - text - "public", "group:name" or "users:first,second"
+//    - returns the corresponding scope
+//    (***) Returns error if "text" is not a valid scope
+func parseScope(text string) (*scope, error) {
+	switch {
+	case text == publicScope:
+		return createPublicScope(), nil
+	case strings.HasPrefix(text, groupScopePrefix):
+		name := strings.TrimPrefix(text, groupScopePrefix)
+		if !deviceRegex.MatchString(name) {
+			return nil, fmt.Errorf("%q is not a valid group name", name)
+		}
+		return &scope{group: name}, nil
+	case strings.HasPrefix(text, usersScopePrefix):
+		users := make(map[string]struct{})
+		for _, user := range strings.Split(strings.TrimPrefix(text, usersScopePrefix), usersSeparator) {
+			if !usernameRegex.MatchString(user) {
+				return nil, fmt.Errorf("%q is not a valid username", user)
+			}
+			users[user] = struct{}{}
+		}
+		return &scope{users: users}, nil
+	}
+	return nil, fmt.Errorf("%q is not a valid scope, use public, group:name or users:first,second", text)
+}
+
+func (s *scope) isPublic() bool {
+	return s == nil || (s.group == "" && s.users == nil)
+}
+
+func (s *scope) String() string {
+	switch {
+	case s.isPublic():
+		return publicScope
+	case s.group != "":
+		return groupScopePrefix + s.group
+	}
+	return usersScopePrefix + strings.Join(sortedKeys(s.users), usersSeparator)
+}
+
+// requester is the one who wants to see or download a file
+type requester struct {
+	usernames map[string]struct{}
+	groups    map[string]struct{}
+}
+
+func (r *requester) isOneOf(usernames map[string]struct{}) bool {
+	for username := range r.usernames {
+		if _, ok := usernames[username]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// canSee is a function that returns whether "r" can see and download a file of "ownerIdentity" with scope "s"
+func (r *requester) canSee(ownerIdentity string, s *scope) bool {
+	if s.isPublic() {
+		return true
+	}
+
+	owner, _ := splitIdentity(ownerIdentity)
+	if _, isOwner := r.usernames[owner]; isOwner {
+		return true
+	}
+
+	if s.group != "" {
+		_, isMember := r.groups[s.group]
+		return isMember
+	}
+	return r.isOneOf(s.users)
+}
+
+// requesterFor is a function that returns who the client with "clientAddress" is, based on its usernames and groups
+func (t *TorrentServer) requesterFor(clientAddress string) *requester {
+	r := &requester{
+		usernames: make(map[string]struct{}),
+		groups:    make(map[string]struct{}),
+	}
+
+	t.clientsMutex.RLock()
+	if client, ok := t.clients[clientAddress]; ok {
+		for _, name := range client.names() {
+			username, _ := splitIdentity(name)
+			r.usernames[username] = struct{}{}
+		}
+	}
+	t.clientsMutex.RUnlock()
+
+	t.groupsMutex.RLock()
+	defer t.groupsMutex.RUnlock()
+
+	for name, g := range t.groups {
+		if r.isOneOf(g.members) {
+			r.groups[name] = struct{}{}
+		}
+	}
+
+	return r
+}
+
+// splitScope is a function that returns the scope and the files of a "register" command,
+// whose scope is optional and public by default
+func splitScope(parsedCommand []string) (*scope, []string) {
+	files := parsedCommand[filesStartIndex:]
+	if len(files) > 0 && !strings.HasPrefix(files[0], `"`) {
+		if s, err := parseScope(files[0]); err == nil {
+			return s, files[1:]
+		}
+	}
+	return createPublicScope(), files
+}
+
+func (t *TorrentServer) primaryUsernameOf(clientAddress string) string {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	if client, ok := t.clients[clientAddress]; ok {
+		username, _ := splitIdentity(client.username)
+		return username
+	}
+	return ""
+}
+
+// isPrimaryUsernameUsed is a function that returns whether any device or alias is registered under "username".
+// The caller has to hold "usedUsernamesMutex".
+func (t *TorrentServer) isPrimaryUsernameUsed(username string) bool {
+	for identity := range t.usedUsernames {
+		if primary, _ := splitIdentity(identity); primary == username {
+			return true
+		}
+	}
+	return false
+}
+
+// renameInSharing is a function that makes the groups and the "users:" scopes that name "oldUsername" name "newUsername" instead,
+// so that whoever registers as "oldUsername" later cannot see what was shared with the renamed user.
+// The caller has to hold "filesMutex".
+func (t *TorrentServer) renameInSharing(oldUsername, newUsername string) {
+	for _, filePaths := range t.files {
+		for _, info := range filePaths {
+			if info.scope == nil {
+				continue
+			}
+			if _, ok := info.scope.users[oldUsername]; ok {
+				delete(info.scope.users, oldUsername)
+				info.scope.users[newUsername] = struct{}{}
+			}
+		}
+	}
+
+	t.groupsMutex.Lock()
+	defer t.groupsMutex.Unlock()
+
+	for _, g := range t.groups {
+		if g.owner == oldUsername {
+			g.owner = newUsername
+		}
+		if _, ok := g.members[oldUsername]; ok {
+			delete(g.members, oldUsername)
+			g.members[newUsername] = struct{}{}
+		}
+	}
+}
+
+func (t *TorrentServer) addGroupMember(clientAddress, groupName, member string) string {
+	username := t.primaryUsernameOf(clientAddress)
+	if username == "" {
+		return "You have not registered yet, register files first."
+	}
+
+	t.groupsMutex.RLock()
+	g, ok := t.groups[groupName]
+	t.groupsMutex.RUnlock()
+
+	if ok && g.owner != username {
+		return fmt.Sprintf("Only %s can manage the members of group %s.", g.owner, groupName)
+	}
+
+	if err := t.commit(groupAddChange, username, groupName, member); err != nil {
+		return fmt.Sprintf("Could not add %s to group %s. %v", member, groupName, err)
+	}
+	return fmt.Sprintf("Successfully added %s to group %s.", member, groupName)
+}
+
+func (t *TorrentServer) removeGroupMember(clientAddress, groupName, member string) string {
+	username := t.primaryUsernameOf(clientAddress)
+
+	t.groupsMutex.RLock()
+	g, ok := t.groups[groupName]
+	t.groupsMutex.RUnlock()
+
+	if !ok {
+		return fmt.Sprintf("There is no group %s.", groupName)
+	}
+	if g.owner != username {
+		return fmt.Sprintf("Only %s can manage the members of group %s.", g.owner, groupName)
+	}
+
+	if err := t.commit(groupRemoveChange, username, groupName, member); err != nil {
+		return fmt.Sprintf("Could not remove %s from group %s. %v", member, groupName, err)
+	}
+	if member == g.owner {
+		return fmt.Sprintf("Successfully deleted group %s.", groupName)
+	}
+	return fmt.Sprintf("Successfully removed %s from group %s.", member, groupName)
+}
+
+func (t *TorrentServer) listGroups(clientAddress string) string {
+	r := t.requesterFor(clientAddress)
+
+	t.groupsMutex.RLock()
+	defer t.groupsMutex.RUnlock()
+
+	names := make([]string, 0, len(r.groups))
+	for name := range r.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("list-groups:")
+	for _, name := range names {
+		g := t.groups[name]
+		sb.WriteString(name + " (owner " + g.owner + ") : " + strings.Join(sortedKeys(g.members), usersSeparator) + ";")
+	}
+
+	return sb.String()
+}
+
+func (t *TorrentServer) handleGroupAddCommand(client *Client, clientAddress, groupName, member string) {
+	client.send(t.addGroupMember(clientAddress, groupName, member))
+}
+
+func (t *TorrentServer) handleGroupRemoveCommand(client *Client, clientAddress, groupName, member string) {
+	client.send(t.removeGroupMember(clientAddress, groupName, member))
+}
+
+func (t *TorrentServer) handleListGroupsCommand(client *Client, clientAddress string) {
+	client.send(t.listGroups(clientAddress))
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/ticket"
+)
+
+// connectTestSharing is a function that connects alice, who shares "/public" with everybody, "/team" with the group team of bob
+// and "/carol" with carol, bob and carol, who share a file each, and dave, who has not registered, and returns their clients and connections by name
+func connectTestSharing(t *testing.T, server *TorrentServer) (map[string]*Client, map[string]*recordingConn) {
+	t.Helper()
+
+	clients := make(map[string]*Client)
+	conns := make(map[string]*recordingConn)
+	for i, name := range []string{"alice", "bob", "carol", "dave"} {
+		address := fmt.Sprintf("127.0.0.1:%d", 4000+i)
+		clients[name], conns[name] = connectTestClient(t, server, address)
+		dispatchAll(server, clients[name], address, fmt.Sprintf("register-miniserver 127.0.0.1:%d", 9000+i))
+	}
+	dispatchAll(server, clients["alice"], "127.0.0.1:4000",
+		`register alice public "/public"`, `register alice group:team "/team"`, `register alice users:carol "/carol"`, "group-add team bob")
+	dispatchAll(server, clients["bob"], "127.0.0.1:4001", `register bob "/bob"`)
+	dispatchAll(server, clients["carol"], "127.0.0.1:4002", `register carol "/notes"`)
+
+	return clients, conns
+}
+
+func TestListFilesShowsOnlyTheFilesSharedWithTheRequester(t *testing.T) {
+	var tests = []struct {
+		requester string
+		address   string
+		expected  []string
+	}{
+		{"alice", "127.0.0.1:4000", []string{"alice (unknown) : /carol", "alice (unknown) : /public", "alice (unknown) : /team", "bob (unknown) : /bob", "carol (unknown) : /notes"}},
+		{"bob", "127.0.0.1:4001", []string{"alice (unknown) : /public", "alice (unknown) : /team", "bob (unknown) : /bob", "carol (unknown) : /notes"}},
+		{"carol", "127.0.0.1:4002", []string{"alice (unknown) : /carol", "alice (unknown) : /public", "bob (unknown) : /bob", "carol (unknown) : /notes"}},
+		{"dave", "127.0.0.1:4003", []string{"alice (unknown) : /public", "bob (unknown) : /bob", "carol (unknown) : /notes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.requester, func(t *testing.T) {
+			server := createTestServer(t)
+			clients, conns := connectTestSharing(t, server)
+
+			server.dispatch(clients[tt.requester], tt.address, splitCommand("list-files"))
+
+			replies := conns[tt.requester].replies()
+			if files := listedFiles(replies[len(replies)-1]); !reflect.DeepEqual(files, tt.expected) {
+				t.Errorf("got %q, want %q", files, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLocateIssuesTicketsOnlyForSharedFiles(t *testing.T) {
+	var tests = []struct {
+		requester string
+		address   string
+		file      string
+		located   bool
+	}{
+		{"bob", "127.0.0.1:4001", "/team", true},
+		{"dave", "127.0.0.1:4003", "/team", false},
+		{"carol", "127.0.0.1:4002", "/carol", true},
+		{"bob", "127.0.0.1:4001", "/carol", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.requester+tt.file, func(t *testing.T) {
+			server := createTestServer(t)
+			clients, conns := connectTestSharing(t, server)
+
+			server.dispatch(clients[tt.requester], tt.address, splitCommand(`locate alice "`+tt.file+`"`))
+
+			replies := conns[tt.requester].replies()
+			reply := strings.Fields(replies[len(replies)-1])
+			if !tt.located {
+				if reply[0] != "not-located" {
+					t.Errorf("expected the file to be hidden, got %q", reply)
+				}
+				return
+			}
+
+			if len(reply) != 5 || reply[0] != "located" || reply[2] != "127.0.0.1:9000" {
+				t.Fatalf("expected the file to be located on the mini server of alice, got %q", reply)
+			}
+			verified, err := ticket.Verify(server.ticketKey.Public().(ed25519.PublicKey), reply[3], time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := (ticket.Ticket{Requester: tt.requester, Owner: "alice", Holder: "127.0.0.1:9000", File: tt.file, Expires: verified.Expires}); verified != expected {
+				t.Errorf("got ticket %+v, want %+v", verified, expected)
+			}
+		})
+	}
+}
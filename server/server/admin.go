@@ -0,0 +1,417 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+const (
+	unixSocketPrefix = "unix:"
+
+	adminAuthCommand   = "auth"
+	adminResponseEnd   = "end"
+	adminArgumentIndex = 1
+	adminTokenIndex    = 1
+	adminCommandsList  = "Unknown command, choose between:\n" +
+		"stats\n" +
+		"list-connections\n" +
+		"kick user\n" +
+		"ban user|ip\n" +
+		"unregister-all user\n" +
+		"reload-config\n" +
+		"dump-state"
+)
+
+// connectionState is the state of a single client connection as shown by "dump-state"
+type connectionState struct {
+	Username          string    `json:"username"`
+	Aliases           []string  `json:"aliases"`
+	Device            string    `json:"device"`
+	MiniServerAddress string    `json:"mini_server_address"`
+	Reachability      string    `json:"reachability"`
+	LeaseExpiry       time.Time `json:"lease_expiry"`
+}
+
+// serverState is the state of the whole server as shown by "dump-state"
+type serverState struct {
+	Connections     map[string]connectionState `json:"connections"`
+	UsedUsernames   map[string]string          `json:"used_usernames"`
+	Files           map[string][]string        `json:"files"`
+	BannedUsernames []string                   `json:"banned_usernames"`
+	BannedIPs       []string                   `json:"banned_ips"`
+	TemporaryBans   map[string]time.Time       `json:"temporary_bans"`
+}
+
+func hostOf(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (t *TorrentServer) isUsernameBanned(username string) bool {
+	t.bansMutex.RLock()
+	defer t.bansMutex.RUnlock()
+
+	_, banned := t.bannedUsernames[username]
+	return banned
+}
+
+func (t *TorrentServer) isAddressBanned(address string) bool {
+	t.bansMutex.RLock()
+	defer t.bansMutex.RUnlock()
+
+	host := hostOf(address)
+	if _, banned := t.bannedIPs[host]; banned {
+		return true
+	}
+
+	until, temporarilyBanned := t.temporarilyBannedIPs[host]
+	return temporarilyBanned && time.Now().Before(until)
+}
+
+func (t *TorrentServer) findClientAddressesWhere(matches func(address string, client *Client) bool) []string {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	addresses := make([]string, 0)
+	for address, client := range t.clients {
+		if matches(address, client) {
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
+
+func (t *TorrentServer) closeConnectionOf(clientAddress string) {
+	t.clientsMutex.RLock()
+	client, ok := t.clients[clientAddress]
+	t.clientsMutex.RUnlock()
+
+	t.disconnect(clientAddress)
+	if ok && client.conn != nil {
+		client.conn.Close()
+	}
+}
+
+func (t *TorrentServer) kick(username string) int {
+	addresses := t.findClientAddressesWhere(func(_ string, client *Client) bool {
+		return client.belongsTo(username)
+	})
+
+	for _, address := range addresses {
+		t.closeConnectionOf(address)
+	}
+
+	return len(addresses)
+}
+
+func (t *TorrentServer) ban(userOrIP string) string {
+	if err := t.commit(banChange, userOrIP); err != nil {
+		return fmt.Sprintf("Could not ban %s. %v", userOrIP, err)
+	}
+
+	addresses := t.findClientAddressesWhere(func(address string, client *Client) bool {
+		return client.belongsTo(userOrIP) || hostOf(address) == userOrIP
+	})
+
+	for _, address := range addresses {
+		t.closeConnectionOf(address)
+	}
+
+	return fmt.Sprintf("Banned %s and kicked %d connections.", userOrIP, len(addresses))
+}
+
+// restartSettings lists the settings, by their names in the config file, which are used only when the server starts
+var restartSettings = []struct {
+	name  string
+	field func(config *Config) *string
+}{
+	{"admin_address", func(config *Config) *string { return &config.AdminAddress }},
+	{"metrics_address", func(config *Config) *string { return &config.MetricsAddress }},
+	{"log_format", func(config *Config) *string { return &config.LogFormat }},
+	{"log_file", func(config *Config) *string { return &config.LogFile }},
+	{"ticket_key_file", func(config *Config) *string { return &config.TicketKeyFile }},
+	{"announce_address", func(config *Config) *string { return &config.AnnounceAddress }},
+	{"discovery_group", func(config *Config) *string { return &config.DiscoveryGroup }},
+	{"federation_name", func(config *Config) *string { return &config.FederationName }},
+	{"federation_address", func(config *Config) *string { return &config.FederationAddress }},
+	{"federation_token", func(config *Config) *string { return &config.FederationToken }},
+	{"cluster_address", func(config *Config) *string { return &config.ClusterAddress }},
+	{"cluster_token", func(config *Config) *string { return &config.ClusterToken }},
+	{"relay_address", func(config *Config) *string { return &config.RelayAddress }},
+}
+
+// reloadConfig is a function that applies the config file of the server and returns the answer for the admin.
+// The settings in "restartSettings" keep their running values and the answer names the changed ones.
+func (t *TorrentServer) reloadConfig() string {
+	if t.configPath == "" {
+		return "There is no config file to reload."
+	}
+
+	t.configMutex.Lock()
+	defer t.configMutex.Unlock()
+
+	// the file is parsed and validated apart, so that an invalid file leaves the running config as it is
+	loaded := *t.config
+	if err := loaded.LoadFrom(t.configPath); err != nil {
+		return err.Error()
+	}
+	level, err := logging.ParseLevel(loaded.LogLevel)
+	if err != nil {
+		return err.Error()
+	}
+	if _, err := logging.ParseFormat(loaded.LogFormat); err != nil {
+		return err.Error()
+	}
+
+	var requireRestart []string
+	for _, setting := range restartSettings {
+		if running := *setting.field(t.config); *setting.field(&loaded) != running {
+			requireRestart = append(requireRestart, setting.name)
+			*setting.field(&loaded) = running
+		}
+	}
+
+	*t.config = loaded
+	t.logger.SetLevel(level)
+
+	if len(requireRestart) > 0 {
+		return fmt.Sprintf("Reloaded config from %s. Changes to %s require a restart.", t.configPath, strings.Join(requireRestart, ", "))
+	}
+	return fmt.Sprintf("Reloaded config from %s.", t.configPath)
+}
+
+func (t *TorrentServer) stats() string {
+	t.clientsMutex.RLock()
+	connections := len(t.clients)
+	t.clientsMutex.RUnlock()
+
+	t.usedUsernamesMutex.RLock()
+	users := len(t.usedUsernames)
+	t.usedUsernamesMutex.RUnlock()
+
+	t.filesMutex.RLock()
+	files := 0
+	for _, filePaths := range t.files {
+		files += len(filePaths)
+	}
+	t.filesMutex.RUnlock()
+
+	temporaryBans := len(t.activeTemporaryBans())
+
+	t.bansMutex.RLock()
+	bans := len(t.bannedUsernames) + len(t.bannedIPs)
+	t.bansMutex.RUnlock()
+
+	stats := fmt.Sprintf("uptime: %s\nconnections: %d\nusers: %d\nfiles: %d\nbans: %d\ntemporary bans: %d",
+		time.Since(t.startTime).Round(time.Second), connections, users, files, bans, temporaryBans)
+	if t.cluster != nil {
+		stats += fmt.Sprintf("\ncluster role: %s\ncluster term: %d\nprimary: %s", t.cluster.Role(), t.cluster.Term(), t.cluster.Primary())
+	}
+	return stats
+}
+
+func (t *TorrentServer) listConnections() string {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	lines := make([]string, 0, len(t.clients))
+	for address, client := range t.clients {
+		lines = append(lines, fmt.Sprintf("%s - user: %q, mini server: %q, %s, lease expires in %s",
+			address, client.username, client.miniServerAddress, client.reachability,
+			time.Until(client.leaseExpiry).Round(time.Second)))
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n")
+}
+
+func (t *TorrentServer) dumpState() string {
+	state := serverState{
+		Connections:   make(map[string]connectionState),
+		UsedUsernames: make(map[string]string),
+		Files:         make(map[string][]string),
+	}
+
+	t.usedUsernamesMutex.RLock()
+	for username, address := range t.usedUsernames {
+		state.UsedUsernames[username] = *address
+	}
+	t.usedUsernamesMutex.RUnlock()
+
+	t.clientsMutex.RLock()
+	for address, client := range t.clients {
+		state.Connections[address] = connectionState{
+			Username:          client.username,
+			Aliases:           sortedKeys(client.aliases),
+			Device:            client.device,
+			MiniServerAddress: client.miniServerAddress,
+			Reachability:      client.reachability,
+			LeaseExpiry:       client.leaseExpiry,
+		}
+	}
+	t.clientsMutex.RUnlock()
+
+	t.filesMutex.RLock()
+	for username, filePaths := range t.files {
+		for filePath, info := range filePaths {
+			state.Files[username] = append(state.Files[username], filePath+" ("+info.scope.String()+")")
+		}
+		sort.Strings(state.Files[username])
+	}
+	t.filesMutex.RUnlock()
+
+	t.bansMutex.RLock()
+	state.BannedUsernames = sortedKeys(t.bannedUsernames)
+	state.BannedIPs = sortedKeys(t.bannedIPs)
+	t.bansMutex.RUnlock()
+	state.TemporaryBans = t.activeTemporaryBans()
+
+	dump, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(dump)
+}
+
+func (t *TorrentServer) executeAdminCommand(parsedCommand []string) string {
+	if len(parsedCommand) == 0 {
+		return adminCommandsList
+	}
+
+	withArgument := func(action func(argument string) string) string {
+		if len(parsedCommand) != 2 {
+			return fmt.Sprintf("%s expects exactly one argument.", parsedCommand[commandIndex])
+		}
+		return action(parsedCommand[adminArgumentIndex])
+	}
+
+	switch parsedCommand[commandIndex] {
+	case "stats":
+		return t.stats()
+	case "list-connections":
+		return t.listConnections()
+	case "kick":
+		return withArgument(func(username string) string {
+			return fmt.Sprintf("Kicked %d connections of %s.", t.kick(username), username)
+		})
+	case "ban":
+		return withArgument(t.ban)
+	case "unregister-all":
+		return withArgument(func(username string) string {
+			if err := t.commit(unregisterChange, username); err != nil {
+				return fmt.Sprintf("Could not unregister the files of %s. %v", username, err)
+			}
+			return fmt.Sprintf("Unregistered all files of %s.", username)
+		})
+	case "reload-config":
+		return t.reloadConfig()
+	case "dump-state":
+		return t.dumpState()
+	}
+
+	return adminCommandsList
+}
+
+func (t *TorrentServer) authenticateAdmin(reader *bufio.Reader) bool {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	parsedLine := strings.Fields(line)
+	if len(parsedLine) != 2 || parsedLine[commandIndex] != adminAuthCommand {
+		return false
+	}
+
+	expectedToken := t.getConfig().AdminToken
+	return subtle.ConstantTimeCompare([]byte(parsedLine[adminTokenIndex]), []byte(expectedToken)) == 1
+}
+
+func (t *TorrentServer) handleAdminConnection(conn net.Conn) {
+	defer conn.Close()
+
+	logger := t.logger.With("component", "admin", "admin", conn.RemoteAddr().String())
+	logger.Info("Accepted admin connection")
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	defer writer.Flush()
+
+	if !t.authenticateAdmin(reader) {
+		logger.Warn("Admin authentication failed")
+		writer.WriteString("Authentication failed." + "\n")
+		return
+	}
+	writer.WriteString("Authenticated." + "\n")
+	writer.Flush()
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		parsedCommand := strings.Fields(line)
+		if len(parsedCommand) == 1 && parsedCommand[commandIndex] == "disconnect" {
+			return
+		}
+
+		logger.Info("Admin command", "command", strings.TrimSpace(line))
+		writer.WriteString(t.executeAdminCommand(parsedCommand) + "\n" + adminResponseEnd + "\n")
+		writer.Flush()
+	}
+}
+
+func listenAdmin(adminAddress string) (net.Listener, error) {
+	if strings.HasPrefix(adminAddress, unixSocketPrefix) {
+		return net.Listen("unix", strings.TrimPrefix(adminAddress, unixSocketPrefix))
+	}
+	return net.Listen(protocol, adminAddress)
+}
+
+// startAdmin is a function that:
+//    1. Creates a listener for the admin interface on "adminAddress"
+//    2. Accepts and handles admin connections
+//    (***) Returns error if there is no admin token configured or the listener cannot be initialized
+func (t *TorrentServer) startAdmin(adminAddress string) error {
+	if t.getConfig().AdminToken == "" {
+		return fmt.Errorf("Refusing to start admin interface on %s without an admin token", adminAddress)
+	}
+
+	listener, err := listenAdmin(adminAddress)
+	if err != nil {
+		return fmt.Errorf("Error starting admin interface on %s. %w", adminAddress, err)
+	}
+
+	defer listener.Close()
+
+	t.logger.Info("Admin interface started", "component", "admin", "address", adminAddress)
+	for {
+		if conn, err := listener.Accept(); err != nil {
+			t.logger.Error("Error accepting admin connection", "component", "admin", "error", err)
+		} else {
+			go t.handleAdminConnection(conn)
+		}
+	}
+}
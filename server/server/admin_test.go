@@ -0,0 +1,75 @@
+package server
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnregisterAllDeletesTheFilesOfEveryDevice(t *testing.T) {
+	server := createTestServer(t)
+	for _, identity := range []string{"bob", "bob@laptop", "bob@phone", "bobby", "alice@laptop"} {
+		if err := server.registerFiles(identity, nil, 0, `"/a"`); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if answer := server.executeAdminCommand([]string{"unregister-all", "bob"}); answer != "Unregistered all files of bob." {
+		t.Errorf("unexpected answer %q", answer)
+	}
+
+	for identity, expected := range map[string]bool{"bob": false, "bob@laptop": false, "bob@phone": false, "bobby": true, "alice@laptop": true} {
+		if _, registered := server.files[identity]; registered != expected {
+			t.Errorf("%s: got registered %t, want %t", identity, registered, expected)
+		}
+	}
+}
+
+func TestReloadConfigKeepsTheConfigIfTheFileIsInvalid(t *testing.T) {
+	var tests = []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"invalid log level", `{"lease_duration": "5m", "log_level": "loud"}`, "Unknown log level"},
+		{"invalid log format", `{"lease_duration": "5m", "log_format": "xml"}`, "Unknown log format"},
+		{"invalid duration", `{"lease_duration": "soon"}`, "Invalid lease_duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createTestServer(t)
+			server.configPath = filepath.Join(t.TempDir(), "config.json")
+			if err := ioutil.WriteFile(server.configPath, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if answer := server.reloadConfig(); !strings.HasPrefix(answer, tt.expected) {
+				t.Errorf("got %q, want an answer starting with %q", answer, tt.expected)
+			}
+			if config := server.getConfig(); config.LeaseDuration != defaultLeaseDuration || config.LogLevel != "error" || config.LogFormat != defaultLogFormat {
+				t.Errorf("expected the config to stay unchanged, got lease %s, level %s, format %s", config.LeaseDuration, config.LogLevel, config.LogFormat)
+			}
+		})
+	}
+}
+
+func TestReloadConfigNamesTheSettingsThatRequireARestart(t *testing.T) {
+	server := createTestServer(t)
+	server.configPath = filepath.Join(t.TempDir(), "config.json")
+	content := `{"lease_duration": "5m", "log_level": "info", "log_format": "json", "relay_address": "127.0.0.1:13342", "admin_address": ""}`
+	if err := ioutil.WriteFile(server.configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Reloaded config from " + server.configPath + ". Changes to log_format, relay_address require a restart."
+	if answer := server.reloadConfig(); answer != expected {
+		t.Errorf("got %q, want %q", answer, expected)
+	}
+	if config := server.getConfig(); config.LeaseDuration != 5*time.Minute || config.LogLevel != "info" || config.LogFormat != defaultLogFormat || config.RelayAddress != "" {
+		t.Errorf("expected only the settings used after the start to change, got lease %s, level %s, format %s, relay %q",
+			config.LeaseDuration, config.LogLevel, config.LogFormat, config.RelayAddress)
+	}
+}
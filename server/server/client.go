@@ -1,11 +1,39 @@
 package server
 
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+// how long writing a message to a client may take, so that writing to a half-open connection does not block forever
+const sendTimeout = 10 * time.Second
+
 // Client is a struct that contains:
-//     - username          - string
 //     - miniServerAddress - the address of the mini server, which is linked to the username
+//     - username          - string
+//     - conn              - the connection to the client
+//     - writer            - a buffered writer over "conn"
+//     - writerMutex       - a Mutex that is used for writing safely to "writer"
+//     - leaseExpiry       - the moment after which the client is considered dead unless it sends something
+//     - reachability      - whether the mini server answered the last health probe("reachable", "unreachable" or "unknown")
+//     - aliases           - a set of additional usernames the client can register files as
+//     - device            - the name of the device of the client, which tells apart connections of the same user
+//     - violations        - how many times the client has violated the limits of the server
+//     - connectedAt       - the moment the client connected, which decides username conflicts between federated servers
 type Client struct {
 	miniServerAddress string
 	username          string
+	conn              net.Conn
+	writer            *bufio.Writer
+	writerMutex       sync.Mutex
+	leaseExpiry       time.Time
+	reachability      string
+	aliases           map[string]struct{}
+	device            string
+	violations        int
+	connectedAt       time.Time
 }
 
 // CreateEmptyClient is a factory method that:
@@ -14,5 +42,32 @@ func CreateEmptyClient() *Client {
 	return &Client{
 		miniServerAddress: "",
 		username:          "",
+		reachability:      reachabilityUnknown,
+		aliases:           make(map[string]struct{}),
+	}
+}
+
+// CreateClientFor is a factory method that:
+//    - accepts:
+//         - conn - the connection to the client
+//    - creates and returns a pointer to a Client struct without username that writes to "conn"
+func CreateClientFor(conn net.Conn) *Client {
+	client := CreateEmptyClient()
+	client.conn = conn
+	client.writer = bufio.NewWriterSize(conn, 4096)
+	return client
+}
+
+// send is a function that writes "message" followed by a new line to the client and flushes it
+func (c *Client) send(message string) error {
+	c.writerMutex.Lock()
+	defer c.writerMutex.Unlock()
+
+	if c.conn != nil {
+		c.conn.SetWriteDeadline(time.Now().Add(sendTimeout))
+	}
+	if _, err := c.writer.WriteString(message + "\n"); err != nil {
+		return err
 	}
+	return c.writer.Flush()
 }
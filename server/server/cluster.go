@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/server/cluster"
+)
+
+const (
+	groupAddChange    = "group-add"
+	groupRemoveChange = "group-remove"
+	banChange         = "ban"
+	unregisterChange  = "unregister-all"
+
+	// standbyPrefix starts the answer of a standby to a client, which is followed by the address of the primary if it is known
+	standbyPrefix = errorPrefix + "standby, the primary is "
+)
+
+// commit is a function that changes the state that outlives the connections of clients(sharing groups and bans)
+// or that an administrator changes on their behalf(unregistering all files of a user).
+// In a cluster the change is applied only after it is replicated to a majority of the servers, otherwise it is applied right away.
+//    (***) Returns error if the server is not the primary or the change could not be replicated
+func (t *TorrentServer) commit(change ...string) error {
+	command := strings.Join(change, " ")
+	if t.cluster == nil {
+		t.applyChange(command)
+		return nil
+	}
+	return t.cluster.Propose(command)
+}
+
+// applyChange is a function that applies a change committed with "commit", on the primary and on every standby.
+// The checks of the primary are repeated, so that all servers end with the same state.
+func (t *TorrentServer) applyChange(command string) {
+	change := strings.Fields(command)
+	switch {
+	case len(change) == 4 && change[0] == groupAddChange:
+		owner, groupName, member := change[1], change[2], change[3]
+
+		t.groupsMutex.Lock()
+		defer t.groupsMutex.Unlock()
+
+		g, ok := t.groups[groupName]
+		if !ok {
+			g = &group{owner: owner, members: map[string]struct{}{owner: {}}}
+			t.groups[groupName] = g
+		}
+		if g.owner == owner {
+			g.members[member] = struct{}{}
+		}
+	case len(change) == 4 && change[0] == groupRemoveChange:
+		owner, groupName, member := change[1], change[2], change[3]
+
+		t.groupsMutex.Lock()
+		defer t.groupsMutex.Unlock()
+
+		if g, ok := t.groups[groupName]; !ok || g.owner != owner {
+			return
+		} else if member == owner {
+			delete(t.groups, groupName)
+		} else {
+			delete(g.members, member)
+		}
+	case len(change) == 2 && change[0] == banChange:
+		t.bansMutex.Lock()
+		defer t.bansMutex.Unlock()
+
+		if ip := net.ParseIP(change[1]); ip != nil {
+			t.bannedIPs[ip.String()] = struct{}{}
+		} else {
+			t.bannedUsernames[change[1]] = struct{}{}
+		}
+	case len(change) == 2 && change[0] == unregisterChange:
+		t.deleteAllFilesOf(change[1])
+	default:
+		t.logger.Error("Unknown replicated change", "component", "cluster", "change", command)
+	}
+}
+
+// isStandby is a function that returns whether the server is in a cluster and is not its primary
+func (t *TorrentServer) isStandby() bool {
+	return t.cluster != nil && t.cluster.Role() != cluster.Primary
+}
+
+// refuseAsStandby is a function that tells a client that connected to a standby where the primary is
+func (t *TorrentServer) refuseAsStandby(conn net.Conn) {
+	primary := t.cluster.Primary()
+	if primary == "" {
+		primary = "not elected yet"
+	}
+	conn.Write([]byte(standbyPrefix + primary + "\n"))
+	conn.Close()
+}
+
+// followClusterRole is a function that logs when the server becomes the primary or a standby.
+// A primary that becomes a standby disconnects its clients, so that they fail over to the new primary.
+func (t *TorrentServer) followClusterRole() {
+	role := cluster.Standby
+	for {
+		time.Sleep(t.getConfig().ClusterTimeout / 2)
+
+		current := t.cluster.Role()
+		if current != role && current != cluster.Candidate {
+			t.logger.Info(fmt.Sprintf("Became the %s", current), "component", "cluster", "term", t.cluster.Term(), "primary", t.cluster.Primary())
+			role = current
+		}
+
+		if current != cluster.Primary {
+			addresses := t.findClientAddressesWhere(func(string, *Client) bool { return true })
+			for _, address := range addresses {
+				t.closeConnectionOf(address)
+			}
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	errorPrefix = "ERR "
+
+	// the answer to commands of a client that was kicked, banned or whose lease expired while they were being read
+	notConnectedMessage = errorPrefix + "you are no longer connected"
+)
+
+// argumentType is the kind of value a command argument has to be
+type argumentType int
+
+const (
+	usernameArgument argumentType = iota
+	addressArgument
+	filePathArgument
+	deviceArgument
+	identityArgument
+	groupArgument
+	scopeArgument
+	contentIDArgument
+	sizeArgument
+	infoHashArgument
+	pushTokenArgument
+)
+
+var (
+	usernameRegex = regexp.MustCompile(`^[a-z]+$`)
+	deviceRegex   = regexp.MustCompile(`^[a-z0-9-]+$`)
+	identityRegex = regexp.MustCompile(`^[a-z]+(@[a-z0-9-]+)?$`)
+)
+
+var argumentTypeNames = map[argumentType]string{
+	usernameArgument:  "username",
+	addressArgument:   "address",
+	filePathArgument:  "\"file path\"",
+	deviceArgument:    "device",
+	identityArgument:  "username[@device]",
+	groupArgument:     "group",
+	scopeArgument:     "public|group:name|users:first,second",
+	contentIDArgument: "content-id",
+	sizeArgument:      "size",
+	infoHashArgument:  "info-hash",
+	pushTokenArgument: "token",
+}
+
+func (a argumentType) String() string {
+	return argumentTypeNames[a]
+}
+
+func (a argumentType) validate(argument string) error {
+	switch a {
+	case usernameArgument:
+		if !usernameRegex.MatchString(argument) {
+			return fmt.Errorf("%q is not a valid username, it must consist of lowercase latin letters", argument)
+		}
+	case addressArgument:
+		if _, port, err := net.SplitHostPort(argument); err != nil || port == "" {
+			return fmt.Errorf("%q is not a valid host:port address", argument)
+		}
+	case deviceArgument:
+		if !deviceRegex.MatchString(argument) {
+			return fmt.Errorf("%q is not a valid device name, it must consist of lowercase latin letters, digits and dashes", argument)
+		}
+	case identityArgument:
+		if !identityRegex.MatchString(argument) {
+			return fmt.Errorf("%q is not a valid username, optionally followed by @device", argument)
+		}
+	case groupArgument:
+		if !deviceRegex.MatchString(argument) {
+			return fmt.Errorf("%q is not a valid group name, it must consist of lowercase latin letters, digits and dashes", argument)
+		}
+	case scopeArgument:
+		if _, err := parseScope(argument); err != nil {
+			return err
+		}
+	case contentIDArgument:
+		if !contentIDRegex.MatchString(argument) {
+			return fmt.Errorf("%q is not a valid content ID, it must be a hex encoded SHA-256 hash", argument)
+		}
+	case infoHashArgument:
+		if !infoHashRegex.MatchString(argument) {
+			return fmt.Errorf("%q is not a valid info hash, it must be a hex encoded SHA-1 hash", argument)
+		}
+	case pushTokenArgument:
+		if !pushTokenRegex.MatchString(argument) {
+			return fmt.Errorf("%q is not a valid token, it must be 16 hex encoded bytes", argument)
+		}
+	case sizeArgument:
+		if size, err := strconv.ParseInt(argument, 10, 64); err != nil || size < 0 {
+			return fmt.Errorf("%q is not a valid size in bytes", argument)
+		}
+	case filePathArgument:
+		if len(argument) < 3 || !strings.HasPrefix(argument, `"`) || !strings.HasSuffix(argument, `"`) {
+			return fmt.Errorf("%s is not a file path in double quotes", argument)
+		}
+	}
+	return nil
+}
+
+// commandHandler handles an already validated command.
+// "parsedCommand" contains the name of the command followed by its arguments.
+// It returns true if the connection has to be closed afterwards.
+type commandHandler func(client *Client, clientAddress string, parsedCommand []string) bool
+
+// command is a struct that contains:
+//     - name      - the name of the command, which is its first word
+//     - arguments - the types of the arguments that always follow the name
+//     - optional  - the type of an argument that may follow "arguments" if it is valid, nil if there is none
+//     - variadic  - the type of the arguments that may follow "arguments" and "optional", nil if there are none
+//     - minExtra  - the least number of variadic arguments
+//     - handle    - the function that executes the command
+type command struct {
+	name      string
+	arguments []argumentType
+	optional  *argumentType
+	variadic  *argumentType
+	minExtra  int
+	handle    commandHandler
+}
+
+func (c *command) usage() string {
+	var sb strings.Builder
+
+	sb.WriteString(c.name)
+	for _, argument := range c.arguments {
+		sb.WriteString(" " + argument.String())
+	}
+	if c.optional != nil {
+		sb.WriteString(" [" + c.optional.String() + "]")
+	}
+	if c.variadic != nil {
+		for i := 0; i < c.minExtra; i++ {
+			sb.WriteString(" " + c.variadic.String())
+		}
+		sb.WriteString(" [" + c.variadic.String() + " ...]")
+	}
+
+	return sb.String()
+}
+
+func (c *command) validate(parsedCommand []string) error {
+	arguments := parsedCommand[commandIndex+1:]
+
+	if c.optional != nil && len(arguments) > len(c.arguments) && c.optional.validate(arguments[len(c.arguments)]) == nil {
+		arguments = append(append([]string{}, arguments[:len(c.arguments)]...), arguments[len(c.arguments)+1:]...)
+	}
+
+	if len(arguments) < len(c.arguments)+c.minExtra || (c.variadic == nil && len(arguments) > len(c.arguments)) {
+		return fmt.Errorf("bad arguments, usage: %s", c.usage())
+	}
+
+	for i, argument := range arguments {
+		argumentType := c.variadic
+		if i < len(c.arguments) {
+			argumentType = &c.arguments[i]
+		}
+		if err := argumentType.validate(argument); err != nil {
+			return fmt.Errorf("bad arguments, %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// splitCommand is a function that splits "line" into words separated by white space.
+// Text in double quotes is kept in a single word together with the quotes.
+func splitCommand(line string) []string {
+	words := make([]string, 0)
+
+	var word strings.Builder
+	inQuotes := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			word.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuotes:
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+		default:
+			word.WriteRune(r)
+		}
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+
+	return words
+}
+
+func (t *TorrentServer) registerCommand(c *command) {
+	t.commands[c.name] = c
+}
+
+func (t *TorrentServer) commandNames() []string {
+	names := make([]string, 0, len(t.commands))
+	for name := range t.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dispatch is a function that:
+//    - validates "parsedCommand" against the registered commands and executes it
+//    - returns:
+//         - the name of the command for the metrics, "unknown" if there is no such command
+//         - true if the connection has to be closed afterwards
+//    (***) Answers the client with an "ERR" response if the command is unknown or its arguments are invalid
+func (t *TorrentServer) dispatch(client *Client, clientAddress string, parsedCommand []string) (string, bool) {
+	if len(parsedCommand) == 0 {
+		t.metrics.errors.WithLabel("empty_command").Inc()
+		client.send(errorPrefix + "empty command")
+		return unknownCommand, false
+	}
+
+	c, ok := t.commands[parsedCommand[commandIndex]]
+	if !ok {
+		t.metrics.errors.WithLabel("unknown_command").Inc()
+		client.send(fmt.Sprintf("%sunknown command %q, choose between: %s", errorPrefix, parsedCommand[commandIndex], strings.Join(t.commandNames(), ", ")))
+		return unknownCommand, false
+	}
+
+	if err := c.validate(parsedCommand); err != nil {
+		t.metrics.errors.WithLabel("bad_arguments").Inc()
+		client.send(errorPrefix + err.Error())
+		return c.name, false
+	}
+
+	return c.name, c.handle(client, clientAddress, parsedCommand)
+}
+
+func (t *TorrentServer) registerCommands() {
+	filePath := filePathArgument
+	fileScope := scopeArgument
+	infoHash := infoHashArgument
+
+	t.registerCommand(&command{
+		name: "disconnect",
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.disconnect(clientAddress)
+			return true
+		},
+	})
+	t.registerCommand(&command{
+		name:      "register",
+		arguments: []argumentType{usernameArgument},
+		optional:  &fileScope,
+		variadic:  &filePath,
+		minExtra:  1,
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			registeredScope, files := splitScope(parsedCommand)
+			t.handleRegisterFilesCommand(client, clientAddress, parsedCommand[userIndex], registeredScope, files...)
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "unregister",
+		arguments: []argumentType{usernameArgument},
+		variadic:  &filePath,
+		minExtra:  1,
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleUnregisterFilesCommand(client, clientAddress, parsedCommand[userIndex], parsedCommand[filesStartIndex:]...)
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "rename",
+		arguments: []argumentType{usernameArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleRenameCommand(client, clientAddress, parsedCommand[userIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "alias",
+		arguments: []argumentType{usernameArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleAliasCommand(client, clientAddress, parsedCommand[userIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "unalias",
+		arguments: []argumentType{usernameArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleUnaliasCommand(client, clientAddress, parsedCommand[userIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "register-miniserver",
+		arguments: []argumentType{addressArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleRegisterMiniServerCommand(client, clientAddress, parsedCommand[miniServerAddressIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "register-device",
+		arguments: []argumentType{deviceArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleRegisterDeviceCommand(client, clientAddress, parsedCommand[deviceIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "locate",
+		arguments: []argumentType{identityArgument, filePathArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleLocateCommand(client, clientAddress, parsedCommand[userIndex], parsedCommand[locatedFileIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "register-content",
+		arguments: []argumentType{usernameArgument, filePathArgument, contentIDArgument, sizeArgument},
+		optional:  &infoHash,
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleRegisterContentCommand(client, clientAddress, parsedCommand)
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "locate-content",
+		arguments: []argumentType{contentIDArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleLocateContentCommand(client, clientAddress, parsedCommand[locatedContentIDIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "locate-torrent",
+		arguments: []argumentType{infoHashArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleLocateContentCommand(client, clientAddress, parsedCommand[locatedContentIDIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "relay",
+		arguments: []argumentType{addressArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleRelayCommand(client, clientAddress, parsedCommand[miniServerAddressIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "push",
+		arguments: []argumentType{addressArgument, pushTokenArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handlePushCommand(client, clientAddress, parsedCommand[miniServerAddressIndex], parsedCommand[pushTokenIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name: "list-files",
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleListFilesCommand(client, clientAddress)
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "search",
+		arguments: []argumentType{filePathArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleSearchCommand(client, clientAddress, parsedCommand[searchTermIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "group-add",
+		arguments: []argumentType{groupArgument, usernameArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleGroupAddCommand(client, clientAddress, parsedCommand[groupIndex], parsedCommand[groupMemberIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name:      "group-remove",
+		arguments: []argumentType{groupArgument, usernameArgument},
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleGroupRemoveCommand(client, clientAddress, parsedCommand[groupIndex], parsedCommand[groupMemberIndex])
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name: "list-groups",
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleListGroupsCommand(client, clientAddress)
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name: "list-users",
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handleListUsersCommand(client)
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name: "ping",
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			t.handlePingCommand(client)
+			return false
+		},
+	})
+	t.registerCommand(&command{
+		name: "pong",
+		handle: func(client *Client, clientAddress string, parsedCommand []string) bool {
+			// the lease has already been renewed when the command was received
+			return false
+		},
+	})
+}
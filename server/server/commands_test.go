@@ -0,0 +1,95 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	var tests = []struct {
+		line     string
+		expected []string
+	}{
+		{"", []string{}},
+		{" \t \r\n", []string{}},
+		{"list-files\n", []string{"list-files"}},
+		{"  register   bob \"/home/bob/my file.txt\"  \n", []string{"register", "bob", `"/home/bob/my file.txt"`}},
+		{"register bob \"/unterminated path", []string{"register", "bob", `"/unterminated path`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := splitCommand(tt.line); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDispatchRejectsMalformedCommands(t *testing.T) {
+	var tests = []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{"empty line", "\n", errorPrefix + "empty command"},
+		{"white space only", " \t \n", errorPrefix + "empty command"},
+		{"unknown command", "download bob \"/a\"\n", errorPrefix + "unknown command \"download\""},
+		{"missing argument", "rename\n", errorPrefix + "bad arguments, usage: rename username"},
+		{"extra argument", "rename bob alice\n", errorPrefix + "bad arguments, usage: rename username"},
+		{"missing files", "register bob\n", errorPrefix + "bad arguments, usage: register username"},
+		{"invalid username", "register Bob \"/a\"\n", errorPrefix + "bad arguments, \"Bob\" is not a valid username"},
+		{"unquoted file path", "register bob /a\n", errorPrefix + "bad arguments, /a is not a file path in double quotes"},
+		{"invalid address", "register-miniserver localhost\n", errorPrefix + "bad arguments, \"localhost\" is not a valid host:port address"},
+		{"invalid size", "register-content bob \"/a\" " + strings.Repeat("ab", 32) + " -1\n", errorPrefix + "bad arguments, \"-1\" is not a valid size"},
+		{"invalid push token", "push 127.0.0.1:9 xyz\n", errorPrefix + "bad arguments, \"xyz\" is not a valid token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createTestServer(t)
+			client, conn := connectTestClient(t, server, "127.0.0.1:4000")
+
+			if _, closeConnection := server.dispatch(client, "127.0.0.1:4000", splitCommand(tt.line)); closeConnection {
+				t.Error("expected the connection to stay open")
+			}
+			if replies := conn.replies(); len(replies) != 1 || !strings.HasPrefix(replies[0], tt.expected) {
+				t.Errorf("got %q, want a reply starting with %q", replies, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDispatchAfterClientWasRemoved(t *testing.T) {
+	var tests = []string{
+		"register bob \"/a\"",
+		"unregister bob \"/a\"",
+		"register-miniserver 127.0.0.1:9",
+		"register-device laptop",
+		"register-content bob \"/a\" " + strings.Repeat("ab", 32) + " 3",
+		"rename alice",
+		"alias alice",
+		"unalias alice",
+	}
+
+	for _, line := range tests {
+		t.Run(line, func(t *testing.T) {
+			server := createTestServer(t)
+			client, conn := connectTestClient(t, server, "127.0.0.1:4000")
+			if _, closeConnection := server.dispatch(client, "127.0.0.1:4000", splitCommand("register bob \"/b\"")); closeConnection {
+				t.Fatal("expected the connection to stay open")
+			}
+
+			server.closeConnectionOf("127.0.0.1:4000")
+			server.dispatch(client, "127.0.0.1:4000", splitCommand(line))
+
+			if replies := conn.replies(); replies[len(replies)-1] != notConnectedMessage {
+				t.Errorf("got %q, want %q", replies[len(replies)-1], notConnectedMessage)
+			}
+			if server.renewLease("127.0.0.1:4000") {
+				t.Error("expected the removed client to stay removed")
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/discovery"
+)
+
+const (
+	defaultHeartbeatInterval = 30 * time.Second
+	defaultLeaseDuration     = 90 * time.Second
+	defaultProbeInterval     = 60 * time.Second
+	defaultProbeTimeout      = 5 * time.Second
+	defaultLogLevel          = "info"
+	defaultLogFormat         = "logfmt"
+	defaultTicketTTL         = 2 * time.Minute
+
+	defaultCommandRate          = 20
+	defaultCommandBurst         = 40
+	defaultMaxFilesPerUser      = 1000
+	defaultMaxLineLength        = 4096
+	defaultMaxConnectionsPerIP  = 10
+	defaultViolationsBeforeBan  = 5
+	defaultTemporaryBanDuration = 10 * time.Minute
+	defaultAnnounceInterval     = 5 * time.Minute
+	defaultFederationInterval   = 5 * time.Second
+	defaultClusterTimeout       = time.Second
+	defaultRelayRate            = 1 << 20
+	defaultRelayMaxTransfers    = 10
+)
+
+// Config is a struct that contains:
+//     - HeartbeatInterval    - how often the server pings its clients and checks for expired leases
+//     - LeaseDuration        - how long a client stays registered without sending anything to the server
+//     - ProbeInterval        - how often the server checks whether the mini servers of its clients are reachable
+//     - ProbeTimeout         - how long the server waits for a mini server to answer a health probe
+//     - AdminAddress         - the address of the admin interface("host:port" or "unix:/path/to/socket"), empty disables it
+//     - AdminToken           - the token that admin connections have to authenticate with
+//     - MetricsAddress       - the address of the HTTP "/metrics" endpoint, empty disables it
+//     - LogLevel             - the least severe level that is logged("debug", "info", "warn" or "error"), file paths are logged only at "debug"
+//     - LogFormat            - the format of the log records("logfmt" or "json")
+//     - LogFile              - path to the file the log records are appended to, empty for standard error
+//     - TicketTTL            - how long a download ticket issued by the server is valid
+//     - TicketKeyFile        - path to the file with the key that download tickets are signed with, empty for a new key on every start
+//     - CommandRate          - how many commands per second a connection may send on average, 0 disables the limit
+//     - CommandBurst         - how many commands a connection may send at once
+//     - MaxFilesPerUser      - how many files can be registered under a single username, 0 disables the limit
+//     - MaxLineLength        - the most bytes a command may have, 0 disables the limit
+//     - MaxConnectionsPerIP  - how many connections a single IP may have at once, 0 disables the limit
+//     - ViolationsBeforeBan  - after how many violations of the limits above a connection is closed and its IP is banned, 0 disables the bans
+//     - TemporaryBanDuration - how long such a ban lasts
+//     - AnnounceAddress      - the address of the BitTorrent HTTP tracker("/announce" and "/scrape"), empty disables it
+//     - AnnounceInterval     - how often BitTorrent clients are asked to announce themselves
+//     - DiscoveryGroup       - the UDP multicast group on which the server answers clients looking for a tracker, empty disables it
+//     - FederationName       - the name of the server in the federation, which tags the users and files it replicates
+//     - FederationAddress    - the address on which the server accepts the indexes of the other servers, empty if it only pushes its own
+//     - FederationPeers      - the federation addresses of the other servers, which the index of the server is pushed to
+//     - FederationToken      - the secret shared by all servers of the federation, empty disables the federation
+//     - FederationInterval   - how often the index is pushed to the other servers, indexes that are three intervals old are dropped
+//     - ClusterAddress       - the address of the endpoint on which the servers of a primary/standby cluster elect the primary and replicate its state,
+//                              as the other servers list it, empty disables the cluster
+//     - ClusterPeers         - the cluster addresses of the other servers
+//     - ClusterToken         - the secret shared by all servers of the cluster, empty disables the cluster
+//     - ClusterTimeout       - how long a standby waits for the primary before it asks to be elected in its place
+//     - RelayAddress         - the address on which the server relays transfers between clients that cannot connect to each other, empty disables it
+//     - RelayRate            - how many bytes per second a relayed transfer may send in each direction, 0 disables the limit
+//     - RelayMaxTransfers    - how many transfers can be relayed at once, 0 disables the limit
+type Config struct {
+	HeartbeatInterval time.Duration
+	LeaseDuration     time.Duration
+	ProbeInterval     time.Duration
+	ProbeTimeout      time.Duration
+	AdminAddress      string
+	AdminToken        string
+	MetricsAddress    string
+	LogLevel          string
+	LogFormat         string
+	LogFile           string
+	TicketTTL         time.Duration
+	TicketKeyFile     string
+
+	CommandRate          float64
+	CommandBurst         int
+	MaxFilesPerUser      int
+	MaxLineLength        int
+	MaxConnectionsPerIP  int
+	ViolationsBeforeBan  int
+	TemporaryBanDuration time.Duration
+	AnnounceAddress      string
+	AnnounceInterval     time.Duration
+	DiscoveryGroup       string
+	FederationName       string
+	FederationAddress    string
+	FederationPeers      []string
+	FederationToken      string
+	FederationInterval   time.Duration
+	ClusterAddress       string
+	ClusterPeers         []string
+	ClusterToken         string
+	ClusterTimeout       time.Duration
+	RelayAddress         string
+	RelayRate            int
+	RelayMaxTransfers    int
+}
+
+// configFile mirrors Config in the format of the JSON config file.
+// Fields which are missing from the file leave the corresponding setting unchanged.
+type configFile struct {
+	HeartbeatInterval *string `json:"heartbeat_interval"`
+	LeaseDuration     *string `json:"lease_duration"`
+	ProbeInterval     *string `json:"probe_interval"`
+	ProbeTimeout      *string `json:"probe_timeout"`
+	AdminAddress      *string `json:"admin_address"`
+	AdminToken        *string `json:"admin_token"`
+	MetricsAddress    *string `json:"metrics_address"`
+	LogLevel          *string `json:"log_level"`
+	LogFormat         *string `json:"log_format"`
+	LogFile           *string `json:"log_file"`
+	TicketTTL         *string `json:"ticket_ttl"`
+	TicketKeyFile     *string `json:"ticket_key_file"`
+
+	CommandRate          *float64 `json:"command_rate"`
+	CommandBurst         *int     `json:"command_burst"`
+	MaxFilesPerUser      *int     `json:"max_files_per_user"`
+	MaxLineLength        *int     `json:"max_line_length"`
+	MaxConnectionsPerIP  *int     `json:"max_connections_per_ip"`
+	ViolationsBeforeBan  *int     `json:"violations_before_ban"`
+	TemporaryBanDuration *string  `json:"temporary_ban_duration"`
+	AnnounceAddress      *string  `json:"announce_address"`
+	AnnounceInterval     *string  `json:"announce_interval"`
+	DiscoveryGroup       *string  `json:"discovery_group"`
+
+	FederationName     *string  `json:"federation_name"`
+	FederationAddress  *string  `json:"federation_address"`
+	FederationPeers    []string `json:"federation_peers"`
+	FederationToken    *string  `json:"federation_token"`
+	FederationInterval *string  `json:"federation_interval"`
+
+	ClusterAddress *string  `json:"cluster_address"`
+	ClusterPeers   []string `json:"cluster_peers"`
+	ClusterToken   *string  `json:"cluster_token"`
+	ClusterTimeout *string  `json:"cluster_timeout"`
+
+	RelayAddress      *string `json:"relay_address"`
+	RelayRate         *int    `json:"relay_rate"`
+	RelayMaxTransfers *int    `json:"relay_max_transfers"`
+}
+
+// CreateDefaultConfig is a factory method that:
+//    - creates and returns a pointer to Config struct with the default settings
+func CreateDefaultConfig() *Config {
+	return &Config{
+		HeartbeatInterval: defaultHeartbeatInterval,
+		LeaseDuration:     defaultLeaseDuration,
+		ProbeInterval:     defaultProbeInterval,
+		ProbeTimeout:      defaultProbeTimeout,
+		LogLevel:          defaultLogLevel,
+		LogFormat:         defaultLogFormat,
+		TicketTTL:         defaultTicketTTL,
+
+		CommandRate:          defaultCommandRate,
+		CommandBurst:         defaultCommandBurst,
+		MaxFilesPerUser:      defaultMaxFilesPerUser,
+		MaxLineLength:        defaultMaxLineLength,
+		MaxConnectionsPerIP:  defaultMaxConnectionsPerIP,
+		ViolationsBeforeBan:  defaultViolationsBeforeBan,
+		TemporaryBanDuration: defaultTemporaryBanDuration,
+		AnnounceInterval:     defaultAnnounceInterval,
+		DiscoveryGroup:       discovery.DefaultGroup,
+		FederationInterval:   defaultFederationInterval,
+		ClusterTimeout:       defaultClusterTimeout,
+		RelayRate:            defaultRelayRate,
+		RelayMaxTransfers:    defaultRelayMaxTransfers,
+	}
+}
+
+func setDuration(setting *time.Duration, value *string, name string) error {
+	if value == nil {
+		return nil
+	}
+
+	duration, err := time.ParseDuration(*value)
+	if err != nil {
+		return fmt.Errorf("Invalid %s %q. %w", name, *value, err)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("Invalid %s %q. It must be positive", name, *value)
+	}
+
+	*setting = duration
+	return nil
+}
+
+func setLimit(setting *int, value *int, name string) error {
+	if value == nil {
+		return nil
+	}
+	if *value < 0 {
+		return fmt.Errorf("Invalid %s %d. It must not be negative", name, *value)
+	}
+
+	*setting = *value
+	return nil
+}
+
+func setString(setting *string, value *string) {
+	if value != nil {
+		*setting = *value
+	}
+}
+
+// LoadFrom is a function that:
+//    - accepts:
+//         - path - path to a JSON config file
+//    - overrides the settings of the Config with the ones present in the file
+//    (***) Returns error if the file cannot be read or contains invalid settings, in which case the Config is left unchanged
+func (c *Config) LoadFrom(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Could not read config file %s. %w", path, err)
+	}
+
+	var file configFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("Could not parse config file %s. %w", path, err)
+	}
+
+	loaded := *c
+	if err := setDuration(&loaded.HeartbeatInterval, file.HeartbeatInterval, "heartbeat_interval"); err != nil {
+		return err
+	}
+	if err := setDuration(&loaded.LeaseDuration, file.LeaseDuration, "lease_duration"); err != nil {
+		return err
+	}
+	if err := setDuration(&loaded.ProbeInterval, file.ProbeInterval, "probe_interval"); err != nil {
+		return err
+	}
+	if err := setDuration(&loaded.ProbeTimeout, file.ProbeTimeout, "probe_timeout"); err != nil {
+		return err
+	}
+	if err := setDuration(&loaded.TicketTTL, file.TicketTTL, "ticket_ttl"); err != nil {
+		return err
+	}
+	if err := setDuration(&loaded.TemporaryBanDuration, file.TemporaryBanDuration, "temporary_ban_duration"); err != nil {
+		return err
+	}
+	if err := setDuration(&loaded.AnnounceInterval, file.AnnounceInterval, "announce_interval"); err != nil {
+		return err
+	}
+	if err := setDuration(&loaded.FederationInterval, file.FederationInterval, "federation_interval"); err != nil {
+		return err
+	}
+	if err := setDuration(&loaded.ClusterTimeout, file.ClusterTimeout, "cluster_timeout"); err != nil {
+		return err
+	}
+	if file.CommandRate != nil {
+		if *file.CommandRate < 0 {
+			return fmt.Errorf("Invalid command_rate %g. It must not be negative", *file.CommandRate)
+		}
+		loaded.CommandRate = *file.CommandRate
+	}
+	limits := []struct {
+		setting *int
+		value   *int
+		name    string
+	}{
+		{&loaded.CommandBurst, file.CommandBurst, "command_burst"},
+		{&loaded.MaxFilesPerUser, file.MaxFilesPerUser, "max_files_per_user"},
+		{&loaded.MaxLineLength, file.MaxLineLength, "max_line_length"},
+		{&loaded.MaxConnectionsPerIP, file.MaxConnectionsPerIP, "max_connections_per_ip"},
+		{&loaded.ViolationsBeforeBan, file.ViolationsBeforeBan, "violations_before_ban"},
+		{&loaded.RelayRate, file.RelayRate, "relay_rate"},
+		{&loaded.RelayMaxTransfers, file.RelayMaxTransfers, "relay_max_transfers"},
+	}
+	for _, limit := range limits {
+		if err := setLimit(limit.setting, limit.value, limit.name); err != nil {
+			return err
+		}
+	}
+	setString(&loaded.AdminAddress, file.AdminAddress)
+	setString(&loaded.AdminToken, file.AdminToken)
+	setString(&loaded.MetricsAddress, file.MetricsAddress)
+	setString(&loaded.LogLevel, file.LogLevel)
+	setString(&loaded.LogFormat, file.LogFormat)
+	setString(&loaded.LogFile, file.LogFile)
+	setString(&loaded.TicketKeyFile, file.TicketKeyFile)
+	setString(&loaded.AnnounceAddress, file.AnnounceAddress)
+	setString(&loaded.DiscoveryGroup, file.DiscoveryGroup)
+	setString(&loaded.FederationName, file.FederationName)
+	setString(&loaded.FederationAddress, file.FederationAddress)
+	setString(&loaded.FederationToken, file.FederationToken)
+	if file.FederationPeers != nil {
+		loaded.FederationPeers = file.FederationPeers
+	}
+	setString(&loaded.ClusterAddress, file.ClusterAddress)
+	setString(&loaded.ClusterToken, file.ClusterToken)
+	if file.ClusterPeers != nil {
+		loaded.ClusterPeers = file.ClusterPeers
+	}
+	setString(&loaded.RelayAddress, file.RelayAddress)
+
+	*c = loaded
+	return nil
+}
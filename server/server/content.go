@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+const (
+	contentFileIndex = 2
+	contentIDIndex   = 3
+	contentSizeIndex = 4
+	infoHashIndex    = 5
+
+	locatedContentIDIndex = 1
+)
+
+var (
+	contentIDRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	infoHashRegex  = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// setContentID is a function that records the content ID, size and BitTorrent info hash of a file that "username" has registered
+func (t *TorrentServer) setContentID(clientAddress, username, filePath, contentID string, size int64, infoHash string) string {
+	username = t.qualifyFor(clientAddress, username)
+
+	registeredAs, valid := t.canUseUsername(clientAddress, username)
+	if !valid && registeredAs == "" {
+		return notConnectedMessage
+	}
+	if !valid || registeredAs == "" {
+		return fmt.Sprintf("%syou are not registered as %s", errorPrefix, username)
+	}
+
+	t.filesMutex.Lock()
+	defer t.filesMutex.Unlock()
+
+	info, ok := t.files[username][filePath]
+	if !ok {
+		return fmt.Sprintf("%s%s has not registered %q", errorPrefix, username, filePath)
+	}
+
+	info.contentID = contentID
+	info.size = size
+	info.infoHash = infoHash
+	return fmt.Sprintf("content-registered %s \"%s\"", contentID, filePath)
+}
+
+// locateContent is a function that:
+//    - accepts:
+//         - requesterAddress - the address of the client that wants to download the file
+//         - matches          - a function that returns whether a registered file is the wanted one
+//    - returns the holder of a matching file and the path of the file on it, preferring reachable mini servers
+//    (***) Returns false if nobody visible to the requester has registered a matching file
+func (t *TorrentServer) locateContent(requesterAddress string, matches func(info *fileInfo) bool) (holder, string, bool) {
+	holders := t.collectHolders()
+	r := t.requesterFor(requesterAddress)
+
+	t.filesMutex.RLock()
+	candidates := make([]holder, 0)
+	paths := make(map[string]string)
+	for holderIdentity, filePaths := range t.files {
+		h, ok := holders[holderIdentity]
+		if !ok || h.miniServerAddress == "" {
+			continue
+		}
+		for filePath, info := range filePaths {
+			if matches(info) && r.canSee(holderIdentity, info.scope) {
+				candidates = append(candidates, h)
+				paths[holderIdentity] = filePath
+				break
+			}
+		}
+	}
+	t.filesMutex.RUnlock()
+
+	for _, file := range t.federatedFiles(r) {
+		if _, found := paths[file.holder.identity]; !found && matches(file.info) && file.holder.miniServerAddress != "" {
+			candidates = append(candidates, file.holder)
+			paths[file.holder.identity] = file.path
+		}
+	}
+
+	h, ok := pickHolder(candidates)
+	return h, paths[h.identity], ok
+}
+
+func (t *TorrentServer) handleRegisterContentCommand(client *Client, clientAddress string, parsedCommand []string) {
+	size, err := strconv.ParseInt(parsedCommand[contentSizeIndex], 10, 64)
+	if err != nil {
+		client.send(errorPrefix + err.Error())
+		return
+	}
+
+	infoHash := ""
+	if len(parsedCommand) > infoHashIndex {
+		infoHash = parsedCommand[infoHashIndex]
+	}
+
+	filePath := strings.ReplaceAll(parsedCommand[contentFileIndex], `"`, "")
+	client.send(t.setContentID(clientAddress, parsedCommand[userIndex], filePath, parsedCommand[contentIDIndex], size, infoHash))
+}
+
+// handleLocateContentCommand is a function that answers where a file with content ID or BitTorrent info hash "contentID" can be downloaded from
+func (t *TorrentServer) handleLocateContentCommand(client *Client, clientAddress, contentID string) {
+	h, filePath, ok := t.locateContent(clientAddress, func(info *fileInfo) bool {
+		return info.contentID == contentID || info.infoHash == contentID
+	})
+	if !ok {
+		client.send("not-located-content " + contentID)
+		return
+	}
+
+	signedTicket, err := t.issueTicket(clientAddress, h, filePath)
+	if err != nil {
+		t.logger.Error("Could not issue download ticket", "component", "tickets", "client", clientAddress, "holder", h.identity, "error", err)
+		client.send("not-located-content " + contentID)
+		return
+	}
+	t.logger.Info("Issued download ticket", "component", "tickets", "client", clientAddress, "holder", h.identity, "file", logging.Path(filePath))
+
+	client.send(fmt.Sprintf("located-content %s %s %s %s \"%s\"", contentID, h.identity, h.miniServerAddress, signedTicket, filePath))
+}
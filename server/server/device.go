@@ -0,0 +1,187 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+const deviceSeparator = "@"
+
+// qualify is a function that returns the identity of "username" on "device", e.g. "alice@laptop",
+// or just "username" if there is no device
+func qualify(username, device string) string {
+	if device == "" {
+		return username
+	}
+	return username + deviceSeparator + device
+}
+
+// splitIdentity is a function that splits an identity like "alice@laptop" into its username and device
+func splitIdentity(identity string) (string, string) {
+	split := strings.SplitN(identity, deviceSeparator, 2)
+	if len(split) == 2 {
+		return split[0], split[1]
+	}
+	return identity, ""
+}
+
+// identitiesConflict is a function that returns whether two identities cannot be held by different connections.
+// The same username can be held by several connections only if each of them is on a different named device.
+func identitiesConflict(first, second string) bool {
+	firstUsername, firstDevice := splitIdentity(first)
+	secondUsername, secondDevice := splitIdentity(second)
+
+	if firstUsername != secondUsername {
+		return false
+	}
+	return firstDevice == "" || secondDevice == "" || firstDevice == secondDevice
+}
+
+// isIdentityUsedByOther is a function that returns whether "identity" conflicts with an identity of another connection.
+// It has to be called while "usedUsernamesMutex" is held.
+func (t *TorrentServer) isIdentityUsedByOther(senderAddress, identity string) bool {
+	for usedIdentity, owner := range t.usedUsernames {
+		if *owner != senderAddress && identitiesConflict(usedIdentity, identity) {
+			return true
+		}
+	}
+	return false
+}
+
+// qualifyFor is a function that returns the identity of "username" on the device of the client with "clientAddress"
+func (t *TorrentServer) qualifyFor(clientAddress, username string) string {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	if client, ok := t.clients[clientAddress]; ok {
+		return qualify(username, client.device)
+	}
+	return username
+}
+
+func (t *TorrentServer) registerDevice(clientAddress, device string) string {
+	t.clientsMutex.Lock()
+	defer t.clientsMutex.Unlock()
+
+	client, ok := t.clients[clientAddress]
+	if !ok {
+		return notConnectedMessage
+	}
+	if client.username != "" {
+		return fmt.Sprintf("You have already registered as %s, the device cannot be changed anymore.", client.username)
+	}
+
+	client.device = device
+	return fmt.Sprintf("Successfully registered device %s.", device)
+}
+
+func (t *TorrentServer) handleRegisterDeviceCommand(client *Client, clientAddress, device string) {
+	client.send(t.registerDevice(clientAddress, device))
+}
+
+// holder is a connection that has registered a file
+type holder struct {
+	identity          string
+	miniServerAddress string
+	reachability      string
+}
+
+func (t *TorrentServer) collectHolders() map[string]holder {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	holders := make(map[string]holder)
+	for _, client := range t.clients {
+		for _, name := range client.names() {
+			holders[name] = holder{
+				identity:          name,
+				miniServerAddress: client.miniServerAddress,
+				reachability:      client.reachability,
+			}
+		}
+	}
+	return holders
+}
+
+// locate is a function that:
+//    - accepts:
+//         - requesterAddress - the address of the client that wants to download the file
+//         - identity         - a username, which matches all of its devices, or a username on a specific device
+//         - filePath         - the path of a registered file
+//    - returns the holder of the file, preferring reachable mini servers
+//    (***) Returns false if nobody with that identity has registered the file or the requester cannot see it
+func (t *TorrentServer) locate(requesterAddress, identity, filePath string) (holder, bool) {
+	holders := t.collectHolders()
+	r := t.requesterFor(requesterAddress)
+
+	t.filesMutex.RLock()
+	candidates := make([]holder, 0)
+	for holderIdentity, filePaths := range t.files {
+		if !matchesIdentity(holderIdentity, identity) {
+			continue
+		}
+		info, ok := filePaths[filePath]
+		if !ok || !r.canSee(holderIdentity, info.scope) {
+			continue
+		}
+		if h, ok := holders[holderIdentity]; ok && h.miniServerAddress != "" {
+			candidates = append(candidates, h)
+		}
+	}
+	t.filesMutex.RUnlock()
+
+	for _, file := range t.federatedFiles(r) {
+		if matchesIdentity(file.holder.identity, identity) && file.path == filePath && file.holder.miniServerAddress != "" {
+			candidates = append(candidates, file.holder)
+		}
+	}
+
+	return pickHolder(candidates)
+}
+
+// matchesIdentity is a function that returns whether "holderIdentity" is "identity" or, if "identity" is only a username,
+// any device of that username
+func matchesIdentity(holderIdentity, identity string) bool {
+	holderUsername, _ := splitIdentity(holderIdentity)
+	_, device := splitIdentity(identity)
+	return holderIdentity == identity || (device == "" && holderUsername == identity)
+}
+
+// pickHolder is a function that returns the best of "candidates", preferring reachable mini servers
+func pickHolder(candidates []holder) (holder, bool) {
+	if len(candidates) == 0 {
+		return holder{}, false
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if (candidates[i].reachability == reachable) != (candidates[j].reachability == reachable) {
+			return candidates[i].reachability == reachable
+		}
+		return candidates[i].identity < candidates[j].identity
+	})
+
+	return candidates[0], true
+}
+
+func (t *TorrentServer) handleLocateCommand(client *Client, clientAddress, identity, filePath string) {
+	trimmedFilePath := strings.ReplaceAll(filePath, `"`, "")
+
+	h, ok := t.locate(clientAddress, identity, trimmedFilePath)
+	if !ok {
+		client.send(fmt.Sprintf("not-located %s %s", identity, filePath))
+		return
+	}
+
+	signedTicket, err := t.issueTicket(clientAddress, h, trimmedFilePath)
+	if err != nil {
+		t.logger.Error("Could not issue download ticket", "component", "tickets", "client", clientAddress, "holder", h.identity, "error", err)
+		client.send(fmt.Sprintf("not-located %s %s", identity, filePath))
+		return
+	}
+	t.logger.Info("Issued download ticket", "component", "tickets", "client", clientAddress, "holder", h.identity, "file", logging.Path(trimmedFilePath))
+
+	client.send(fmt.Sprintf("located %s %s %s %s", h.identity, h.miniServerAddress, signedTicket, filePath))
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// connectTestDevices is a function that connects alice on her laptop and workstation and bob, each with the files "/laptop",
+// "/workstation" and "/bob", and returns the replies to bob
+func connectTestDevices(t *testing.T, server *TorrentServer) (*Client, *recordingConn) {
+	t.Helper()
+
+	laptop, _ := connectTestClient(t, server, "127.0.0.1:4000")
+	dispatchAll(server, laptop, "127.0.0.1:4000", "register-device laptop", "register-miniserver 127.0.0.1:9000", `register alice "/laptop"`)
+	workstation, _ := connectTestClient(t, server, "127.0.0.1:4001")
+	dispatchAll(server, workstation, "127.0.0.1:4001", "register-device workstation", "register-miniserver 127.0.0.1:9001", `register alice "/workstation"`)
+	bob, bobConn := connectTestClient(t, server, "127.0.0.1:4002")
+	dispatchAll(server, bob, "127.0.0.1:4002", "register-miniserver 127.0.0.1:9002", `register bob "/bob"`)
+
+	return bob, bobConn
+}
+
+func TestListFilesShowsTheDevices(t *testing.T) {
+	server := createTestServer(t)
+	bob, bobConn := connectTestDevices(t, server)
+
+	server.dispatch(bob, "127.0.0.1:4002", splitCommand("list-files"))
+
+	replies := bobConn.replies()
+	expected := []string{"alice@laptop (unknown) : /laptop", "alice@workstation (unknown) : /workstation", "bob (unknown) : /bob"}
+	if files := listedFiles(replies[len(replies)-1]); !reflect.DeepEqual(files, expected) {
+		t.Errorf("got %q, want %q", files, expected)
+	}
+}
+
+func TestLocateRoutesToTheDeviceWithTheFile(t *testing.T) {
+	var tests = []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{"any device of the user", `locate alice "/workstation"`, "located alice@workstation 127.0.0.1:9001 "},
+		{"the device with the file", `locate alice@laptop "/laptop"`, "located alice@laptop 127.0.0.1:9000 "},
+		{"another device", `locate alice@laptop "/workstation"`, `not-located alice@laptop "/workstation"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createTestServer(t)
+			bob, bobConn := connectTestDevices(t, server)
+
+			server.dispatch(bob, "127.0.0.1:4002", splitCommand(tt.command))
+
+			if replies := bobConn.replies(); !strings.HasPrefix(replies[len(replies)-1], tt.expected) {
+				t.Errorf("got %q, want a reply starting with %q", replies[len(replies)-1], tt.expected)
+			}
+		})
+	}
+}
+
+func TestUsernameOnDevicesConflicts(t *testing.T) {
+	var tests = []struct {
+		name     string
+		device   string
+		expected string
+	}{
+		{"without a device", "", "Another user has already registered as alice."},
+		{"on a used device", "laptop", "Another user has already registered as alice@laptop."},
+		{"on another device", "phone", "Successfully registered files."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createTestServer(t)
+			connectTestDevices(t, server)
+
+			client, conn := connectTestClient(t, server, "127.0.0.1:4003")
+			if tt.device != "" {
+				server.dispatch(client, "127.0.0.1:4003", splitCommand("register-device "+tt.device))
+			}
+			server.dispatch(client, "127.0.0.1:4003", splitCommand(`register alice "/other"`))
+
+			if replies := conn.replies(); replies[len(replies)-1] != tt.expected {
+				t.Errorf("got %q, want %q", replies[len(replies)-1], tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/imaikeru/peer-to-peer/shared/discovery"
+)
+
+// answerDiscoveryQueries is a function that announces the server on the multicast group "group"
+// and tells every client that asks for a tracker there on which port the server listens
+//    (***) Returns error if the group cannot be joined
+func (t *TorrentServer) answerDiscoveryQueries(group string) error {
+	port, err := strconv.Atoi(t.port)
+	if err != nil {
+		return err
+	}
+
+	responder, err := discovery.CreateResponder(group, discovery.Announcement{Service: discovery.TrackerService, Port: port})
+	if err != nil {
+		return err
+	}
+	defer responder.Close()
+
+	t.logger.Info("Answering discovery queries", "component", "discovery", "group", group)
+	return responder.Serve()
+}
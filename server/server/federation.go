@@ -0,0 +1,175 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/server/federation"
+)
+
+// federatedFile is a file registered on another server of the federation
+type federatedFile struct {
+	origin string
+	holder holder
+	path   string
+	info   *fileInfo
+}
+
+// snapshot is a function that returns the users, files and groups of this server, which are pushed to its peers
+func (t *TorrentServer) snapshot() federation.Snapshot {
+	var s federation.Snapshot
+
+	t.clientsMutex.RLock()
+	for _, client := range t.clients {
+		if client.miniServerAddress == "" {
+			continue
+		}
+		for _, name := range client.names() {
+			s.Users = append(s.Users, federation.User{
+				Identity:          name,
+				MiniServerAddress: client.miniServerAddress,
+				Reachability:      client.reachability,
+				ConnectedAt:       client.connectedAt,
+			})
+		}
+	}
+	t.clientsMutex.RUnlock()
+
+	t.filesMutex.RLock()
+	for identity, filePaths := range t.files {
+		for filePath, info := range filePaths {
+			s.Files = append(s.Files, federation.File{
+				Identity:  identity,
+				Path:      filePath,
+				Scope:     info.scope.String(),
+				ContentID: info.contentID,
+				Size:      info.size,
+				InfoHash:  info.infoHash,
+			})
+		}
+	}
+	t.filesMutex.RUnlock()
+
+	t.groupsMutex.RLock()
+	for name, g := range t.groups {
+		members := make([]string, 0, len(g.members))
+		for member := range g.members {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		s.Groups = append(s.Groups, federation.Group{Name: name, Owner: g.owner, Members: members})
+	}
+	t.groupsMutex.RUnlock()
+
+	return s
+}
+
+// pushSnapshotsPeriodically is a function that replicates the index of the server to its peers every "FederationInterval"
+func (t *TorrentServer) pushSnapshotsPeriodically() {
+	for {
+		if err := t.federation.Push(t.snapshot()); err != nil {
+			t.metrics.errors.WithLabel("federation_push").Inc()
+			t.logger.Warn("Could not replicate the index", "component", "federation", "error", err)
+		}
+		time.Sleep(t.getConfig().FederationInterval)
+	}
+}
+
+// federatedOwnerOf is a function that returns the other server of the federation on which "identity" is already used
+//    (***) Returns false if the federation is disabled or no other server uses it
+func (t *TorrentServer) federatedOwnerOf(identity string) (string, bool) {
+	if t.federation == nil {
+		return "", false
+	}
+	return t.federation.Owner(identity, time.Now())
+}
+
+// federatedView is a function that returns the snapshots of the other servers without the users that lose a username conflict
+func (t *TorrentServer) federatedView() []federation.Snapshot {
+	if t.federation == nil {
+		return nil
+	}
+
+	t.clientsMutex.RLock()
+	local := make([]federation.User, 0, len(t.clients))
+	for _, client := range t.clients {
+		for _, name := range client.names() {
+			local = append(local, federation.User{Identity: name})
+		}
+	}
+	t.clientsMutex.RUnlock()
+
+	return t.federation.Merge(local, time.Now())
+}
+
+// requesterIn is a function that returns "r" as a member of the sharing groups of another server
+func requesterIn(r *requester, groups []federation.Group) *requester {
+	remote := &requester{usernames: r.usernames, groups: make(map[string]struct{})}
+	for _, g := range groups {
+		for _, member := range g.Members {
+			if _, ok := r.usernames[member]; ok {
+				remote.groups[g.Name] = struct{}{}
+				break
+			}
+		}
+	}
+	return remote
+}
+
+// federatedFiles is a function that returns the files on the other servers of the federation that "r" can see
+func (t *TorrentServer) federatedFiles(r *requester) []federatedFile {
+	files := make([]federatedFile, 0)
+	for _, s := range t.federatedView() {
+		remote := requesterIn(r, s.Groups)
+
+		holders := make(map[string]holder)
+		for _, user := range s.Users {
+			holders[user.Identity] = holder{
+				identity:          user.Identity,
+				miniServerAddress: user.MiniServerAddress,
+				reachability:      user.Reachability,
+			}
+		}
+
+		for _, file := range s.Files {
+			h, ok := holders[file.Identity]
+			if !ok {
+				continue
+			}
+			fileScope, err := parseScope(file.Scope)
+			if err != nil || !remote.canSee(file.Identity, fileScope) {
+				continue
+			}
+			files = append(files, federatedFile{
+				origin: s.Origin,
+				holder: h,
+				path:   file.Path,
+				info:   &fileInfo{scope: fileScope, contentID: file.ContentID, size: file.Size, infoHash: file.InfoHash},
+			})
+		}
+	}
+	return files
+}
+
+// listFederatedFiles is a function that lists the files on the other servers that "r" can see and whose paths contain "term"
+func (t *TorrentServer) listFederatedFiles(r *requester, term string) string {
+	var sb strings.Builder
+	for _, file := range t.federatedFiles(r) {
+		if strings.Contains(strings.ToLower(file.path), term) {
+			sb.WriteString(file.holder.identity + " (" + file.holder.reachability + ") [" + file.origin + "] : " + file.path + ";")
+		}
+	}
+	return sb.String()
+}
+
+// listFederatedUsers is a function that lists the users on the other servers in the format of "list-users"
+func (t *TorrentServer) listFederatedUsers() string {
+	var sb strings.Builder
+	for _, s := range t.federatedView() {
+		for _, user := range s.Users {
+			sb.WriteString(user.Identity + " (" + user.Reachability + ") - " + user.MiniServerAddress + ";")
+		}
+	}
+	return sb.String()
+}
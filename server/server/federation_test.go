@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// createTestFederation is a function that returns the servers "office" and "branch" of a federation,
+// where "office" pushes its index to the endpoint of "branch" through "push"
+func createTestFederation(t *testing.T) (office, branch *TorrentServer, push func()) {
+	t.Helper()
+
+	branch = createTestServer(t, func(config *Config) {
+		config.FederationName = "branch"
+		config.FederationToken = "secret"
+		config.FederationAddress = "127.0.0.1:0"
+	})
+	endpoint := httptest.NewServer(branch.federation)
+	t.Cleanup(endpoint.Close)
+
+	office = createTestServer(t, func(config *Config) {
+		config.FederationName = "office"
+		config.FederationToken = "secret"
+		config.FederationPeers = []string{endpoint.Listener.Addr().String()}
+	})
+	push = func() {
+		if err := office.federation.Push(office.snapshot()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return office, branch, push
+}
+
+func TestFederatedFilesAreListedWithTheirOrigin(t *testing.T) {
+	var tests = []struct {
+		requester string
+		expected  []string
+	}{
+		{"bob", []string{"alice (unknown) [office] : /report", "bob (unknown) : /bob", "carol (unknown) : /notes"}},
+		{"carol", []string{"alice (unknown) [office] : /carol", "alice (unknown) [office] : /report", "bob (unknown) : /bob", "carol (unknown) : /notes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.requester, func(t *testing.T) {
+			office, branch, push := createTestFederation(t)
+			alice, _ := connectTestClient(t, office, "127.0.0.1:4000")
+			dispatchAll(office, alice, "127.0.0.1:4000", "register-miniserver 127.0.0.1:9000", `register alice "/report"`, `register alice users:carol "/carol"`)
+			bob, bobConn := connectTestClient(t, branch, "127.0.0.1:5000")
+			dispatchAll(branch, bob, "127.0.0.1:5000", `register bob "/bob"`)
+			carol, carolConn := connectTestClient(t, branch, "127.0.0.1:5001")
+			dispatchAll(branch, carol, "127.0.0.1:5001", `register carol "/notes"`)
+			push()
+
+			requesters := map[string]*Client{"bob": bob, "carol": carol}
+			conns := map[string]*recordingConn{"bob": bobConn, "carol": carolConn}
+			addresses := map[string]string{"bob": "127.0.0.1:5000", "carol": "127.0.0.1:5001"}
+			branch.dispatch(requesters[tt.requester], addresses[tt.requester], splitCommand("list-files"))
+
+			replies := conns[tt.requester].replies()
+			if files := listedFiles(replies[len(replies)-1]); !reflect.DeepEqual(files, tt.expected) {
+				t.Errorf("got %q, want %q", files, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFederatedUsersCanBeLocatedAndKeepTheirUsernames(t *testing.T) {
+	office, branch, push := createTestFederation(t)
+	alice, _ := connectTestClient(t, office, "127.0.0.1:4000")
+	dispatchAll(office, alice, "127.0.0.1:4000", "register-miniserver 127.0.0.1:9000", `register alice "/report"`)
+	push()
+
+	bob, bobConn := connectTestClient(t, branch, "127.0.0.1:5000")
+	dispatchAll(branch, bob, "127.0.0.1:5000", `locate alice "/report"`, `register alice "/other"`)
+
+	replies := bobConn.replies()
+	if !strings.HasPrefix(replies[0], "located alice 127.0.0.1:9000 ") {
+		t.Errorf("expected the file to be located on the mini server of alice at the office, got %q", replies[0])
+	}
+	if expected := "Another user has already registered as alice on server office."; replies[1] != expected {
+		t.Errorf("got %q, want %q", replies[1], expected)
+	}
+}
+
+func TestLocalUsersWinUsernameConflicts(t *testing.T) {
+	office, branch, push := createTestFederation(t)
+	bob, bobConn := connectTestClient(t, branch, "127.0.0.1:5000")
+	localAlice, _ := connectTestClient(t, branch, "127.0.0.1:5001")
+	dispatchAll(branch, localAlice, "127.0.0.1:5001", `register alice "/local"`)
+
+	alice, _ := connectTestClient(t, office, "127.0.0.1:4000")
+	dispatchAll(office, alice, "127.0.0.1:4000", "register-miniserver 127.0.0.1:9000", `register alice "/report"`)
+	push()
+
+	branch.dispatch(bob, "127.0.0.1:5000", splitCommand("list-files"))
+
+	expected := []string{"alice (unknown) : /local"}
+	if files := listedFiles(bobConn.replies()[0]); !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected the files of the other alice to be hidden, got %q", files)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingConn is a net.Conn that keeps what the server writes to it
+type recordingConn struct {
+	net.Conn
+	written bytes.Buffer
+	closed  bool
+	mutex   sync.Mutex
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.written.Write(b)
+}
+
+func (c *recordingConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+	return nil
+}
+
+func (c *recordingConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// replies is a function that returns the lines written to the connection so far
+func (c *recordingConn) replies() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return strings.Split(strings.TrimSuffix(c.written.String(), "\n"), "\n")
+}
+
+// createTestServer is a function that returns a server that logs only errors and whose config "configure" changes
+func createTestServer(t *testing.T, configure ...func(config *Config)) *TorrentServer {
+	t.Helper()
+
+	config := CreateDefaultConfig()
+	config.LogLevel = "error"
+	for _, change := range configure {
+		change(config)
+	}
+	server, err := CreateNewServerWithConfig("0", config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// connectTestClient is a function that connects a client at "address" to "server" over a connection that keeps the replies
+func connectTestClient(t *testing.T, server *TorrentServer, address string) (*Client, *recordingConn) {
+	t.Helper()
+
+	conn := &recordingConn{}
+	client, registered := server.registerClient(address, conn)
+	if !registered {
+		t.Fatalf("could not register client %s", address)
+	}
+	return client, conn
+}
+
+// listedFiles is a function that returns the entries of a "list-files" or "search" reply in alphabetical order
+func listedFiles(reply string) []string {
+	entries := strings.Split(strings.Trim(reply[strings.Index(reply, ":")+1:], ";"), ";")
+	if len(entries) == 1 && entries[0] == "" {
+		return []string{}
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// dispatchAll is a function that executes "commands" as if the client at "address" sent them to "server" one after another
+func dispatchAll(server *TorrentServer, client *Client, address string, commands ...string) {
+	for _, command := range commands {
+		server.dispatch(client, address, splitCommand(command))
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+)
+
+// hasName is a function that returns whether "name" is the username or one of the aliases of the Client
+func (c *Client) hasName(name string) bool {
+	if c.username == name {
+		return true
+	}
+
+	_, isAlias := c.aliases[name]
+	return isAlias
+}
+
+// belongsTo is a function that returns whether the Client holds "username" on any device
+func (c *Client) belongsTo(username string) bool {
+	for _, name := range c.names() {
+		if identityBelongsTo(name, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// identityBelongsTo is a function that returns whether "identity" is "username" or "username" on one of its devices
+func identityBelongsTo(identity, username string) bool {
+	identityUsername, _ := splitIdentity(identity)
+	return identity == username || identityUsername == username
+}
+
+// names is a function that returns the username of the Client followed by its aliases in alphabetical order
+func (c *Client) names() []string {
+	names := make([]string, 0, 1+len(c.aliases))
+	if c.username != "" {
+		names = append(names, c.username)
+	}
+
+	aliases := make([]string, 0, len(c.aliases))
+	for alias := range c.aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	return append(names, aliases...)
+}
+
+// canUseUsername is a function that returns the username of the client at "senderAddress" and whether it can use "username".
+// A client that is no longer connected gets an empty username and cannot use any.
+func (t *TorrentServer) canUseUsername(senderAddress, username string) (string, bool) {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	client, ok := t.clients[senderAddress]
+	if !ok {
+		return "", false
+	}
+	if client.username == "" || client.hasName(username) {
+		return client.username, true
+	}
+
+	return client.username, false
+}
+
+func (t *TorrentServer) rename(clientAddress, newUsername string) string {
+	if t.isUsernameBanned(newUsername) {
+		return fmt.Sprintf("The username %s is banned.", newUsername)
+	}
+
+	t.usedUsernamesMutex.Lock()
+	defer t.usedUsernamesMutex.Unlock()
+
+	t.clientsMutex.Lock()
+	defer t.clientsMutex.Unlock()
+
+	t.filesMutex.Lock()
+	defer t.filesMutex.Unlock()
+
+	client, ok := t.clients[clientAddress]
+	if !ok {
+		return notConnectedMessage
+	}
+	oldUsername := client.username
+	newUsername = qualify(newUsername, client.device)
+
+	if oldUsername == "" {
+		return "You have not registered yet, register files first."
+	}
+	if oldUsername == newUsername {
+		return fmt.Sprintf("You are already registered as %s.", newUsername)
+	}
+	if _, isAlias := client.aliases[newUsername]; isAlias {
+		return fmt.Sprintf("%s is one of your aliases, unalias it first.", newUsername)
+	}
+	if t.isIdentityUsedByOther(clientAddress, newUsername) {
+		return fmt.Sprintf("Another user has already registered as %s.", newUsername)
+	}
+	if origin, used := t.federatedOwnerOf(newUsername); used {
+		return fmt.Sprintf("Another user has already registered as %s on server %s.", newUsername, origin)
+	}
+
+	if files, ok := t.files[oldUsername]; ok {
+		t.files[newUsername] = files
+		delete(t.files, oldUsername)
+	}
+
+	delete(t.usedUsernames, oldUsername)
+	t.usedUsernames[newUsername] = &clientAddress
+	client.username = newUsername
+
+	// groups and scopes name users without their devices, so they follow the rename once no device keeps the old username
+	oldPrimary, _ := splitIdentity(oldUsername)
+	if newPrimary, _ := splitIdentity(newUsername); newPrimary != oldPrimary && !t.isPrimaryUsernameUsed(oldPrimary) {
+		t.renameInSharing(oldPrimary, newPrimary)
+	}
+
+	t.logger.Info("Renamed user", "component", "tracker", "client", clientAddress, "from", oldUsername, "to", newUsername)
+
+	return fmt.Sprintf("Successfully renamed %s to %s.", oldUsername, newUsername)
+}
+
+func (t *TorrentServer) addAlias(clientAddress, alias string) string {
+	if t.isUsernameBanned(alias) {
+		return fmt.Sprintf("The username %s is banned.", alias)
+	}
+
+	t.usedUsernamesMutex.Lock()
+	defer t.usedUsernamesMutex.Unlock()
+
+	t.clientsMutex.Lock()
+	defer t.clientsMutex.Unlock()
+
+	client, ok := t.clients[clientAddress]
+	if !ok {
+		return notConnectedMessage
+	}
+	alias = qualify(alias, client.device)
+
+	if client.username == "" {
+		return "You have not registered yet, register files first."
+	}
+	if client.hasName(alias) {
+		return fmt.Sprintf("You are already known as %s.", alias)
+	}
+	if t.isIdentityUsedByOther(clientAddress, alias) {
+		return fmt.Sprintf("Another user has already registered as %s.", alias)
+	}
+	if origin, used := t.federatedOwnerOf(alias); used {
+		return fmt.Sprintf("Another user has already registered as %s on server %s.", alias, origin)
+	}
+
+	t.usedUsernames[alias] = &clientAddress
+	client.aliases[alias] = struct{}{}
+
+	t.logger.Info("Added alias", "component", "tracker", "client", clientAddress, "user", client.username, "alias", alias)
+
+	return fmt.Sprintf("Successfully added alias %s.", alias)
+}
+
+func (t *TorrentServer) removeAlias(clientAddress, alias string) string {
+	t.usedUsernamesMutex.Lock()
+	defer t.usedUsernamesMutex.Unlock()
+
+	t.clientsMutex.Lock()
+	defer t.clientsMutex.Unlock()
+
+	client, ok := t.clients[clientAddress]
+	if !ok {
+		return notConnectedMessage
+	}
+	alias = qualify(alias, client.device)
+
+	if _, isAlias := client.aliases[alias]; !isAlias {
+		return fmt.Sprintf("%s is not one of your aliases.", alias)
+	}
+
+	delete(client.aliases, alias)
+	delete(t.usedUsernames, alias)
+	t.deleteFilesFor(alias)
+
+	t.logger.Info("Removed alias", "component", "tracker", "client", clientAddress, "user", client.username, "alias", alias)
+
+	return fmt.Sprintf("Successfully removed alias %s and its files.", alias)
+}
+
+func (t *TorrentServer) handleRenameCommand(client *Client, clientAddress, newUsername string) {
+	client.send(t.rename(clientAddress, newUsername))
+}
+
+func (t *TorrentServer) handleAliasCommand(client *Client, clientAddress, alias string) {
+	client.send(t.addAlias(clientAddress, alias))
+}
+
+func (t *TorrentServer) handleUnaliasCommand(client *Client, clientAddress, alias string) {
+	client.send(t.removeAlias(clientAddress, alias))
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenameMovesGroupsAndScopes(t *testing.T) {
+	var tests = []struct {
+		name            string
+		otherDevice     bool
+		expectedSharing string
+	}{
+		{"last device of the user", false, "alicia"},
+		{"another device keeps the username", true, "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createTestServer(t)
+			alice, _ := connectTestClient(t, server, "127.0.0.1:4000")
+			bob, _ := connectTestClient(t, server, "127.0.0.1:4001")
+			server.dispatch(alice, "127.0.0.1:4000", splitCommand("register-device laptop"))
+			server.dispatch(alice, "127.0.0.1:4000", splitCommand(`register alice "/a"`))
+			server.dispatch(bob, "127.0.0.1:4001", splitCommand(`register bob users:alice "/b"`))
+			server.dispatch(alice, "127.0.0.1:4000", splitCommand("group-add team bob"))
+			server.dispatch(bob, "127.0.0.1:4001", splitCommand("group-add friends alice"))
+			if tt.otherDevice {
+				phone, _ := connectTestClient(t, server, "127.0.0.1:4002")
+				server.dispatch(phone, "127.0.0.1:4002", splitCommand("register-device phone"))
+				server.dispatch(phone, "127.0.0.1:4002", splitCommand(`register alice "/c"`))
+			}
+
+			server.dispatch(alice, "127.0.0.1:4000", splitCommand("rename alicia"))
+
+			if _, registered := server.files["alicia@laptop"]; !registered {
+				t.Fatal("expected the files to be renamed")
+			}
+			if users := sortedKeys(server.files["bob"]["/b"].scope.users); !reflect.DeepEqual(users, []string{tt.expectedSharing}) {
+				t.Errorf("expected the file of bob to be shared with %s, got %v", tt.expectedSharing, users)
+			}
+			if owner := server.groups["team"].owner; owner != tt.expectedSharing {
+				t.Errorf("expected the group to be owned by %s, got %s", tt.expectedSharing, owner)
+			}
+			if members := sortedKeys(server.groups["friends"].members); !reflect.DeepEqual(members, []string{tt.expectedSharing, "bob"}) {
+				t.Errorf("expected %s and bob to be members of the group of bob, got %v", tt.expectedSharing, members)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiredLeasesAreReaped(t *testing.T) {
+	server := createTestServer(t, func(config *Config) { config.LeaseDuration = 100 * time.Millisecond })
+
+	silent, silentConn := connectTestClient(t, server, "127.0.0.1:4000")
+	active, activeConn := connectTestClient(t, server, "127.0.0.1:4001")
+	server.dispatch(silent, "127.0.0.1:4000", splitCommand("register bob \"/a\""))
+	server.dispatch(active, "127.0.0.1:4001", splitCommand("register alice \"/b\""))
+
+	time.Sleep(60 * time.Millisecond)
+	if !server.renewLease("127.0.0.1:4001") {
+		t.Fatal("expected the active client to be connected")
+	}
+	time.Sleep(60 * time.Millisecond)
+	server.expireLeases()
+
+	if _, connected := server.clientAt("127.0.0.1:4000"); connected || !silentConn.closed {
+		t.Error("expected the silent client to be disconnected")
+	}
+	if _, registered := server.files["bob"]; registered {
+		t.Error("expected the files of the silent client to be unregistered")
+	}
+	if _, used := server.usedUsernames["bob"]; used {
+		t.Error("expected the username of the silent client to be free")
+	}
+
+	if _, connected := server.clientAt("127.0.0.1:4001"); !connected || activeConn.closed {
+		t.Error("expected the client that renewed its lease to stay connected")
+	}
+	if _, registered := server.files["alice"]; !registered {
+		t.Error("expected the files of the active client to stay registered")
+	}
+}
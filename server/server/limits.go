@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errTooManyFiles = errors.New("too many files")
+
+// rateLimiter is a token bucket that allows "rate" commands per second on average and bursts of up to "burst" commands
+type rateLimiter struct {
+	tokens float64
+	last   time.Time
+}
+
+func createRateLimiter(burst int) *rateLimiter {
+	return &rateLimiter{
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow is a function that returns whether one more command can be executed now and takes a token for it if so.
+// A non-positive "rate" disables the limit.
+func (r *rateLimiter) allow(rate float64, burst int, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+
+	r.tokens += now.Sub(r.last).Seconds() * rate
+	if r.tokens > float64(burst) {
+		r.tokens = float64(burst)
+	}
+	r.last = now
+
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// readLimitedLine is a function that:
+//    - accepts:
+//         - reader - the reader over the connection to a client
+//         - limit  - the most bytes a line may have including the new line, non-positive for no limit
+//    - reads a whole line from "reader"
+//    - returns the line and whether it was longer than "limit", in which case only its beginning is returned and the rest is skipped
+//    (***) Returns error if the connection cannot be read
+func readLimitedLine(reader *bufio.Reader, limit int) (string, bool, error) {
+	line := make([]byte, 0)
+	tooLong := false
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			if limit > 0 && len(line) > limit {
+				line = line[:limit]
+				tooLong = true
+			}
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return string(line), tooLong, err
+	}
+}
+
+// countFilesAfterRegistering is a function that returns how many files "username" would have after registering "files".
+// It has to be called while "filesMutex" is held.
+func (t *TorrentServer) countFilesAfterRegistering(username string, files []string) int {
+	count := len(t.files[username])
+	for _, file := range files {
+		if _, ok := t.files[username][file]; !ok {
+			count++
+		}
+	}
+	return count
+}
+
+// recordViolation is a function that counts a violation of the limits by the client with "clientAddress".
+// The address of the client is banned for a while and the client is disconnected once it has too many violations,
+// in which case it returns true.
+func (t *TorrentServer) recordViolation(clientAddress, reason string) bool {
+	t.metrics.errors.WithLabel(reason).Inc()
+	config := t.getConfig()
+
+	t.clientsMutex.Lock()
+	violations := 0
+	if client, ok := t.clients[clientAddress]; ok {
+		client.violations++
+		violations = client.violations
+	}
+	t.clientsMutex.Unlock()
+
+	t.logger.Warn("Client violated a limit", "component", "limits", "client", clientAddress, "reason", reason, "violations", violations)
+
+	if config.ViolationsBeforeBan <= 0 || violations < config.ViolationsBeforeBan {
+		return false
+	}
+
+	host := hostOf(clientAddress)
+	t.banTemporarily(host, config.TemporaryBanDuration)
+	t.logger.Warn("Temporarily banned address", "component", "limits", "ip", host, "duration", config.TemporaryBanDuration)
+
+	if client, ok := t.clientAt(clientAddress); ok {
+		client.send(fmt.Sprintf("%stoo many violations, you are banned for %s", errorPrefix, config.TemporaryBanDuration))
+	}
+	t.closeConnectionOf(clientAddress)
+	return true
+}
+
+func (t *TorrentServer) clientAt(clientAddress string) (*Client, bool) {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	client, ok := t.clients[clientAddress]
+	return client, ok
+}
+
+func (t *TorrentServer) banTemporarily(host string, duration time.Duration) {
+	t.bansMutex.Lock()
+	defer t.bansMutex.Unlock()
+
+	t.temporarilyBannedIPs[host] = time.Now().Add(duration)
+}
+
+// activeTemporaryBans is a function that returns the temporarily banned IPs and when their bans end, forgetting the expired bans
+func (t *TorrentServer) activeTemporaryBans() map[string]time.Time {
+	t.bansMutex.Lock()
+	defer t.bansMutex.Unlock()
+
+	now := time.Now()
+	active := make(map[string]time.Time)
+	for host, until := range t.temporarilyBannedIPs {
+		if now.Before(until) {
+			active[host] = until
+		} else {
+			delete(t.temporarilyBannedIPs, host)
+		}
+	}
+	return active
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadLimitedLine(t *testing.T) {
+	var tests = []struct {
+		name            string
+		input           string
+		limit           int
+		expectedLine    string
+		expectedTooLong bool
+	}{
+		{"short line", "ping\nlist-files\n", 16, "ping\n", false},
+		{"line of exactly the limit", "ping\n", 5, "ping\n", false},
+		{"over-long line", "register bob \"/a\"\nping\n", 8, "register", true},
+		{"line longer than the buffer", strings.Repeat("a", 10000) + "\nping\n", 32, strings.Repeat("a", 32), true},
+		{"no limit", strings.Repeat("a", 10000) + "\n", 0, strings.Repeat("a", 10000) + "\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReaderSize(strings.NewReader(tt.input), 16)
+
+			line, tooLong, err := readLimitedLine(reader, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line != tt.expectedLine || tooLong != tt.expectedTooLong {
+				t.Errorf("got %q and too long %t, want %q and %t", line, tooLong, tt.expectedLine, tt.expectedTooLong)
+			}
+
+			// the rest of an over-long line is skipped, so the next command is read whole
+			if next, _, err := readLimitedLine(reader, tt.limit); err == nil && next != "ping\n" && next != "list-files\n" {
+				t.Errorf("expected the next command to be read, got %q", next)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllowsBurstsAndRefills(t *testing.T) {
+	start := time.Now()
+	limiter := &rateLimiter{tokens: 3, last: start}
+
+	for i := 0; i < 3; i++ {
+		if !limiter.allow(2, 3, start) {
+			t.Fatalf("expected command %d of the burst to be allowed", i+1)
+		}
+	}
+	if limiter.allow(2, 3, start) {
+		t.Error("expected the command after the burst to be limited")
+	}
+
+	if !limiter.allow(2, 3, start.Add(500*time.Millisecond)) {
+		t.Error("expected a command to be allowed after a token was refilled")
+	}
+	if limiter.allow(2, 3, start.Add(500*time.Millisecond)) {
+		t.Error("expected only one token to be refilled")
+	}
+
+	// a long pause refills no more than a burst
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !limiter.allow(2, 3, later) {
+			t.Fatalf("expected command %d of the refilled burst to be allowed", i+1)
+		}
+	}
+	if limiter.allow(2, 3, later) {
+		t.Error("expected the refilled tokens to be capped at the burst")
+	}
+
+	if !(&rateLimiter{}).allow(0, 0, start) {
+		t.Error("expected a non-positive rate to disable the limit")
+	}
+}
+
+func TestTemporaryBanExpires(t *testing.T) {
+	server := createTestServer(t, func(config *Config) {
+		config.ViolationsBeforeBan = 2
+		config.TemporaryBanDuration = 100 * time.Millisecond
+	})
+
+	_, conn := connectTestClient(t, server, "127.0.0.1:4000")
+
+	if server.recordViolation("127.0.0.1:4000", "rate_limited") {
+		t.Fatal("expected the first violation to be tolerated")
+	}
+	if !server.recordViolation("127.0.0.1:4000", "rate_limited") {
+		t.Fatal("expected the second violation to disconnect the client")
+	}
+	if replies := conn.replies(); !strings.HasPrefix(replies[len(replies)-1], errorPrefix+"too many violations") || !conn.closed {
+		t.Errorf("expected the client to be told about the ban and disconnected, got %q", replies)
+	}
+
+	if !server.isAddressBanned("127.0.0.1:5000") {
+		t.Error("expected every connection from the address to be banned")
+	}
+	if server.isAddressBanned("127.0.0.2:4000") {
+		t.Error("expected other addresses to stay allowed")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if server.isAddressBanned("127.0.0.1:5000") {
+		t.Error("expected the ban to expire")
+	}
+	if bans := server.activeTemporaryBans(); len(bans) != 0 {
+		t.Errorf("expected the expired ban to be forgotten, got %v", bans)
+	}
+}
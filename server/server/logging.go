@@ -0,0 +1,32 @@
+package server
+
+import (
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+func createLogger(config *Config) (*logging.Logger, error) {
+	level, err := logging.ParseLevel(config.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := logging.ParseFormat(config.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := logging.OpenSink(config.LogFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return logging.CreateLogger(sink, level, format), nil
+}
+
+func toPaths(files []string) []logging.Path {
+	paths := make([]logging.Path, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, logging.Path(file))
+	}
+	return paths
+}
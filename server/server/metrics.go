@@ -0,0 +1,68 @@
+package server
+
+import (
+	"github.com/imaikeru/peer-to-peer/server/metrics"
+)
+
+const unknownCommand = "unknown"
+
+// serverMetrics is a struct that contains:
+//     - registry       - the registry all metrics of the server are exposed from
+//     - commands       - the number of received commands by type
+//     - errors         - the number of errors by kind
+//     - commandLatency - how long handling a command takes by type
+//     - relayedBytes   - the number of bytes relayed between clients
+type serverMetrics struct {
+	registry       *metrics.Registry
+	commands       *metrics.CounterVec
+	errors         *metrics.CounterVec
+	commandLatency *metrics.HistogramVec
+	relayedBytes   *metrics.Counter
+}
+
+func (t *TorrentServer) countConnectedClients() float64 {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	return float64(len(t.clients))
+}
+
+func (t *TorrentServer) countRegisteredFiles() float64 {
+	t.filesMutex.RLock()
+	defer t.filesMutex.RUnlock()
+
+	files := 0
+	for _, filePaths := range t.files {
+		files += len(filePaths)
+	}
+	return float64(files)
+}
+
+func createServerMetrics(t *TorrentServer) *serverMetrics {
+	registry := metrics.CreateRegistry()
+
+	registry.NewGaugeFunc("p2p_tracker_connected_clients", "Number of clients connected to the tracker.", t.countConnectedClients)
+	registry.NewGaugeFunc("p2p_tracker_registered_files", "Number of files registered in the tracker.", t.countRegisteredFiles)
+	registry.NewGaugeFunc("p2p_tracker_swarm_peers", "Number of BitTorrent peers announced to the HTTP tracker.", func() float64 {
+		return float64(t.swarms.PeerCount())
+	})
+	registry.NewGaugeFunc("p2p_tracker_relayed_transfers", "Number of transfers relayed at the moment.", func() float64 {
+		t.relaysMutex.Lock()
+		defer t.relaysMutex.Unlock()
+		return float64(t.activeRelays)
+	})
+	registry.NewGaugeFunc("p2p_tracker_cluster_primary", "Whether the tracker is the primary of its cluster, 1 for servers that run alone.", func() float64 {
+		if t.isStandby() {
+			return 0
+		}
+		return 1
+	})
+
+	return &serverMetrics{
+		registry:       registry,
+		commands:       registry.NewCounterVec("p2p_tracker_commands_total", "Number of commands received by the tracker.", "command"),
+		errors:         registry.NewCounterVec("p2p_tracker_errors_total", "Number of errors encountered by the tracker.", "kind"),
+		commandLatency: registry.NewHistogramVec("p2p_tracker_command_duration_seconds", "Time spent handling a command.", "command", metrics.DefaultLatencyBuckets),
+		relayedBytes:   registry.NewCounter("p2p_tracker_relayed_bytes_total", "Number of bytes relayed between clients."),
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	healthRequest  = "health"
+	healthResponse = "healthy"
+
+	reachabilityUnknown = "unknown"
+	reachable           = "reachable"
+	unreachable         = "unreachable"
+)
+
+// probeMiniServer is a function that:
+//    - connects to the mini server on "miniServerAddress" and sends it a health request
+//    - returns:
+//         - true  - if the mini server answered with a health response within "timeout"
+//         - false - otherwise
+func probeMiniServer(miniServerAddress string, timeout time.Duration) bool {
+	conn, err := net.DialTimeout(protocol, miniServerAddress, timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write([]byte(healthRequest + "\n")); err != nil {
+		return false
+	}
+
+	response, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(response) == healthResponse
+}
+
+func (t *TorrentServer) setReachability(clientAddress, miniServerAddress, reachability string) {
+	t.clientsMutex.Lock()
+	defer t.clientsMutex.Unlock()
+
+	if client, ok := t.clients[clientAddress]; ok && client.miniServerAddress == miniServerAddress {
+		client.reachability = reachability
+	}
+}
+
+// probeAddress is a function that returns where the mini server a client at "clientAddress" reported as "miniServerAddress" is probed:
+// on the port the client reported, but at the IP the client is connected from,
+// so that a client cannot make the server probe another host or the server itself
+func probeAddress(clientAddress, miniServerAddress string) string {
+	_, port, err := net.SplitHostPort(miniServerAddress)
+	if err != nil {
+		return miniServerAddress
+	}
+	return net.JoinHostPort(hostOf(clientAddress), port)
+}
+
+func (t *TorrentServer) probeClient(clientAddress, miniServerAddress string) {
+	reachability := unreachable
+	if probeMiniServer(probeAddress(clientAddress, miniServerAddress), t.getConfig().ProbeTimeout) {
+		reachability = reachable
+	}
+
+	t.setReachability(clientAddress, miniServerAddress, reachability)
+}
+
+func (t *TorrentServer) collectMiniServerAddresses() map[string]string {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	miniServerAddresses := make(map[string]string)
+	for clientAddress, client := range t.clients {
+		if client.miniServerAddress != "" {
+			miniServerAddresses[clientAddress] = client.miniServerAddress
+		}
+	}
+
+	return miniServerAddresses
+}
+
+func (t *TorrentServer) reachabilityOfUsers() map[string]string {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	reachabilities := make(map[string]string)
+	for _, client := range t.clients {
+		for _, name := range client.names() {
+			reachabilities[name] = client.reachability
+		}
+	}
+
+	return reachabilities
+}
+
+func (t *TorrentServer) probeMiniServersPeriodically() {
+	for {
+		time.Sleep(t.getConfig().ProbeInterval)
+		for clientAddress, miniServerAddress := range t.collectMiniServerAddresses() {
+			go t.probeClient(clientAddress, miniServerAddress)
+		}
+	}
+}
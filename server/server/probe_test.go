@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProbeAddress(t *testing.T) {
+	var tests = []struct {
+		name              string
+		clientAddress     string
+		miniServerAddress string
+		expected          string
+	}{
+		{"reported as connected", "10.0.0.5:40000", "10.0.0.5:9000", "10.0.0.5:9000"},
+		{"reported loopback", "10.0.0.5:40000", "127.0.0.1:9000", "10.0.0.5:9000"},
+		{"reported another host", "10.0.0.5:40000", "192.168.1.20:9000", "10.0.0.5:9000"},
+		{"connected over IPv6", "[2001:db8::5]:40000", "127.0.0.1:9000", "[2001:db8::5]:9000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := probeAddress(tt.clientAddress, tt.miniServerAddress); got != tt.expected {
+				t.Errorf("got %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+// serveHealth is a function that answers health requests on a free port of the loopback interface and returns the port
+func serveHealth(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen(protocol, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if line, err := bufio.NewReader(conn).ReadString('\n'); err == nil && line == healthRequest+"\n" {
+				conn.Write([]byte(healthResponse + "\n"))
+			}
+			conn.Close()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+func TestProbeClientProbesTheConnectedHost(t *testing.T) {
+	port := serveHealth(t)
+
+	var tests = []struct {
+		name              string
+		clientAddress     string
+		miniServerAddress string
+		expected          string
+	}{
+		{"mini server on the connected host", "127.0.0.1:4000", "10.255.255.1:" + port, reachable},
+		{"mini server only on another host", "127.0.0.2:4000", "127.0.0.1:" + port, unreachable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createTestServer(t, func(config *Config) { config.ProbeTimeout = time.Second })
+
+			client, _ := connectTestClient(t, server, tt.clientAddress)
+			server.registerMiniServer(tt.clientAddress, tt.miniServerAddress)
+
+			server.probeClient(tt.clientAddress, tt.miniServerAddress)
+
+			server.clientsMutex.RLock()
+			defer server.clientsMutex.RUnlock()
+			if client.reachability != tt.expected {
+				t.Errorf("got %s, want %s", client.reachability, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import "regexp"
+
+const (
+	pushRequestPrefix = "push-request "
+	pushReadyPrefix   = "push-ready "
+	pushRefusedPrefix = "push-refused "
+)
+
+var pushTokenRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// handlePushCommand is a function that answers a client that could not connect to the mini server at "miniServerAddress".
+// The holder of the mini server is asked to connect to the mini server of the client instead and to push the file over that connection.
+// The client chooses "token", so that it can tell the connection of the holder apart from other ones.
+func (t *TorrentServer) handlePushCommand(client *Client, clientAddress, miniServerAddress, token string) {
+	refuse := func(reason string) {
+		client.send(pushRefusedPrefix + miniServerAddress + " " + reason)
+	}
+
+	requesterMiniServer := t.miniServerAddressOf(client)
+	if requesterMiniServer == "" {
+		refuse("register your mini server first")
+		return
+	}
+	holder, ok := t.clientWithMiniServer(miniServerAddress)
+	if !ok {
+		refuse("nobody with this mini server is connected")
+		return
+	}
+
+	if err := holder.send(pushRequestPrefix + requesterMiniServer + " " + token); err != nil {
+		refuse("the holder could not be asked to connect")
+		return
+	}
+	client.send(pushReadyPrefix + miniServerAddress)
+	t.logger.Info("Asked holder to push", "component", "push", "client", clientAddress, "mini_server", miniServerAddress)
+}
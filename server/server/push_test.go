@@ -0,0 +1,41 @@
+package server
+
+import "testing"
+
+func TestPushCommand(t *testing.T) {
+	var tests = []struct {
+		name               string
+		requesterMini      string
+		miniServer         string
+		expectedRequester  string
+		expectedHolderPush bool
+	}{
+		{"pushed", "127.0.0.1:9001", "127.0.0.1:9000", pushReadyPrefix + "127.0.0.1:9000", true},
+		{"requester without a mini server", "", "127.0.0.1:9000", pushRefusedPrefix + "127.0.0.1:9000 register your mini server first", false},
+		{"unknown mini server", "127.0.0.1:9001", "127.0.0.1:9002", pushRefusedPrefix + "127.0.0.1:9002 nobody with this mini server is connected", false},
+	}
+
+	token := "0123456789abcdef0123456789abcdef"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createTestServer(t)
+			holder, holderConn := connectTestClient(t, server, "127.0.0.1:4000")
+			requester, requesterConn := connectTestClient(t, server, "127.0.0.1:4001")
+			server.dispatch(holder, "127.0.0.1:4000", splitCommand("register-miniserver 127.0.0.1:9000"))
+			if tt.requesterMini != "" {
+				server.dispatch(requester, "127.0.0.1:4001", splitCommand("register-miniserver "+tt.requesterMini))
+			}
+
+			server.dispatch(requester, "127.0.0.1:4001", splitCommand("push "+tt.miniServer+" "+token))
+
+			replies := requesterConn.replies()
+			if replies[len(replies)-1] != tt.expectedRequester {
+				t.Errorf("got %q, want %q", replies[len(replies)-1], tt.expectedRequester)
+			}
+			holderReplies := holderConn.replies()
+			if pushed := holderReplies[len(holderReplies)-1] == pushRequestPrefix+tt.requesterMini+" "+token; pushed != tt.expectedHolderPush {
+				t.Errorf("expected the holder to be asked to push %t, got %q", tt.expectedHolderPush, holderReplies)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	relayRequestPrefix = "relay-request "
+	relayReadyPrefix   = "relay-ready "
+	relayRefusedPrefix = "relay-refused "
+	relayJoinPrefix    = "relay "
+
+	// how long the two clients have to join a relayed transfer
+	relayJoinTimeout = 30 * time.Second
+	relayTokenLength = 16
+	relayBufferSize  = 32 * 1024
+)
+
+var errTooManyRelays = errors.New("too many transfers are relayed at the moment")
+
+// relayEnd is a struct that contains:
+//    - conn   - the connection of a client to the relay
+//    - reader - a buffered reader over "conn", which may hold data the client sent right after joining
+type relayEnd struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// clientWithMiniServer is a function that returns the connected client whose mini server is at "miniServerAddress"
+func (t *TorrentServer) clientWithMiniServer(miniServerAddress string) (*Client, bool) {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	for _, client := range t.clients {
+		if client.miniServerAddress == miniServerAddress {
+			return client, true
+		}
+	}
+	return nil, false
+}
+
+// miniServerAddressOf is a function that returns the address of the mini server "client" registered, empty if it has not registered one
+func (t *TorrentServer) miniServerAddressOf(client *Client) string {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	return client.miniServerAddress
+}
+
+// createRelay is a function that returns a new token, with which two clients can join a relayed transfer within "relayJoinTimeout"
+//    (***) Returns error if "maxTransfers" transfers are already relayed or waiting for their clients
+func (t *TorrentServer) createRelay(maxTransfers int) (string, error) {
+	random := make([]byte, relayTokenLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("Could not generate relay token. %w", err)
+	}
+	token := hex.EncodeToString(random)
+
+	t.relaysMutex.Lock()
+	defer t.relaysMutex.Unlock()
+
+	if maxTransfers > 0 && len(t.relays)+t.activeRelays >= maxTransfers {
+		return "", errTooManyRelays
+	}
+	t.relays[token] = nil
+	time.AfterFunc(relayJoinTimeout, func() { t.expireRelay(token) })
+
+	return token, nil
+}
+
+// expireRelay is a function that forgets "token" and closes the connection of the client that is waiting for the other one
+func (t *TorrentServer) expireRelay(token string) {
+	t.relaysMutex.Lock()
+	waiting, ok := t.relays[token]
+	delete(t.relays, token)
+	t.relaysMutex.Unlock()
+
+	if ok && waiting != nil {
+		waiting.conn.Close()
+	}
+}
+
+// handleRelayCommand is a function that answers a client that could not connect to the mini server at "miniServerAddress".
+// The holder of the mini server is asked to join the relay with a new token and the requester receives the same token.
+func (t *TorrentServer) handleRelayCommand(client *Client, clientAddress, miniServerAddress string) {
+	config := t.getConfig()
+	refuse := func(reason string) {
+		client.send(relayRefusedPrefix + miniServerAddress + " " + reason)
+	}
+
+	if config.RelayAddress == "" {
+		refuse("relaying is disabled")
+		return
+	}
+	holder, ok := t.clientWithMiniServer(miniServerAddress)
+	if !ok {
+		refuse("nobody with this mini server is connected")
+		return
+	}
+
+	token, err := t.createRelay(config.RelayMaxTransfers)
+	if err != nil {
+		t.metrics.errors.WithLabel("relay_limit").Inc()
+		refuse(err.Error())
+		return
+	}
+
+	_, port, _ := net.SplitHostPort(config.RelayAddress)
+	if err := holder.send(relayRequestPrefix + token + " " + port); err != nil {
+		t.expireRelay(token)
+		refuse("the holder could not be asked to join")
+		return
+	}
+	client.send(relayReadyPrefix + miniServerAddress + " " + token + " " + port)
+	t.logger.Info("Relaying transfer", "component", "relay", "client", clientAddress, "mini_server", miniServerAddress)
+}
+
+// serveRelays is a function that accepts the connections of clients that join relayed transfers on "address"
+//    (***) Returns error if the address cannot be listened on
+func (t *TorrentServer) serveRelays(address string) error {
+	listener, err := net.Listen(protocol, address)
+	if err != nil {
+		return fmt.Errorf("Error starting relay on %s. %w", address, err)
+	}
+	defer listener.Close()
+
+	t.logger.Info("Relaying transfers", "component", "relay", "address", address)
+	for {
+		if conn, err := listener.Accept(); err != nil {
+			t.metrics.errors.WithLabel("accept").Inc()
+			t.logger.Error("Error accepting relay connection", "component", "relay", "error", err)
+		} else {
+			go t.handleRelayConnection(conn)
+		}
+	}
+}
+
+// handleRelayConnection is a function that reads the token of a client joining a relayed transfer like
+// relay <token>
+// and connects it to the other client once both have joined
+func (t *TorrentServer) handleRelayConnection(conn net.Conn) {
+	reader := bufio.NewReaderSize(conn, relayBufferSize)
+	conn.SetReadDeadline(time.Now().Add(relayJoinTimeout))
+	line, err := reader.ReadString('\n')
+	conn.SetReadDeadline(time.Time{})
+	if err != nil || !strings.HasPrefix(line, relayJoinPrefix) {
+		conn.Close()
+		return
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(line, relayJoinPrefix))
+	joined := &relayEnd{conn: conn, reader: reader}
+
+	t.relaysMutex.Lock()
+	waiting, ok := t.relays[token]
+	if !ok {
+		t.relaysMutex.Unlock()
+		conn.Write([]byte(errorPrefix + "unknown relay token" + "\n"))
+		conn.Close()
+		return
+	}
+	if waiting == nil {
+		t.relays[token] = joined
+		t.relaysMutex.Unlock()
+		return
+	}
+	delete(t.relays, token)
+	t.activeRelays++
+	t.relaysMutex.Unlock()
+
+	started := time.Now()
+	sent, received := t.splice(waiting, joined)
+	t.logger.Info("Relayed transfer", "component", "relay", "bytes_sent", sent, "bytes_received", received, "duration", time.Since(started).Round(time.Millisecond))
+
+	t.relaysMutex.Lock()
+	t.activeRelays--
+	t.relaysMutex.Unlock()
+}
+
+// splice is a function that copies what each client sends to the other until one of them closes its connection
+// and returns how many bytes each of them sent
+func (t *TorrentServer) splice(first, second *relayEnd) (int64, int64) {
+	rate := t.getConfig().RelayRate
+
+	var fromFirst, fromSecond int64
+	done := make(chan struct{}, 2)
+	go func() {
+		fromFirst = t.relayCopy(second.conn, first.reader, rate)
+		done <- struct{}{}
+	}()
+	go func() {
+		fromSecond = t.relayCopy(first.conn, second.reader, rate)
+		done <- struct{}{}
+	}()
+
+	<-done
+	first.conn.Close()
+	second.conn.Close()
+	<-done
+
+	return fromFirst, fromSecond
+}
+
+// relayCopy is a function that copies "src" to "dst" at most "rate" bytes per second(0 for no limit)
+// and returns how many bytes were copied
+func (t *TorrentServer) relayCopy(dst io.Writer, src io.Reader, rate int) int64 {
+	buffer := make([]byte, relayBufferSize)
+	started := time.Now()
+
+	var copied int64
+	for {
+		read, err := src.Read(buffer)
+		if read > 0 {
+			if _, writeErr := dst.Write(buffer[:read]); writeErr != nil {
+				return copied
+			}
+			copied += int64(read)
+			t.metrics.relayedBytes.Add(uint64(read))
+
+			if rate > 0 {
+				if wait := time.Duration(float64(copied)/float64(rate)*float64(time.Second)) - time.Since(started); wait > 0 {
+					time.Sleep(wait)
+				}
+			}
+		}
+		if err != nil {
+			return copied
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+// joinTestRelay is a function that joins the relayed transfer with "token" over a pipe and returns the end of the client
+func joinTestRelay(t *testing.T, server *TorrentServer, token string) net.Conn {
+	t.Helper()
+
+	clientEnd, serverEnd := net.Pipe()
+	go server.handleRelayConnection(serverEnd)
+	if _, err := clientEnd.Write([]byte(relayJoinPrefix + token + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	return clientEnd
+}
+
+func TestRelayRoundTrip(t *testing.T) {
+	server := createTestServer(t, func(config *Config) { config.RelayAddress = "127.0.0.1:13342" })
+
+	holder, holderConn := connectTestClient(t, server, "127.0.0.1:4000")
+	requester, requesterConn := connectTestClient(t, server, "127.0.0.1:4001")
+	server.dispatch(holder, "127.0.0.1:4000", splitCommand("register-miniserver 127.0.0.1:9000"))
+
+	server.dispatch(requester, "127.0.0.1:4001", splitCommand("relay 127.0.0.1:9000"))
+
+	request := strings.Fields(strings.TrimPrefix(holderConn.replies()[1], relayRequestPrefix))
+	ready := strings.Fields(strings.TrimPrefix(requesterConn.replies()[0], relayReadyPrefix))
+	if len(request) != 2 || len(ready) != 3 || ready[0] != "127.0.0.1:9000" || request[0] != ready[1] || request[1] != "13342" || ready[2] != "13342" {
+		t.Fatalf("expected both clients to get the same token and the relay port, got %q and %q", holderConn.replies(), requesterConn.replies())
+	}
+
+	holderEnd := joinTestRelay(t, server, request[0])
+	requesterEnd := joinTestRelay(t, server, ready[1])
+
+	go requesterEnd.Write([]byte("download \"/a\"\n"))
+	if line, err := bufio.NewReader(holderEnd).ReadString('\n'); err != nil || line != "download \"/a\"\n" {
+		t.Fatalf("expected the holder to receive the request, got %q and %v", line, err)
+	}
+
+	go func() {
+		holderEnd.Write([]byte("the content"))
+		holderEnd.Close()
+	}()
+	if received, err := ioutil.ReadAll(requesterEnd); err != nil || string(received) != "the content" {
+		t.Errorf("expected the requester to receive the file until the holder closed the connection, got %q and %v", received, err)
+	}
+}
+
+func TestRelayRefusals(t *testing.T) {
+	var tests = []struct {
+		name         string
+		relayAddress string
+		miniServer   string
+		expected     string
+	}{
+		{"relaying disabled", "", "127.0.0.1:9000", "relaying is disabled"},
+		{"unknown mini server", "127.0.0.1:13342", "127.0.0.1:9001", "nobody with this mini server is connected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createTestServer(t, func(config *Config) { config.RelayAddress = tt.relayAddress })
+
+			holder, _ := connectTestClient(t, server, "127.0.0.1:4000")
+			requester, requesterConn := connectTestClient(t, server, "127.0.0.1:4001")
+			server.dispatch(holder, "127.0.0.1:4000", splitCommand("register-miniserver 127.0.0.1:9000"))
+
+			server.dispatch(requester, "127.0.0.1:4001", splitCommand("relay "+tt.miniServer))
+
+			if expected := relayRefusedPrefix + tt.miniServer + " " + tt.expected; requesterConn.replies()[0] != expected {
+				t.Errorf("got %q, want %q", requesterConn.replies()[0], expected)
+			}
+		})
+	}
+}
+
+func TestRelayRefusesUnknownTokens(t *testing.T) {
+	server := createTestServer(t)
+
+	end := joinTestRelay(t, server, strings.Repeat("ab", relayTokenLength))
+	if line, _ := bufio.NewReader(end).ReadString('\n'); line != errorPrefix+"unknown relay token\n" {
+		t.Errorf("got %q, want the token to be refused", line)
+	}
+}
@@ -2,11 +2,19 @@ package server
 
 import (
 	"bufio"
+	"crypto/ed25519"
 	"fmt"
-	"log"
+	"io"
 	"net"
+	"os"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/server/announce"
+	"github.com/imaikeru/peer-to-peer/server/cluster"
+	"github.com/imaikeru/peer-to-peer/server/federation"
+	"github.com/imaikeru/peer-to-peer/shared/logging"
 )
 
 const (
@@ -15,25 +23,76 @@ const (
 	commandIndex           = 0
 	userIndex              = 1
 	miniServerAddressIndex = 1
+	pushTokenIndex         = 2
 	filesStartIndex        = 2
+	deviceIndex            = 1
+	locatedFileIndex       = 2
+	searchTermIndex        = 1
 )
 
 // TorrentServer is a struct that contains:
-//     - port                - the port on which the server listens
-//     - usedUsernames       - a map whose keys are usernames(strings) that are already being used and values are the addresses of the clients that ue them(*strings)
-//     - usedUsernamesMutex  - a Mutex that is used for working safely with "usedUsernames"
-//     - clients             - a map whose keys are user addresses(string) and values are pointers to Client struct
-//     - clientsMutex        - a Mutex that is used for working safely with "clients"
-//     - files               - a map whose keys are usernames(strings) and values are file paths(strings)
-//     - filesMutex          - a Mutex that is used for working safely with "files"
+//     - port                 - the port on which the server listens
+//     - config               - the settings of the server
+//     - configPath           - path to the JSON config file the settings are reloaded from, empty if there is none
+//     - configMutex          - a Mutex that is used for working safely with "config"
+//     - startTime            - the moment the server was created
+//     - usedUsernames        - a map whose keys are usernames(strings) that are already being used and values are the addresses of the clients that ue them(*strings)
+//     - usedUsernamesMutex   - a Mutex that is used for working safely with "usedUsernames"
+//     - clients              - a map whose keys are user addresses(string) and values are pointers to Client struct
+//     - clientsMutex         - a Mutex that is used for working safely with "clients"
+//     - files                - a map whose keys are usernames(strings) and values are maps from file paths(strings) to information about the files
+//     - filesMutex           - a Mutex that is used for working safely with "files"
+//     - bannedUsernames      - a set of usernames that are not allowed to register files
+//     - bannedIPs            - a set of IP addresses whose connections are refused
+//     - temporarilyBannedIPs - a map whose keys are IP addresses that violated the limits too many times and values are when their bans end
+//     - bansMutex            - a Mutex that is used for working safely with "bannedUsernames", "bannedIPs" and "temporarilyBannedIPs"
+//     - metrics              - the metrics the server exposes
+//     - logger               - the structured logger of the server
+//     - commands             - a map whose keys are command names and values are the commands clients can send
+//     - ticketKey            - the private key that download tickets are signed with
+//     - groups               - a map whose keys are group names and values are the sharing groups
+//     - groupsMutex          - a Mutex that is used for working safely with "groups"
+//     - swarms               - the BitTorrent HTTP tracker, which maps info hashes to the BitTorrent clients that share them
+//     - federation           - the other servers the index is replicated with, nil if the server is not federated
+//     - cluster              - the primary/standby cluster the server belongs to, nil if it runs alone
+//     - relays               - a map whose keys are tokens of relayed transfers and values are the clients that joined first, nil until one joins
+//     - activeRelays         - how many transfers are relayed at the moment
+//     - relaysMutex          - a Mutex that is used for working safely with "relays" and "activeRelays"
 type TorrentServer struct {
-	port               string
-	usedUsernames      map[string]*string
-	usedUsernamesMutex sync.RWMutex
-	clients            map[string]*Client
-	clientsMutex       sync.RWMutex
-	files              map[string]map[string]struct{}
-	filesMutex         sync.RWMutex
+	port                 string
+	config               *Config
+	configPath           string
+	configMutex          sync.RWMutex
+	startTime            time.Time
+	usedUsernames        map[string]*string
+	usedUsernamesMutex   sync.RWMutex
+	clients              map[string]*Client
+	clientsMutex         sync.RWMutex
+	files                map[string]map[string]*fileInfo
+	filesMutex           sync.RWMutex
+	bannedUsernames      map[string]struct{}
+	bannedIPs            map[string]struct{}
+	temporarilyBannedIPs map[string]time.Time
+	bansMutex            sync.RWMutex
+	metrics              *serverMetrics
+	logger               *logging.Logger
+	commands             map[string]*command
+	ticketKey            ed25519.PrivateKey
+	groups               map[string]*group
+	groupsMutex          sync.RWMutex
+	swarms               *announce.Tracker
+	federation           *federation.Federation
+	cluster              *cluster.Node
+	relays               map[string]*relayEnd
+	activeRelays         int
+	relaysMutex          sync.Mutex
+}
+
+func (t *TorrentServer) getConfig() Config {
+	t.configMutex.RLock()
+	defer t.configMutex.RUnlock()
+
+	return *t.config
 }
 
 func (t *TorrentServer) listUsersAndTheirAddresses() string {
@@ -42,29 +101,43 @@ func (t *TorrentServer) listUsersAndTheirAddresses() string {
 	sb.WriteString("list-users:")
 
 	t.clientsMutex.RLock()
-	defer t.clientsMutex.RUnlock()
-
 	for _, info := range t.clients {
-		if info.miniServerAddress != "" && info.username != "" {
-			sb.WriteString(info.username + " - " + info.miniServerAddress + ";")
+		if info.miniServerAddress != "" {
+			for _, name := range info.names() {
+				sb.WriteString(name + " (" + info.reachability + ") - " + info.miniServerAddress + ";")
+			}
 		}
 	}
+	t.clientsMutex.RUnlock()
 
+	sb.WriteString(t.listFederatedUsers())
 	return sb.String()
 }
 
-func (t *TorrentServer) listFiles() string {
+// listFiles is a function that lists the files visible to the client with "requesterAddress" whose paths contain "term",
+// including the files on the other servers of the federation, which are tagged with the name of their server
+func (t *TorrentServer) listFiles(requesterAddress, term string) string {
 	var sb strings.Builder
 
-	t.filesMutex.RLock()
-	defer t.filesMutex.RUnlock()
+	reachabilities := t.reachabilityOfUsers()
+	r := t.requesterFor(requesterAddress)
+	term = strings.ToLower(term)
 
+	t.filesMutex.RLock()
 	for username, filePaths := range t.files {
-		for filePath := range filePaths {
-			sb.WriteString(username + " : " + filePath + ";")
+		reachability, ok := reachabilities[username]
+		if !ok {
+			reachability = reachabilityUnknown
+		}
+		for filePath, info := range filePaths {
+			if r.canSee(username, info.scope) && strings.Contains(strings.ToLower(filePath), term) {
+				sb.WriteString(username + " (" + reachability + ") : " + filePath + ";")
+			}
 		}
 	}
+	t.filesMutex.RUnlock()
 
+	sb.WriteString(t.listFederatedFiles(r, term))
 	return sb.String()
 }
 
@@ -72,24 +145,29 @@ func (t *TorrentServer) checkIfUsernameIsUsedByDifferentAddressAndAddItOtherwise
 	t.usedUsernamesMutex.Lock()
 	defer t.usedUsernamesMutex.Unlock()
 
-	if user, ok := t.usedUsernames[username]; ok {
-		if *user == senderAddress {
-			return false
-		}
+	if t.isIdentityUsedByOther(senderAddress, username) {
 		return true
 	}
+	if user, ok := t.usedUsernames[username]; ok && *user == senderAddress {
+		return false
+	}
 
 	t.usedUsernames[username] = &senderAddress
 	return false
 }
 
+// validateAndUpdateUsername is a function that returns the username of the client at "senderAddress" and whether it can use "username",
+// setting "username" as its username if it has none yet. A client that is no longer connected gets an empty username and cannot use any.
 func (t *TorrentServer) validateAndUpdateUsername(senderAddress, username string) (string, bool) {
 	t.clientsMutex.Lock()
 	defer t.clientsMutex.Unlock()
 
-	client := t.clients[senderAddress]
+	client, ok := t.clients[senderAddress]
+	if !ok {
+		return "", false
+	}
 
-	if client.username != username {
+	if !client.hasName(username) {
 		if client.username == "" {
 			client.username = username
 			return client.username, true
@@ -99,6 +177,15 @@ func (t *TorrentServer) validateAndUpdateUsername(senderAddress, username string
 	return client.username, true
 }
 
+// registeredAsMessage is a function that returns the answer to a client that cannot use a username, because it has registered as "registeredAs".
+// An empty "registeredAs" means that the client is no longer connected.
+func registeredAsMessage(registeredAs string) string {
+	if registeredAs == "" {
+		return notConnectedMessage
+	}
+	return fmt.Sprintf("You have already registered as %s.", registeredAs)
+}
+
 func (t *TorrentServer) unregisterFiles(username string, files ...string) {
 	t.filesMutex.Lock()
 	defer t.filesMutex.Unlock()
@@ -110,88 +197,176 @@ func (t *TorrentServer) unregisterFiles(username string, files ...string) {
 }
 
 func (t *TorrentServer) unregisterFilesCommandHelper(senderAddress, username string, files ...string) string {
+	username = t.qualifyFor(senderAddress, username)
+
 	if registeredAs, valid := t.validateAndUpdateUsername(senderAddress, username); !valid {
-		return fmt.Sprintf("You have already registered as %s.", registeredAs)
+		return registeredAsMessage(registeredAs)
 	}
 
 	t.unregisterFiles(username, files...)
+	t.logger.Info("Unregistered files", "component", "tracker", "client", senderAddress, "user", username, "count", len(files), "files", toPaths(files))
 
 	return "Successfully unregistered files."
 }
 
-func (t *TorrentServer) handleUnregisterFilesCommand(rw *bufio.ReadWriter, senderAddress, username string, files ...string) {
-	rw.WriteString(t.unregisterFilesCommandHelper(senderAddress, username, files...) + "\n")
+func (t *TorrentServer) handleUnregisterFilesCommand(client *Client, senderAddress, username string, files ...string) {
+	client.send(t.unregisterFilesCommandHelper(senderAddress, username, files...))
 }
 
-func (t *TorrentServer) registerFiles(username string, files ...string) {
+func (t *TorrentServer) registerFiles(username string, fileScope *scope, maxFiles int, files ...string) error {
 	t.filesMutex.Lock()
 	defer t.filesMutex.Unlock()
 
+	trimmedFiles := make([]string, 0, len(files))
+	for _, fileToAdd := range files {
+		trimmedFiles = append(trimmedFiles, strings.ReplaceAll(fileToAdd, `"`, ""))
+	}
+
+	if maxFiles > 0 && t.countFilesAfterRegistering(username, trimmedFiles) > maxFiles {
+		return errTooManyFiles
+	}
+
 	if _, ok := t.files[username]; !ok {
-		t.files[username] = make(map[string]struct{})
+		t.files[username] = make(map[string]*fileInfo)
 	}
 
-	for _, fileToAdd := range files {
-		fileToAdd = strings.ReplaceAll(fileToAdd, `"`, "")
-		t.files[username][fileToAdd] = struct{}{}
+	for _, fileToAdd := range trimmedFiles {
+		t.files[username][fileToAdd] = &fileInfo{scope: fileScope}
 	}
 
+	return nil
 }
 
-func (t *TorrentServer) registerFilesCommandHelper(senderAddress, username string, files ...string) string {
+func (t *TorrentServer) registerFilesCommandHelper(senderAddress, username string, fileScope *scope, files ...string) string {
+	if t.isUsernameBanned(username) {
+		return fmt.Sprintf("The username %s is banned.", username)
+	}
+
+	username = t.qualifyFor(senderAddress, username)
+
+	if registeredAs, valid := t.canUseUsername(senderAddress, username); !valid {
+		return registeredAsMessage(registeredAs)
+	}
+
+	if origin, used := t.federatedOwnerOf(username); used {
+		return fmt.Sprintf("Another user has already registered as %s on server %s.", username, origin)
+	}
+
 	if t.checkIfUsernameIsUsedByDifferentAddressAndAddItOtherwise(senderAddress, username) {
 		return fmt.Sprintf("Another user has already registered as %s.", username)
 	}
 
 	if registeredAs, valid := t.validateAndUpdateUsername(senderAddress, username); !valid {
-		return fmt.Sprintf("You have already registered as %s.", registeredAs)
+		return registeredAsMessage(registeredAs)
 	}
 
-	t.registerFiles(username, files...)
+	maxFiles := t.getConfig().MaxFilesPerUser
+	if err := t.registerFiles(username, fileScope, maxFiles, files...); err != nil {
+		t.recordViolation(senderAddress, "too_many_files")
+		return fmt.Sprintf("%s%s, at most %d files can be registered per user", errorPrefix, err.Error(), maxFiles)
+	}
+	t.logger.Info("Registered files", "component", "tracker", "client", senderAddress, "user", username, "scope", fileScope.String(), "count", len(files), "files", toPaths(files))
 
 	return "Successfully registered files."
 }
 
-func (t *TorrentServer) handleRegisterFilesCommand(rw *bufio.ReadWriter, senderAddress, username string, files ...string) {
-	rw.WriteString(t.registerFilesCommandHelper(senderAddress, username, files...) + "\n")
+func (t *TorrentServer) handleRegisterFilesCommand(client *Client, senderAddress, username string, fileScope *scope, files ...string) {
+	client.send(t.registerFilesCommandHelper(senderAddress, username, fileScope, files...))
 }
 
-func (t *TorrentServer) registerMiniServer(clientAddress, miniServerAddress string) {
+// registerMiniServer is a function that records the mini server address of the client at "clientAddress"
+// and returns false if the client is no longer connected
+func (t *TorrentServer) registerMiniServer(clientAddress, miniServerAddress string) bool {
 	t.clientsMutex.Lock()
 	defer t.clientsMutex.Unlock()
 
-	t.clients[clientAddress].miniServerAddress = miniServerAddress
+	client, ok := t.clients[clientAddress]
+	if !ok {
+		return false
+	}
+	client.miniServerAddress = miniServerAddress
+	client.reachability = reachabilityUnknown
+	return true
 }
 
-func (t *TorrentServer) handleListFilesCommand(rw *bufio.ReadWriter) {
-	rw.WriteString("list-files:" + t.listFiles() + "\n")
+func (t *TorrentServer) handleListFilesCommand(client *Client, clientAddress string) {
+	client.send("list-files:" + t.listFiles(clientAddress, ""))
 }
 
-func (t *TorrentServer) handleListUsersCommand(rw *bufio.ReadWriter) {
-	rw.WriteString(t.listUsersAndTheirAddresses() + "\n")
+func (t *TorrentServer) handleSearchCommand(client *Client, clientAddress, term string) {
+	client.send("search:" + t.listFiles(clientAddress, strings.ReplaceAll(term, `"`, "")))
 }
 
-func (t *TorrentServer) handleRegisterMiniServerCommand(rw *bufio.ReadWriter, clientAddress, miniServerAddress string) {
-	t.registerMiniServer(clientAddress, miniServerAddress)
-	rw.WriteString("Successfully registered miniServerAddress." + "\n")
+func (t *TorrentServer) handleListUsersCommand(client *Client) {
+	client.send(t.listUsersAndTheirAddresses())
 }
 
-func (t *TorrentServer) registerClient(address string) {
+func (t *TorrentServer) handleRegisterMiniServerCommand(client *Client, clientAddress, miniServerAddress string) {
+	if !t.registerMiniServer(clientAddress, miniServerAddress) {
+		client.send(notConnectedMessage)
+		return
+	}
+	go t.probeClient(clientAddress, miniServerAddress)
+	client.send("Successfully registered miniServerAddress.")
+}
+
+func (t *TorrentServer) handlePingCommand(client *Client) {
+	client.send("pong")
+}
+
+// registerClient is a function that:
+//    - creates a Client for "conn" and registers it under "address"
+//    - returns the Client
+//    (***) Returns false if the IP of "address" already has as many connections as it may have
+func (t *TorrentServer) registerClient(address string, conn net.Conn) (*Client, bool) {
+	config := t.getConfig()
+
 	t.clientsMutex.Lock()
 	defer t.clientsMutex.Unlock()
 
-	t.clients[address] = CreateEmptyClient()
+	if config.MaxConnectionsPerIP > 0 {
+		connections := 0
+		for otherAddress := range t.clients {
+			if hostOf(otherAddress) == hostOf(address) {
+				connections++
+			}
+		}
+		if connections >= config.MaxConnectionsPerIP {
+			return nil, false
+		}
+	}
+
+	client := CreateClientFor(conn)
+	client.connectedAt = time.Now()
+	client.leaseExpiry = client.connectedAt.Add(config.LeaseDuration)
+	t.clients[address] = client
+
+	return client, true
+}
+
+// renewLease is a function that extends the lease of the client at "clientAddress"
+// and returns false if the client is no longer connected, because it was kicked, banned or its lease expired
+func (t *TorrentServer) renewLease(clientAddress string) bool {
+	t.clientsMutex.Lock()
+	defer t.clientsMutex.Unlock()
+
+	client, ok := t.clients[clientAddress]
+	if !ok {
+		return false
+	}
+	client.leaseExpiry = time.Now().Add(t.getConfig().LeaseDuration)
+	return true
 }
 
-func (t *TorrentServer) getUsernameFor(clientAddress string) (string, error) {
+func (t *TorrentServer) getUsernamesFor(clientAddress string) ([]string, error) {
 	t.clientsMutex.Lock()
 	defer t.clientsMutex.Unlock()
 
 	if client, ok := t.clients[clientAddress]; ok {
-		return client.username, nil
+		return client.names(), nil
 	}
 
-	return "", fmt.Errorf("There is no such username")
+	return nil, fmt.Errorf("There is no such username")
 }
 
 func (t *TorrentServer) deleteFilesFor(username string) {
@@ -201,76 +376,221 @@ func (t *TorrentServer) deleteFilesFor(username string) {
 	delete(t.files, username)
 }
 
+// deleteAllFilesOf is a function that deletes the files of "username" and of "username" on every device
+func (t *TorrentServer) deleteAllFilesOf(username string) {
+	t.filesMutex.Lock()
+	defer t.filesMutex.Unlock()
+
+	for identity := range t.files {
+		if identityBelongsTo(identity, username) {
+			delete(t.files, identity)
+		}
+	}
+}
+
 func (t *TorrentServer) disconnect(clientAddress string) {
-	username, err := t.getUsernameFor(clientAddress)
+	usernames, err := t.getUsernamesFor(clientAddress)
 
 	if err == nil {
 		t.usedUsernamesMutex.Lock()
 		defer t.usedUsernamesMutex.Unlock()
 
-		delete(t.usedUsernames, username)
+		for _, username := range usernames {
+			delete(t.usedUsernames, username)
+		}
 
 		t.clientsMutex.Lock()
 		defer t.clientsMutex.Unlock()
 		delete(t.clients, clientAddress)
 
-		t.deleteFilesFor(username)
+		for _, username := range usernames {
+			t.deleteFilesFor(username)
+		}
 	}
 }
 
 func (t *TorrentServer) handleConnection(conn net.Conn) {
 	clientAddress := conn.RemoteAddr().String()
-	log.Println("Accepted connection from: ", clientAddress)
+	logger := t.logger.With("component", "tracker", "client", clientAddress)
+	logger.Info("Accepted connection")
+
+	if t.isStandby() {
+		logger.Info("Refused connection, the server is a standby")
+		t.refuseAsStandby(conn)
+		return
+	}
+
+	if t.isAddressBanned(clientAddress) {
+		logger.Warn("Refused connection from banned address")
+		conn.Write([]byte("You are banned." + "\n"))
+		conn.Close()
+		return
+	}
 
-	t.registerClient(clientAddress)
+	client, registered := t.registerClient(clientAddress, conn)
+	if !registered {
+		t.metrics.errors.WithLabel("too_many_connections").Inc()
+		logger.Warn("Refused connection, the address has too many connections")
+		conn.Write([]byte(errorPrefix + "too many connections from your address" + "\n"))
+		conn.Close()
+		return
+	}
+	if err := t.announceTicketKey(client); err != nil {
+		logger.Warn("Could not announce ticket key", "error", err)
+	}
 
-	readerWriter := bufio.NewReadWriter(bufio.NewReaderSize(conn, 4096), bufio.NewWriterSize(conn, 4096))
+	reader := bufio.NewReaderSize(conn, 4096)
+	limiter := createRateLimiter(t.getConfig().CommandBurst)
 	defer conn.Close()
 
-loop:
 	for {
-		readerWriter.Flush()
-		if data, err := readerWriter.ReadString('\n'); err != nil {
-			log.Println(err)
+		config := t.getConfig()
+		if data, tooLong, err := readLimitedLine(reader, config.MaxLineLength); err != nil {
+			if err != io.EOF {
+				t.metrics.errors.WithLabel("read").Inc()
+				logger.Warn("Error reading from client", "error", err)
+			} else {
+				logger.Info("Client closed the connection")
+			}
 			t.disconnect(clientAddress)
 			break
+		} else if tooLong {
+			client.send(fmt.Sprintf("%scommand too long, at most %d bytes", errorPrefix, config.MaxLineLength))
+			if t.recordViolation(clientAddress, "line_too_long") {
+				break
+			}
+		} else if !limiter.allow(config.CommandRate, config.CommandBurst, time.Now()) {
+			client.send(errorPrefix + "rate limit exceeded, slow down")
+			if t.recordViolation(clientAddress, "rate_limited") {
+				break
+			}
 		} else {
-			readerWriter.Flush()
-			fmt.Print("From client ", clientAddress, ": ", data)
-			parsedCommand := strings.Fields(data)
-
-			switch parsedCommand[commandIndex] {
-			case "disconnect":
-				t.disconnect(clientAddress)
-				break loop
-			case "unregister":
-				t.handleUnregisterFilesCommand(readerWriter, clientAddress, parsedCommand[userIndex], parsedCommand[filesStartIndex:]...)
-			case "register-miniserver":
-				t.handleRegisterMiniServerCommand(readerWriter, clientAddress, parsedCommand[miniServerAddressIndex])
-			case "register":
-				t.handleRegisterFilesCommand(readerWriter, clientAddress, parsedCommand[userIndex], parsedCommand[filesStartIndex:]...)
-			case "list-files":
-				t.handleListFilesCommand(readerWriter)
-			case "list-users":
-				t.handleListUsersCommand(readerWriter)
+			if !t.renewLease(clientAddress) {
+				logger.Info("Stopped reading from removed client")
+				break
+			}
+			parsedCommand := splitCommand(data)
+			logger.Debug("Received command", "command", logging.Path(strings.TrimSpace(data)))
+			started := time.Now()
+
+			command, closeConnection := t.dispatch(client, clientAddress, parsedCommand)
+
+			t.metrics.commands.WithLabel(command).Inc()
+			t.metrics.commandLatency.WithLabel(command).Observe(time.Since(started).Seconds())
+
+			if closeConnection {
+				break
 			}
-			readerWriter.Flush()
 		}
 	}
 }
 
+func (t *TorrentServer) pingClients() {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	for _, client := range t.clients {
+		go client.send("ping")
+	}
+}
+
+func (t *TorrentServer) collectExpiredClients() map[string]*Client {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	now := time.Now()
+	expired := make(map[string]*Client)
+	for address, client := range t.clients {
+		if now.After(client.leaseExpiry) {
+			expired[address] = client
+		}
+	}
+
+	return expired
+}
+
+func (t *TorrentServer) expireLeases() {
+	for address, client := range t.collectExpiredClients() {
+		t.logger.Info("Lease expired, disconnecting client", "component", "reaper", "client", address)
+		t.disconnect(address)
+		if client.conn != nil {
+			client.conn.Close()
+		}
+	}
+}
+
+func (t *TorrentServer) reapDeadClientsPeriodically() {
+	for {
+		time.Sleep(t.getConfig().HeartbeatInterval)
+		t.expireLeases()
+		t.pingClients()
+	}
+}
+
 // CreateNewServer is a factory method that:
 //    - accepts
 //         - port - a string representation of the port on which the server will listen
 //    - creates and returns
 //         - a pointer to TorrentServer struct
 func CreateNewServer(port string) *TorrentServer {
-	return &TorrentServer{
-		port:          port,
-		usedUsernames: make(map[string]*string),
-		clients:       make(map[string]*Client),
-		files:         make(map[string]map[string]struct{}),
+	t, _ := CreateNewServerWithConfig(port, CreateDefaultConfig(), "")
+	return t
+}
+
+// CreateNewServerWithConfig is a factory method that:
+//    - accepts
+//         - port       - a string representation of the port on which the server will listen
+//         - config     - a pointer to Config struct with the settings of the server
+//         - configPath - path to the JSON config file that "reload-config" re-reads, empty if there is none
+//    - creates and returns
+//         - a pointer to TorrentServer struct
+//    (***) Returns error if the logger cannot be created from the config
+func CreateNewServerWithConfig(port string, config *Config, configPath string) (*TorrentServer, error) {
+	logger, err := createLogger(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ticketKey, err := loadTicketKey(config.TicketKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TorrentServer{
+		port:                 port,
+		config:               config,
+		configPath:           configPath,
+		startTime:            time.Now(),
+		usedUsernames:        make(map[string]*string),
+		clients:              make(map[string]*Client),
+		files:                make(map[string]map[string]*fileInfo),
+		groups:               make(map[string]*group),
+		bannedUsernames:      make(map[string]struct{}),
+		bannedIPs:            make(map[string]struct{}),
+		temporarilyBannedIPs: make(map[string]time.Time),
+		ticketKey:            ticketKey,
+		swarms:               announce.CreateTracker(config.AnnounceInterval),
+		relays:               make(map[string]*relayEnd),
+	}
+	if config.FederationToken != "" && (config.FederationAddress != "" || len(config.FederationPeers) > 0) {
+		name := config.FederationName
+		if name == "" {
+			if name, err = os.Hostname(); err != nil {
+				return nil, fmt.Errorf("Could not name the server in the federation. %w", err)
+			}
+		}
+		t.federation = federation.CreateFederation(name, config.FederationToken, config.FederationPeers, 3*config.FederationInterval)
 	}
+	if config.ClusterToken != "" && config.ClusterAddress != "" {
+		tracker := net.JoinHostPort(hostOf(config.ClusterAddress), port)
+		t.cluster = cluster.CreateNode(config.ClusterAddress, tracker, config.ClusterToken, config.ClusterPeers, config.ClusterTimeout, t.applyChange)
+	}
+	t.metrics = createServerMetrics(t)
+	t.logger = logger
+	t.commands = make(map[string]*command)
+	t.registerCommands()
+
+	return t, nil
 }
 
 // Start is a function that:
@@ -285,10 +605,78 @@ func (t *TorrentServer) Start() error {
 
 	defer listener.Close()
 
-	log.Printf("Server Started. Listening on port %s", t.port)
+	t.logger.Info("Server started", "component", "tracker", "port", t.port)
+	go t.reapDeadClientsPeriodically()
+	go t.probeMiniServersPeriodically()
+
+	if metricsAddress := t.getConfig().MetricsAddress; metricsAddress != "" {
+		go func() {
+			if err := t.metrics.registry.Serve(metricsAddress); err != nil {
+				t.logger.Error("Metrics endpoint stopped", "component", "metrics", "error", err)
+			}
+		}()
+	}
+
+	if announceAddress := t.getConfig().AnnounceAddress; announceAddress != "" {
+		go func() {
+			if err := t.swarms.Serve(announceAddress); err != nil {
+				t.logger.Error("Announce endpoint stopped", "component", "announce", "error", err)
+			}
+		}()
+	}
+
+	if discoveryGroup := t.getConfig().DiscoveryGroup; discoveryGroup != "" {
+		go func() {
+			if err := t.answerDiscoveryQueries(discoveryGroup); err != nil {
+				t.logger.Warn("Local network discovery stopped", "component", "discovery", "error", err)
+			}
+		}()
+	}
+
+	if t.federation != nil {
+		if federationAddress := t.getConfig().FederationAddress; federationAddress != "" {
+			go func() {
+				if err := t.federation.Serve(federationAddress); err != nil {
+					t.logger.Error("Federation endpoint stopped", "component", "federation", "error", err)
+				}
+			}()
+		}
+		t.logger.Info("Replicating the index", "component", "federation", "name", t.federation.Name(), "peers", strings.Join(t.federation.Peers(), ","))
+		go t.pushSnapshotsPeriodically()
+	}
+
+	if relayAddress := t.getConfig().RelayAddress; relayAddress != "" {
+		go func() {
+			if err := t.serveRelays(relayAddress); err != nil {
+				t.logger.Error("Relay stopped", "component", "relay", "error", err)
+			}
+		}()
+	}
+
+	if t.cluster != nil {
+		clusterAddress := t.getConfig().ClusterAddress
+		go func() {
+			if err := t.cluster.Serve(clusterAddress); err != nil {
+				t.logger.Error("Cluster endpoint stopped", "component", "cluster", "error", err)
+			}
+		}()
+		t.logger.Info("Joined the cluster as a standby", "component", "cluster", "address", clusterAddress, "peers", strings.Join(t.cluster.Peers(), ","))
+		go t.cluster.Run()
+		go t.followClusterRole()
+	}
+
+	if adminAddress := t.getConfig().AdminAddress; adminAddress != "" {
+		go func() {
+			if err := t.startAdmin(adminAddress); err != nil {
+				t.logger.Error("Admin interface stopped", "component", "admin", "error", err)
+			}
+		}()
+	}
+
 	for {
 		if conn, err := listener.Accept(); err != nil {
-			log.Println("Error accepting connection")
+			t.metrics.errors.WithLabel("accept").Inc()
+			t.logger.Error("Error accepting connection", "component", "tracker", "error", err)
 		} else {
 			go t.handleConnection(conn)
 		}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/ticket"
+)
+
+const (
+	ticketKeyPrefix    = "ticket-key "
+	anonymousRequester = "-"
+)
+
+// loadTicketKey is a function that:
+//    - accepts:
+//         - path - path to a file with the hex encoded seed of the signing key, empty for a key that lives as long as the server
+//    - returns the private key that download tickets are signed with, the file is created with a new seed if it does not exist
+//    (***) Returns error if the file cannot be read, written or contains an invalid seed
+func loadTicketKey(path string) (ed25519.PrivateKey, error) {
+	if path == "" {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("Could not generate ticket key. %w", err)
+		}
+		return key, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, fmt.Errorf("Could not generate ticket key. %w", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(seed)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("Could not write ticket key file %s. %w", path, err)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read ticket key file %s. %w", path, err)
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("Invalid ticket key file %s. It must contain %d hex encoded bytes", path, ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// announceTicketKey is a function that sends the public key of the server to "client",
+// so that its mini server can verify the download tickets of other clients
+func (t *TorrentServer) announceTicketKey(client *Client) error {
+	return client.send(ticketKeyPrefix + ticket.EncodePublicKey(t.ticketKey.Public().(ed25519.PublicKey)))
+}
+
+func (t *TorrentServer) identityOf(clientAddress string) string {
+	t.clientsMutex.RLock()
+	defer t.clientsMutex.RUnlock()
+
+	if client, ok := t.clients[clientAddress]; ok && client.username != "" {
+		return client.username
+	}
+	return anonymousRequester
+}
+
+// issueTicket is a function that:
+//    - returns a signed ticket that allows the client with "requesterAddress" to download "filePath" from "h"
+//    (***) Returns error if the ticket cannot be signed
+func (t *TorrentServer) issueTicket(requesterAddress string, h holder, filePath string) (string, error) {
+	return ticket.Issue(t.ticketKey, ticket.Ticket{
+		Requester: t.identityOf(requesterAddress),
+		Owner:     h.identity,
+		Holder:    h.miniServerAddress,
+		File:      filePath,
+		Expires:   time.Now().Add(t.getConfig().TicketTTL),
+	})
+}
@@ -0,0 +1,151 @@
+// Package bencode encodes and decodes the bencoding used by BitTorrent metainfo files and trackers.
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ErrMalformed is returned for input that is not valid bencoding
+var ErrMalformed = errors.New("malformed bencoding")
+
+// Encode is a function that:
+//    - accepts:
+//         - value - a string, []byte, int, int64, []interface{} or map[string]interface{} of such values
+//    - returns the bencoding of "value", with the keys of dictionaries in sorted order
+//    (***) Returns error if "value" or one of its elements has another type
+func Encode(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := encode(&buffer, value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func encode(buffer *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		buffer.WriteString(strconv.Itoa(len(v)) + ":" + v)
+	case []byte:
+		buffer.WriteString(strconv.Itoa(len(v)) + ":")
+		buffer.Write(v)
+	case int:
+		buffer.WriteString("i" + strconv.Itoa(v) + "e")
+	case int64:
+		buffer.WriteString("i" + strconv.FormatInt(v, 10) + "e")
+	case []interface{}:
+		buffer.WriteByte('l')
+		for _, element := range v {
+			if err := encode(buffer, element); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buffer.WriteByte('d')
+		for _, key := range keys {
+			encode(buffer, key)
+			if err := encode(buffer, v[key]); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('e')
+	default:
+		return fmt.Errorf("Cannot bencode values of type %T", value)
+	}
+	return nil
+}
+
+// Decode is a function that:
+//    - accepts:
+//         - data - bencoded data
+//    - returns the decoded value, in which strings are string, integers are int64, lists are []interface{}
+//    and dictionaries are map[string]interface{}
+//    (***) Returns ErrMalformed if "data" is not a single valid bencoded value
+func Decode(data []byte) (interface{}, error) {
+	value, rest, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrMalformed
+	}
+	return value, nil
+}
+
+func decode(data []byte) (interface{}, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, ErrMalformed
+	}
+
+	switch {
+	case data[0] == 'i':
+		end := bytes.IndexByte(data, 'e')
+		if end < 0 {
+			return nil, nil, ErrMalformed
+		}
+		number, err := strconv.ParseInt(string(data[1:end]), 10, 64)
+		if err != nil {
+			return nil, nil, ErrMalformed
+		}
+		return number, data[end+1:], nil
+	case data[0] == 'l':
+		list := make([]interface{}, 0)
+		rest := data[1:]
+		for len(rest) > 0 && rest[0] != 'e' {
+			element, next, err := decode(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			list = append(list, element)
+			rest = next
+		}
+		if len(rest) == 0 {
+			return nil, nil, ErrMalformed
+		}
+		return list, rest[1:], nil
+	case data[0] == 'd':
+		dictionary := make(map[string]interface{})
+		rest := data[1:]
+		for len(rest) > 0 && rest[0] != 'e' {
+			key, next, err := decode(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, nil, ErrMalformed
+			}
+			value, next, err := decode(next)
+			if err != nil {
+				return nil, nil, err
+			}
+			dictionary[keyString] = value
+			rest = next
+		}
+		if len(rest) == 0 {
+			return nil, nil, ErrMalformed
+		}
+		return dictionary, rest[1:], nil
+	case data[0] >= '0' && data[0] <= '9':
+		colon := bytes.IndexByte(data, ':')
+		if colon < 0 {
+			return nil, nil, ErrMalformed
+		}
+		length, err := strconv.Atoi(string(data[:colon]))
+		if err != nil || length < 0 || colon+1+length > len(data) {
+			return nil, nil, ErrMalformed
+		}
+		return string(data[colon+1 : colon+1+length]), data[colon+1+length:], nil
+	}
+	return nil, nil, ErrMalformed
+}
@@ -0,0 +1,70 @@
+package bencode_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/imaikeru/peer-to-peer/shared/bencode"
+)
+
+func TestEncodeTableDriven(t *testing.T) {
+	var tests = []struct {
+		value   interface{}
+		encoded string
+	}{
+		{"spam", "4:spam"},
+		{[]byte{0, 1}, "2:\x00\x01"},
+		{42, "i42e"},
+		{int64(-3), "i-3e"},
+		{[]interface{}{"spam", 1}, "l4:spami1ee"},
+		{map[string]interface{}{"b": 1, "a": "x"}, "d1:a1:x1:bi1ee"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoded, func(t *testing.T) {
+			encoded, err := bencode.Encode(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(encoded) != tt.encoded {
+				t.Errorf("got %q, want %q", encoded, tt.encoded)
+			}
+		})
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	value := map[string]interface{}{
+		"announce": "http://127.0.0.1:6969/announce",
+		"info": map[string]interface{}{
+			"length": int64(12),
+			"pieces": "\x00\x01\x02",
+		},
+		"list": []interface{}{int64(1), "two"},
+	}
+
+	encoded, err := bencode.Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := bencode.Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("got %#v, want %#v", decoded, value)
+	}
+}
+
+func TestDecodeRejectsMalformedInput(t *testing.T) {
+	var tests = []string{"", "i12", "5:spam", "l4:spam", "di1ei2ee", "4:spamextra", "x"}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			if _, err := bencode.Decode([]byte(tt)); err == nil {
+				t.Errorf("expected an error for %q", tt)
+			}
+		})
+	}
+}
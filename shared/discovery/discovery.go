@@ -0,0 +1,180 @@
+// Package discovery finds trackers and peers on the local network without any configuration.
+// Services listen on a UDP multicast group and answer the queries sent to it, similarly to mDNS.
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultGroup is the multicast group the trackers and peers of the local network meet on
+	DefaultGroup = "239.255.13.37:13339"
+	// TrackerService is the service that central servers announce
+	TrackerService = "p2p-tracker"
+	// PeerService is the service that DHT nodes of clients announce
+	PeerService = "p2p-peer"
+
+	maxMessageSize = 1024
+)
+
+// ErrNotFound is returned when nothing answered a query
+var ErrNotFound = errors.New("nothing on the local network answered")
+
+// Announcement is a struct that contains:
+//    - Service  - the announced service, e.g. TrackerService
+//    - Port     - the port the service listens on
+//    - Instance - a name that tells apart the instances of a service, used for ignoring own queries
+//    - Query    - true if the message asks the instances of "Service" to announce themselves
+//    - Address  - the address of the service, filled in from the source address of a received announcement
+type Announcement struct {
+	Service  string `json:"service"`
+	Port     int    `json:"port,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Query    bool   `json:"query,omitempty"`
+	Address  string `json:"-"`
+}
+
+func (a Announcement) encode() []byte {
+	encoded, _ := json.Marshal(a)
+	return encoded
+}
+
+func decode(message []byte, source *net.UDPAddr) (Announcement, bool) {
+	var announcement Announcement
+	if err := json.Unmarshal(message, &announcement); err != nil || announcement.Service == "" {
+		return Announcement{}, false
+	}
+	if !announcement.Query && (announcement.Port <= 0 || announcement.Port > 65535) {
+		return Announcement{}, false
+	}
+	announcement.Address = net.JoinHostPort(source.IP.String(), fmt.Sprint(announcement.Port))
+	return announcement, true
+}
+
+// listen is a function that joins "group" if it is a multicast address and otherwise listens on it
+func listen(group *net.UDPAddr) (*net.UDPConn, error) {
+	if group.IP.IsMulticast() {
+		return net.ListenMulticastUDP("udp", nil, group)
+	}
+	return net.ListenUDP("udp", group)
+}
+
+// Responder is a struct that contains:
+//    - group        - the address of the group the responder listens on
+//    - connection   - the socket joined to "group"
+//    - replies      - the socket answers are sent from, since a socket bound to a multicast group cannot be a source of unicast packets
+//    - announcement - the announcement sent in answer to queries for its service
+type Responder struct {
+	group        *net.UDPAddr
+	connection   *net.UDPConn
+	replies      *net.UDPConn
+	announcement Announcement
+}
+
+// CreateResponder is a factory method that:
+//    - accepts:
+//         - group        - the multicast group to listen on, e.g. DefaultGroup. Other addresses are listened on directly.
+//         - announcement - the service to announce
+//    - creates a Responder, which answers queries once it serves
+//    (***) Returns error if the group cannot be joined
+func CreateResponder(group string, announcement Announcement) (*Responder, error) {
+	groupAddress, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid discovery group %s. %w", group, err)
+	}
+
+	connection, err := listen(groupAddress)
+	if err != nil {
+		return nil, fmt.Errorf("Could not join discovery group %s. %w", group, err)
+	}
+
+	replies, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("Could not open discovery socket. %w", err)
+	}
+
+	return &Responder{group: groupAddress, connection: connection, replies: replies, announcement: announcement}, nil
+}
+
+// Serve is a function that announces the service to the group and answers the queries for it until the Responder is closed
+//    (***) Returns error if the socket fails
+func (r *Responder) Serve() error {
+	r.replies.WriteToUDP(r.announcement.encode(), r.group)
+
+	buffer := make([]byte, maxMessageSize)
+	for {
+		length, source, err := r.connection.ReadFromUDP(buffer)
+		if err != nil {
+			return fmt.Errorf("Could not read discovery query. %w", err)
+		}
+
+		query, ok := decode(buffer[:length], source)
+		if !ok || !query.Query || query.Service != r.announcement.Service || (query.Instance != "" && query.Instance == r.announcement.Instance) {
+			continue
+		}
+		r.replies.WriteToUDP(r.announcement.encode(), source)
+	}
+}
+
+// Close stops the Responder
+func (r *Responder) Close() error {
+	r.replies.Close()
+	return r.connection.Close()
+}
+
+// Find is a function that:
+//    - accepts:
+//         - group    - the multicast group to ask, e.g. DefaultGroup
+//         - service  - the wanted service, e.g. TrackerService
+//         - instance - the instance of the service that asks, whose own Responder stays silent, empty if it is not an instance
+//         - timeout  - how long to wait for answers
+//         - count    - after how many answers to stop waiting
+//    - returns the instances of the service that answered, sorted by address
+//    (***) Returns ErrNotFound if nothing answered
+func Find(group, service, instance string, timeout time.Duration, count int) ([]Announcement, error) {
+	groupAddress, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid discovery group %s. %w", group, err)
+	}
+
+	connection, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open discovery socket. %w", err)
+	}
+	defer connection.Close()
+
+	query := Announcement{Service: service, Instance: instance, Query: true}
+	if _, err := connection.WriteToUDP(query.encode(), groupAddress); err != nil {
+		return nil, fmt.Errorf("Could not query discovery group %s. %w", group, err)
+	}
+
+	connection.SetReadDeadline(time.Now().Add(timeout))
+	found := make(map[string]Announcement)
+	buffer := make([]byte, maxMessageSize)
+	for len(found) < count {
+		length, source, err := connection.ReadFromUDP(buffer)
+		if err != nil {
+			break
+		}
+		if answer, ok := decode(buffer[:length], source); ok && !answer.Query && answer.Service == service {
+			found[answer.Address] = answer
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, ErrNotFound
+	}
+
+	answers := make([]Announcement, 0, len(found))
+	for _, answer := range found {
+		answers = append(answers, answer)
+	}
+	sort.Slice(answers, func(i, j int) bool { return answers[i].Address < answers[j].Address })
+	return answers, nil
+}
@@ -0,0 +1,73 @@
+package discovery_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/discovery"
+)
+
+// startResponder is a function that serves "announcement" on a loopback UDP address, which stands in for the multicast group
+func startResponder(t *testing.T, announcement discovery.Announcement) (string, *discovery.Responder) {
+	t.Helper()
+
+	free, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := free.LocalAddr().String()
+	free.Close()
+
+	responder, err := discovery.CreateResponder(group, announcement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go responder.Serve()
+	return group, responder
+}
+
+func TestFind(t *testing.T) {
+	trackerGroup, tracker := startResponder(t, discovery.Announcement{Service: discovery.TrackerService, Port: 13337})
+	defer tracker.Close()
+	peerGroup, peer := startResponder(t, discovery.Announcement{Service: discovery.PeerService, Port: 6881, Instance: "alice"})
+	defer peer.Close()
+
+	tests := []struct {
+		name     string
+		group    string
+		service  string
+		instance string
+		expected []discovery.Announcement
+		err      error
+	}{
+		{
+			name:     "tracker",
+			group:    trackerGroup,
+			service:  discovery.TrackerService,
+			expected: []discovery.Announcement{{Service: discovery.TrackerService, Port: 13337, Address: "127.0.0.1:13337"}},
+		},
+		{
+			name:     "other peer",
+			group:    peerGroup,
+			service:  discovery.PeerService,
+			instance: "bob",
+			expected: []discovery.Announcement{{Service: discovery.PeerService, Port: 6881, Instance: "alice", Address: "127.0.0.1:6881"}},
+		},
+		{name: "own query", group: peerGroup, service: discovery.PeerService, instance: "alice", err: discovery.ErrNotFound},
+		{name: "other service", group: trackerGroup, service: discovery.PeerService, err: discovery.ErrNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found, err := discovery.Find(test.group, test.service, test.instance, 200*time.Millisecond, 1)
+			if err != test.err {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if !reflect.DeepEqual(found, test.expected) {
+				t.Fatalf("got %+v, want %+v", found, test.expected)
+			}
+		})
+	}
+}
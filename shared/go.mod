@@ -0,0 +1,3 @@
+module github.com/imaikeru/peer-to-peer/shared
+
+go 1.15
@@ -0,0 +1,301 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log record
+type Level int32
+
+// The supported levels, from the most to the least verbose one
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Format is the encoding of the log records
+type Format int
+
+// The supported formats
+const (
+	FormatLogfmt Format = iota
+	FormatJSON
+)
+
+const redacted = "[redacted]"
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel is a function that:
+//    - accepts:
+//         - name - "debug", "info", "warn" or "error"
+//    - returns the corresponding Level
+//    (***) Returns error if there is no such level
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("Unknown log level %q", name)
+}
+
+// ParseFormat is a function that:
+//    - accepts:
+//         - name - "logfmt" or "json"
+//    - returns the corresponding Format
+//    (***) Returns error if there is no such format
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "logfmt":
+		return FormatLogfmt, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return FormatLogfmt, fmt.Errorf("Unknown log format %q", name)
+}
+
+// Path is a file path which is logged only at debug level and redacted otherwise
+type Path string
+
+// sink is the destination shared by a Logger and all loggers derived from it
+type sink struct {
+	writer io.Writer
+	format Format
+	level  int32
+	mutex  sync.Mutex
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// Logger is a struct that contains:
+//    - sink   - where and how the records are written
+//    - fields - the fields that are added to every record of the Logger
+type Logger struct {
+	sink   *sink
+	fields []field
+}
+
+// CreateLogger is a factory method that:
+//    - accepts:
+//         - writer - where the records are written
+//         - level  - the least severe level that is written
+//         - format - the encoding of the records
+//    - creates and returns a pointer to Logger struct without fields
+func CreateLogger(writer io.Writer, level Level, format Format) *Logger {
+	return &Logger{
+		sink: &sink{
+			writer: writer,
+			format: format,
+			level:  int32(level),
+		},
+		fields: make([]field, 0),
+	}
+}
+
+// CreateDiscardLogger is a factory method that creates and returns a pointer to Logger struct which writes nothing
+func CreateDiscardLogger() *Logger {
+	return CreateLogger(ioutil.Discard, LevelError, FormatLogfmt)
+}
+
+// OpenSink is a function that:
+//    - accepts:
+//         - path - path to the log file, empty for standard error
+//    - returns a writer to the log file, which is opened for appending
+//    (***) Returns error if the log file cannot be opened
+func OpenSink(path string) (io.Writer, error) {
+	if path == "" {
+		return os.Stderr, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open log file %s. %w", path, err)
+	}
+	return file, nil
+}
+
+// SetLevel is a function that changes the least severe level written by the Logger and all loggers sharing its sink
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.sink.level, int32(level))
+}
+
+func (l *Logger) level() Level {
+	return Level(atomic.LoadInt32(&l.sink.level))
+}
+
+// With is a function that returns a Logger which adds the given key-value pairs to every record
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]field, 0, len(l.fields)+len(keysAndValues)/2)
+	fields = append(fields, l.fields...)
+	fields = append(fields, toFields(keysAndValues)...)
+
+	return &Logger{
+		sink:   l.sink,
+		fields: fields,
+	}
+}
+
+func toFields(keysAndValues []interface{}) []field {
+	fields := make([]field, 0, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fields = append(fields, field{key: fmt.Sprint(keysAndValues[i]), value: keysAndValues[i+1]})
+	}
+	if len(keysAndValues)%2 == 1 {
+		fields = append(fields, field{key: "extra", value: keysAndValues[len(keysAndValues)-1]})
+	}
+	return fields
+}
+
+// Debug is a function that writes a record with debug level
+func (l *Logger) Debug(message string, keysAndValues ...interface{}) {
+	l.log(LevelDebug, message, keysAndValues)
+}
+
+// Info is a function that writes a record with info level
+func (l *Logger) Info(message string, keysAndValues ...interface{}) {
+	l.log(LevelInfo, message, keysAndValues)
+}
+
+// Warn is a function that writes a record with warn level
+func (l *Logger) Warn(message string, keysAndValues ...interface{}) {
+	l.log(LevelWarn, message, keysAndValues)
+}
+
+// Error is a function that writes a record with error level
+func (l *Logger) Error(message string, keysAndValues ...interface{}) {
+	l.log(LevelError, message, keysAndValues)
+}
+
+func (l *Logger) render(value interface{}, minLevel Level) string {
+	switch v := value.(type) {
+	case Path:
+		if minLevel > LevelDebug {
+			return redacted
+		}
+		return string(v)
+	case []Path:
+		if minLevel > LevelDebug {
+			return redacted
+		}
+		paths := make([]string, 0, len(v))
+		for _, path := range v {
+			paths = append(paths, string(path))
+		}
+		return strings.Join(paths, ",")
+	case error:
+		if minLevel > LevelDebug {
+			return redactPaths(v)
+		}
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// redactPaths is a function that returns the message of "err" without the paths of the *os.PathError and *os.LinkError it wraps,
+// because they are as private as a Path
+func redactPaths(err error) string {
+	paths := make([]string, 0, 2)
+
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		paths = append(paths, pathErr.Path)
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		paths = append(paths, linkErr.Old, linkErr.New)
+	}
+
+	message := err.Error()
+	for _, path := range paths {
+		if path != "" {
+			message = strings.ReplaceAll(message, path, redacted)
+		}
+	}
+	return message
+}
+
+func (l *Logger) log(level Level, message string, keysAndValues []interface{}) {
+	minLevel := l.level()
+	if level < minLevel {
+		return
+	}
+
+	fields := make([]field, 0, 3+len(l.fields)+len(keysAndValues)/2)
+	fields = append(fields,
+		field{key: "time", value: time.Now().UTC().Format(time.RFC3339Nano)},
+		field{key: "level", value: level.String()},
+		field{key: "msg", value: message})
+	fields = append(fields, l.fields...)
+	fields = append(fields, toFields(keysAndValues)...)
+
+	var buf bytes.Buffer
+	if l.sink.format == FormatJSON {
+		l.encodeJSON(&buf, fields, minLevel)
+	} else {
+		l.encodeLogfmt(&buf, fields, minLevel)
+	}
+	buf.WriteByte('\n')
+
+	l.sink.mutex.Lock()
+	defer l.sink.mutex.Unlock()
+
+	l.sink.writer.Write(buf.Bytes())
+}
+
+func (l *Logger) encodeJSON(buf *bytes.Buffer, fields []field, minLevel Level) {
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		value, _ := json.Marshal(l.render(f.value, minLevel))
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+}
+
+func (l *Logger) encodeLogfmt(buf *bytes.Buffer, fields []field, minLevel Level) {
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(f.key)
+		buf.WriteByte('=')
+
+		value := l.render(f.value, minLevel)
+		if value == "" || strings.ContainsAny(value, " =\"\t\r\n") {
+			value = fmt.Sprintf("%q", value)
+		}
+		buf.WriteString(value)
+	}
+}
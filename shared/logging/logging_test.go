@@ -0,0 +1,101 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/imaikeru/peer-to-peer/shared/logging"
+)
+
+func TestPathsAreRedactedAboveDebug(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.CreateLogger(&out, logging.LevelInfo, logging.FormatLogfmt).With("component", "test")
+
+	logger.Info("Registered files", "files", logging.Path("/home/alice/secret.txt"))
+	logger.Debug("Not written")
+
+	line := out.String()
+	if strings.Contains(line, "secret.txt") {
+		t.Errorf("path was not redacted: %s", line)
+	}
+	if !strings.Contains(line, `msg="Registered files" component=test files=[redacted]`) {
+		t.Errorf("unexpected record: %s", line)
+	}
+	if strings.Count(line, "\n") != 1 {
+		t.Errorf("debug record was written: %s", line)
+	}
+
+	out.Reset()
+	logger.SetLevel(logging.LevelDebug)
+	logger.Debug("Registered files", "files", logging.Path("/home/alice/secret.txt"))
+
+	if !strings.Contains(out.String(), "files=/home/alice/secret.txt") {
+		t.Errorf("path was redacted at debug level: %s", out.String())
+	}
+}
+
+func TestPathsInErrorsAreRedactedAboveDebug(t *testing.T) {
+	_, openErr := os.Open("/home/alice/secret.txt")
+	renameErr := os.Rename("/home/alice/old.txt", "/home/alice/new.txt")
+
+	var tests = []struct {
+		name string
+		err  error
+	}{
+		{"path error", openErr},
+		{"wrapped path error", fmt.Errorf("Could not open /home/alice/secret.txt. %w", openErr)},
+		{"link error", renameErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, format := range []logging.Format{logging.FormatLogfmt, logging.FormatJSON} {
+				var out bytes.Buffer
+				logger := logging.CreateLogger(&out, logging.LevelWarn, format)
+
+				logger.Warn("Could not send file", "error", tt.err)
+
+				if strings.Contains(out.String(), "/home/alice") {
+					t.Errorf("path was not redacted: %s", out.String())
+				}
+				if !strings.Contains(out.String(), "[redacted]") || !strings.Contains(out.String(), "no such file or directory") {
+					t.Errorf("expected the error without its path: %s", out.String())
+				}
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	logging.CreateLogger(&out, logging.LevelDebug, logging.FormatLogfmt).Warn("Could not send file", "error", openErr)
+	if !strings.Contains(out.String(), "/home/alice/secret.txt") {
+		t.Errorf("path was redacted at debug level: %s", out.String())
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.CreateLogger(&out, logging.LevelDebug, logging.FormatJSON).With("client", "127.0.0.1:4000")
+
+	logger.Warn("Something \"odd\" happened", "count", 3)
+
+	var record map[string]string
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("record is not valid JSON: %s", out.String())
+	}
+
+	expected := map[string]string{
+		"level":  "warn",
+		"msg":    `Something "odd" happened`,
+		"client": "127.0.0.1:4000",
+		"count":  "3",
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("%s: got %q, want %q", key, record[key], value)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package ticket implements the signed download tickets that the central server issues
+// and the mini servers of the clients verify before sending a file.
+package ticket
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const separator = "."
+
+var (
+	// ErrMalformed is returned for tickets that cannot be decoded
+	ErrMalformed = errors.New("malformed ticket")
+	// ErrBadSignature is returned for tickets that were not signed by the central server
+	ErrBadSignature = errors.New("bad ticket signature")
+	// ErrExpired is returned for tickets whose lifetime has ended
+	ErrExpired = errors.New("expired ticket")
+)
+
+// Ticket is a struct that contains:
+//     - Requester - the identity of the user who downloads the file
+//     - Owner     - the identity of the user who shares the file
+//     - Holder    - the address of the mini server that the file is downloaded from
+//     - File      - the path of the file on the owner's machine
+//     - Expires   - the moment after which the ticket is not accepted anymore
+type Ticket struct {
+	Requester string
+	Owner     string
+	Holder    string
+	File      string
+	Expires   time.Time
+}
+
+// payload mirrors Ticket in the signed JSON format
+type payload struct {
+	Requester string `json:"requester"`
+	Owner     string `json:"owner"`
+	Holder    string `json:"holder"`
+	File      string `json:"file"`
+	Expires   int64  `json:"expires"`
+}
+
+// Issue is a function that:
+//    - accepts:
+//         - key    - the private key of the central server
+//         - ticket - the ticket to sign
+//    - returns the ticket encoded as "base64(payload).base64(signature)", which contains no white space
+//    (***) Returns error if the ticket cannot be encoded
+func Issue(key ed25519.PrivateKey, ticket Ticket) (string, error) {
+	encoded, err := json.Marshal(payload{
+		Requester: ticket.Requester,
+		Owner:     ticket.Owner,
+		Holder:    ticket.Holder,
+		File:      ticket.File,
+		Expires:   ticket.Expires.Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Could not encode ticket. %w", err)
+	}
+
+	signature := ed25519.Sign(key, encoded)
+	return base64.RawURLEncoding.EncodeToString(encoded) + separator + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify is a function that:
+//    - accepts:
+//         - key     - the public key of the central server
+//         - encoded - a ticket returned by Issue
+//         - now     - the current time
+//    - returns the decoded ticket
+//    (***) Returns ErrMalformed, ErrBadSignature or ErrExpired if the ticket is not valid
+func Verify(key ed25519.PublicKey, encoded string, now time.Time) (Ticket, error) {
+	split := strings.Split(encoded, separator)
+	if len(split) != 2 {
+		return Ticket{}, ErrMalformed
+	}
+
+	content, err := base64.RawURLEncoding.DecodeString(split[0])
+	if err != nil {
+		return Ticket{}, ErrMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(split[1])
+	if err != nil {
+		return Ticket{}, ErrMalformed
+	}
+
+	if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, content, signature) {
+		return Ticket{}, ErrBadSignature
+	}
+
+	var decoded payload
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return Ticket{}, ErrMalformed
+	}
+
+	ticket := Ticket{
+		Requester: decoded.Requester,
+		Owner:     decoded.Owner,
+		Holder:    decoded.Holder,
+		File:      decoded.File,
+		Expires:   time.Unix(decoded.Expires, 0),
+	}
+	if !now.Before(ticket.Expires) {
+		return ticket, ErrExpired
+	}
+
+	return ticket, nil
+}
+
+// EncodePublicKey is a function that returns "key" as a hex string, which is how the central server announces it
+func EncodePublicKey(key ed25519.PublicKey) string {
+	return hex.EncodeToString(key)
+}
+
+// DecodePublicKey is a function that:
+//    - accepts:
+//         - encoded - a public key returned by EncodePublicKey
+//    - returns the public key
+//    (***) Returns error if "encoded" is not a valid public key
+func DecodePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode public key. %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("Could not decode public key. It must be %d bytes long", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
@@ -0,0 +1,88 @@
+package ticket_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imaikeru/peer-to-peer/shared/ticket"
+)
+
+func TestVerifyTableDriven(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	issued := ticket.Ticket{
+		Requester: "bob",
+		Owner:     "alice@laptop",
+		Holder:    "127.0.0.1:4000",
+		File:      "/path/to/file with spaces",
+		Expires:   now.Add(time.Minute),
+	}
+	encoded, err := ticket.Issue(private, issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(encoded, " \n") {
+		t.Fatalf("encoded ticket %q contains white space", encoded)
+	}
+	split := strings.Split(encoded, ".")
+	tampered, _ := ticket.Issue(private, ticket.Ticket{File: "/other", Expires: issued.Expires})
+	forged := strings.Split(tampered, ".")[0] + "." + split[1]
+
+	var tests = []struct {
+		name    string
+		key     ed25519.PublicKey
+		encoded string
+		now     time.Time
+		err     error
+	}{
+		{"valid", public, encoded, now, nil},
+		{"expired", public, encoded, now.Add(time.Hour), ticket.ErrExpired},
+		{"other key", otherPublic, encoded, now, ticket.ErrBadSignature},
+		{"forged payload", public, forged, now, ticket.ErrBadSignature},
+		{"no signature", public, split[0], now, ticket.ErrMalformed},
+		{"not base64", public, "!!!.???", now, ticket.ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, err := ticket.Verify(tt.key, tt.encoded, tt.now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err == nil && verified != issued {
+				t.Errorf("got %+v, want %+v", verified, issued)
+			}
+		})
+	}
+}
+
+func TestPublicKeyRoundTrip(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := ticket.DecodePublicKey(ticket.EncodePublicKey(public))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(public) {
+		t.Errorf("got %x, want %x", decoded, public)
+	}
+
+	if _, err := ticket.DecodePublicKey("abcd"); err == nil {
+		t.Error("expected an error for a short key")
+	}
+}